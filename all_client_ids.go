@@ -0,0 +1,109 @@
+package restplay
+
+import (
+	"context"
+	"net/http"
+	"slices"
+)
+
+// GetAllClientIDs returns every non-empty value of the configured form keys across the URL query and request
+// body, de-duplicated in the order they were found. Body values come before query values, as they do for GetClientID.
+// It returns ErrMissingClientID if there are none.
+func GetAllClientIDs(req *http.Request) ([]string, *http.Request, error) {
+	return defaultExtractor.ExtractAll(req)
+}
+
+// ExtractAll returns every non-empty value of the configured form keys across the URL query and request body,
+// plus the elements of the JSONArrayPaths in JSON bodies, honoring Sources, ClientIDValidator, TrimPrefixes,
+// LowercaseClientID, AllowList, and MinTrust the same way Extract does. Other sources only ever hold a single client_id, so
+// they are not consulted.
+func (e *Extractor) ExtractAll(req *http.Request) ([]string, *http.Request, error) {
+	return e.ExtractAllContext(context.Background(), req)
+}
+
+// ExtractAllContext behaves like ExtractAll, but bounds any read of the request body by ctx.
+func (e *Extractor) ExtractAllContext(ctx context.Context, req *http.Request) ([]string, *http.Request, error) {
+	if req == nil {
+		return nil, nil, ErrNilRequest
+	}
+	if err := e.checkTransport(req, false); err != nil {
+		return nil, req, err
+	}
+	sources := e.sources()
+	useQuery := slices.Contains(sources, SourceURLQuery)
+	useBody := slices.Contains(sources, SourceRequestBody)
+
+	var (
+		clientIDs []string
+		invalid   error
+	)
+	add := func(source ClientIDSource, values ...string) {
+		for _, value := range values {
+			if value == "" || slices.Contains(clientIDs, value) {
+				continue
+			}
+			value, err := e.acceptClientID(ctx, source, value)
+			if err != nil {
+				if invalid == nil {
+					invalid = err
+				}
+				continue
+			}
+			if value != "" && !slices.Contains(clientIDs, value) {
+				clientIDs = append(clientIDs, value)
+			}
+		}
+	}
+	switch {
+	case !useQuery && !useBody:
+		// neither form source is configured, so there is nothing to collect
+	case e.isBodyMethod(req.Method) && !useBody:
+		// the body must not be touched, so only the URL itself can be consulted
+		query, err := parseQuery(req)
+		if err != nil {
+			return nil, req, err
+		}
+		for _, key := range e.valuesKeys() {
+			for _, k := range e.matchingFormKeys(query, key) {
+				add(SourceURLQuery, query[k]...)
+			}
+		}
+	default:
+		jsonClientID, _, _, _, err := e.parseRequestForm(ctx, req)
+		if err != nil {
+			return nil, req, err
+		}
+		if useBody {
+			add(SourceRequestBody, jsonClientID)
+			arrayClientIDs, err := e.extractJSONArrays(ctx, req)
+			if err != nil {
+				return nil, req, err
+			}
+			add(SourceRequestBody, arrayClientIDs...)
+		}
+		for _, key := range e.valuesKeys() {
+			keys := e.matchingFormKeys(req.Form, key)
+			if useBody {
+				for _, k := range keys {
+					add(SourceRequestBody, req.PostForm[k]...)
+				}
+			}
+			if useQuery {
+				for _, k := range keys {
+					// Form lists the body values ahead of the URL values, and PostForm holds only the former
+					if bodyValues := req.PostForm[k]; len(req.Form[k]) > len(bodyValues) {
+						add(SourceURLQuery, req.Form[k][len(bodyValues):]...)
+					}
+				}
+			}
+		}
+	}
+
+	if invalid != nil {
+		return nil, req, invalid
+	}
+	if len(clientIDs) == 0 {
+		return nil, req, ErrMissingClientID
+	}
+	return clientIDs, req, nil
+}
@@ -0,0 +1,223 @@
+package restplay
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGetAllClientIDs(t *testing.T) {
+	tests := map[string]struct {
+		Method            string
+		URL               string
+		ContentType       string
+		Body              string
+		Sources           []ClientIDSource
+		ExpectedClientIDs []string
+		ExpectedError     error
+	}{
+		"should return every client_id in the URL query": {
+			Method:            http.MethodGet,
+			URL:               "https://example.com?client_id=a&client_id=b",
+			ExpectedClientIDs: []string{"a", "b"},
+		},
+		"should return every client_id in a form body": {
+			Method:            http.MethodPost,
+			URL:               "https://example.com",
+			ContentType:       formContentType,
+			Body:              "client_id=robbie-1&client_id=robbie-2",
+			ExpectedClientIDs: []string{"robbie-1", "robbie-2"},
+		},
+		"should return body values ahead of query values without duplicates": {
+			Method:            http.MethodPost,
+			URL:               "https://example.com?client_id=a&client_id=robbie-1&client_id=b",
+			ContentType:       formContentType,
+			Body:              "client_id=robbie-1&client_id=&client_id=robbie-2",
+			ExpectedClientIDs: []string{"robbie-1", "robbie-2", "a", "b"},
+		},
+		"should include the client_id from a JSON body": {
+			Method:            http.MethodPost,
+			URL:               "https://example.com?client_id=a",
+			ContentType:       jsonContentType,
+			Body:              `{"client_id":"robbie-json"}`,
+			ExpectedClientIDs: []string{"robbie-json"},
+		},
+		"should skip the body when it is not a configured source": {
+			Method:            http.MethodPost,
+			URL:               "https://example.com?client_id=a&client_id=b",
+			ContentType:       formContentType,
+			Body:              "client_id=robbie-1",
+			Sources:           []ClientIDSource{SourceURLQuery},
+			ExpectedClientIDs: []string{"a", "b"},
+		},
+		"should skip the query when it is not a configured source": {
+			Method:            http.MethodPost,
+			URL:               "https://example.com?client_id=a",
+			ContentType:       formContentType,
+			Body:              "client_id=robbie-1&client_id=robbie-2",
+			Sources:           []ClientIDSource{SourceRequestBody},
+			ExpectedClientIDs: []string{"robbie-1", "robbie-2"},
+		},
+		"should return ErrMissingClientID when no values are present": {
+			Method:        http.MethodGet,
+			URL:           "https://example.com?client_id=",
+			ExpectedError: ErrMissingClientID,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.Method, tc.URL, strings.NewReader(tc.Body))
+			if err != nil {
+				t.Fatalf("failed to create request for test: %s", err)
+			}
+			if tc.ContentType != "" {
+				req.Header.Set(contentTypeHeaderKey, tc.ContentType)
+			}
+
+			var clientIDs []string
+			if tc.Sources == nil {
+				clientIDs, req, err = GetAllClientIDs(req)
+			} else {
+				clientIDs, req, err = (&Extractor{Sources: tc.Sources}).ExtractAll(req)
+			}
+			if tc.ExpectedError != nil {
+				if !errors.Is(err, tc.ExpectedError) {
+					t.Errorf("Expected error %v but got: %v", tc.ExpectedError, err)
+				}
+			} else if err != nil {
+				t.Errorf("No error expected but got: %q", err)
+			}
+			if !slices.Equal(clientIDs, tc.ExpectedClientIDs) {
+				t.Errorf("GetAllClientIDs() got = %q, want %q", clientIDs, tc.ExpectedClientIDs)
+			}
+
+			afterBody, err := io.ReadAll(req.Body)
+			if err != nil {
+				t.Fatalf("Unable to read request body after GetAllClientIDs(): %s", err)
+			}
+			if string(afterBody) != tc.Body {
+				t.Errorf("Request body changed:\n  Original: %q\n  After:   %q", tc.Body, afterBody)
+			}
+		})
+	}
+}
+
+func TestGetAllClientIDsFirstMatchesGetClientID(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://example.com?client_id=a&client_id=b", nil)
+	if err != nil {
+		t.Fatalf("failed to create request for test: %s", err)
+	}
+	clientIDs, req, err := GetAllClientIDs(req)
+	if err != nil {
+		t.Fatalf("No error expected but got: %q", err)
+	}
+	clientID, _, err := GetClientID(req)
+	if err != nil {
+		t.Fatalf("No error expected but got: %q", err)
+	}
+	if clientID != clientIDs[0] {
+		t.Errorf("GetClientID() got = %q, want the first of %q", clientID, clientIDs)
+	}
+}
+
+func TestExtractAllJSONArrayPaths(t *testing.T) {
+	tests := map[string]struct {
+		JSONArrayPaths    []string
+		ContentType       string
+		Body              string
+		ExpectedClientIDs []string
+		ExpectedMessages  []string
+		ExpectedError     error
+	}{
+		"should return every string element in order": {
+			JSONArrayPaths:    []string{"client_ids"},
+			ContentType:       jsonContentType,
+			Body:              `{"client_ids":["robbie-a","robbie-b","robbie-c"]}`,
+			ExpectedClientIDs: []string{"robbie-a", "robbie-b", "robbie-c"},
+		},
+		"should skip elements of a mixed-type array with a warning": {
+			JSONArrayPaths:    []string{"client_ids"},
+			ContentType:       jsonContentType,
+			Body:              `{"client_ids":["robbie-a",42,null,"",{"id":"robbie-x"},"robbie-b",true]}`,
+			ExpectedClientIDs: []string{"robbie-a", "robbie-b"},
+			ExpectedMessages: []string{
+				`level=WARN msg="restplay: skipped JSON array element that is no string" path=client_ids index=1 type=number`,
+				`level=WARN msg="restplay: skipped JSON array element that is no string" path=client_ids index=2 type=null`,
+				`level=WARN msg="restplay: skipped JSON array element that is no string" path=client_ids index=4 type=object`,
+				`level=WARN msg="restplay: skipped JSON array element that is no string" path=client_ids index=6 type=boolean`,
+			},
+		},
+		"should follow nested paths after the top-level client_id without duplicates": {
+			JSONArrayPaths:    []string{"batch.client_ids", "more"},
+			ContentType:       jsonContentType,
+			Body:              `{"client_id":"robbie-a","batch":{"client_ids":["robbie-a","robbie-b"]},"more":["robbie-c"]}`,
+			ExpectedClientIDs: []string{"robbie-a", "robbie-b", "robbie-c"},
+		},
+		"should ignore a path that holds no array": {
+			JSONArrayPaths: []string{"client_ids"},
+			ContentType:    jsonContentType,
+			Body:           `{"client_ids":"robbie-a"}`,
+			ExpectedError:  ErrMissingClientID,
+		},
+		"should not consult arrays without JSONArrayPaths": {
+			ContentType:   jsonContentType,
+			Body:          `{"client_ids":["robbie-a"]}`,
+			ExpectedError: ErrMissingClientID,
+		},
+		"should not consult arrays in form bodies": {
+			JSONArrayPaths: []string{"client_ids"},
+			ContentType:    formContentType,
+			Body:           `client_ids=robbie-a`,
+			ExpectedError:  ErrMissingClientID,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "https://example.com", strings.NewReader(tc.Body))
+			if err != nil {
+				t.Fatalf("failed to create request for test: %s", err)
+			}
+			req.Header.Set(contentTypeHeaderKey, tc.ContentType)
+
+			var buf bytes.Buffer
+			handler := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+				ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+					// drop the timestamp so records compare exactly
+					if a.Key == slog.TimeKey {
+						return slog.Attr{}
+					}
+					return a
+				},
+			})
+			e := &Extractor{JSONArrayPaths: tc.JSONArrayPaths, Logger: slog.New(handler)}
+			clientIDs, req, err := e.ExtractAll(req)
+			if !errors.Is(err, tc.ExpectedError) {
+				t.Errorf("ExtractAll() error = %v, want %v", err, tc.ExpectedError)
+			}
+			if !slices.Equal(clientIDs, tc.ExpectedClientIDs) {
+				t.Errorf("ExtractAll() got = %q, want %q", clientIDs, tc.ExpectedClientIDs)
+			}
+
+			var messages []string
+			if out := strings.TrimSpace(buf.String()); out != "" {
+				messages = strings.Split(out, "\n")
+			}
+			if !slices.Equal(messages, tc.ExpectedMessages) {
+				t.Errorf("Logged records:\n  %s\nwant:\n  %s", strings.Join(messages, "\n  "), strings.Join(tc.ExpectedMessages, "\n  "))
+			}
+
+			afterBody, err := io.ReadAll(req.Body)
+			if err != nil {
+				t.Fatalf("Unable to read request body after ExtractAll(): %s", err)
+			}
+			if string(afterBody) != tc.Body {
+				t.Errorf("ExtractAll() left body = %q, want %q", afterBody, tc.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package restplay
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// basicAndBearerCredentials returns the credentials consulted for basic auth and bearer tokens: those of the
+// Authorization headers of h and, if IncludeProxyAuthorization is set and none of them is basic or bearer,
+// those of the Proxy-Authorization headers
+func (e *Extractor) basicAndBearerCredentials(h http.Header) []string {
+	credentials := authorizationValues(h, "Authorization")
+	if !e.IncludeProxyAuthorization || slices.ContainsFunc(credentials, e.isBasicOrBearer) {
+		return credentials
+	}
+	return append(credentials, authorizationValues(h, "Proxy-Authorization")...)
+}
+
+// isBasicOrBearer reports whether auth is a basic-auth credential or has one of the bearer schemes
+func (e *Extractor) isBasicOrBearer(auth string) bool {
+	scheme, _, _ := strings.Cut(auth, " ")
+	_, bearer := e.bearerToken(auth)
+	return strings.EqualFold(scheme, "Basic") || bearer
+}
+
+// authorizationValues returns every credential in the key headers of h, e.g. Authorization. Proxies
+// occasionally merge duplicate headers into one comma-separated value, so each value is split back into its
+// credentials, taking care not to split the comma-separated auth-params of schemes like Digest.
+func authorizationValues(h http.Header, key string) []string {
+	var credentials []string
+	for _, value := range h.Values(key) {
+		start := len(credentials)
+		for _, part := range splitOutsideQuotes(value, ',') {
+			part = strings.TrimLeft(part, " \t")
+			if len(credentials) == start || startsCredential(part) {
+				credentials = append(credentials, part)
+				continue
+			}
+			// an auth-param belonging to the credential before it
+			credentials[len(credentials)-1] += ", " + part
+		}
+	}
+	return credentials
+}
+
+// startsCredential reports whether s begins with an auth-scheme followed by its credentials, e.g. "Bearer abc",
+// rather than being an auth-param like `realm="example"`
+func startsCredential(s string) bool {
+	scheme, _, ok := strings.Cut(s, " ")
+	return ok && scheme != "" && !strings.Contains(scheme, "=")
+}
+
+// token68 returns the token68 that credentials start with per RFC 7235, e.g. "abc" of `abc, realm="example"`,
+// dropping the auth-params that some clients append. It is empty if credentials only hold auth-params.
+func token68(credentials string) string {
+	parts := splitOutsideQuotes(credentials, ',')
+	if isAuthParam(parts[0]) {
+		return ""
+	}
+	token := parts[0]
+	for _, part := range parts[1:] {
+		if isAuthParam(part) {
+			break
+		}
+		// not an auth-param, so the comma belongs to the token, e.g. as the LegacyTokenSeparator
+		token += "," + part
+	}
+	return strings.TrimSpace(token)
+}
+
+// isAuthParam reports whether s is an auth-param like `realm="example"`, as opposed to a token68 that merely ends
+// in "=" padding
+func isAuthParam(s string) bool {
+	name, value, ok := strings.Cut(strings.TrimSpace(s), "=")
+	return ok && name != "" && !strings.ContainsAny(name, " \t\"") && value != "" && value[0] != '='
+}
+
+// splitOutsideQuotes splits s at every sep that is not inside a quoted string
+func splitOutsideQuotes(s string, sep byte) []string {
+	var (
+		parts  []string
+		quoted bool
+		start  int
+	)
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			// skip the escaped character of a quoted-pair
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
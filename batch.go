@@ -0,0 +1,30 @@
+package restplay
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// GetClientIDs extracts the client_id of every request, e.g. when replaying or auditing captured traffic.
+// Each request gets a Result, whose Err records why that request had no client_id. The returned error only
+// reports requests that could not be inspected at all, such as nil entries.
+func GetClientIDs(reqs []*http.Request) ([]Result, error) {
+	return defaultExtractor.ExtractBatch(reqs)
+}
+
+// ExtractBatch behaves like GetClientIDs, but extracts with e. Every request is handled by the same Extractor,
+// so a configured TokenCache is shared across the batch.
+func (e *Extractor) ExtractBatch(reqs []*http.Request) ([]Result, error) {
+	var (
+		results = make([]Result, len(reqs))
+		fatal   []error
+	)
+	for i, req := range reqs {
+		results[i], _ = e.ExtractResult(req)
+		if errors.Is(results[i].Err, ErrNilRequest) {
+			fatal = append(fatal, fmt.Errorf("restplay: request %d: %w", i, results[i].Err))
+		}
+	}
+	return results, errors.Join(fatal...)
+}
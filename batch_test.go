@@ -0,0 +1,89 @@
+package restplay
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGetClientIDs(t *testing.T) {
+	newRequest := func(method, url, body, authorization string) *http.Request {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("failed to create request for test: %s", err)
+		}
+		req.Header.Set(contentTypeHeaderKey, formContentType)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		return req
+	}
+	reqs := []*http.Request{
+		newRequest(http.MethodGet, "https://example.com?client_id=robbie-query", "", ""),
+		newRequest(http.MethodGet, "https://example.com", "", ""),
+		newRequest(http.MethodPost, "https://example.com", "client_id=robbie-body", ""),
+		newRequest(http.MethodGet, "https://example.com", "", "Bearer nodots"),
+		nil,
+		newRequest(http.MethodGet, "https://example.com", "", "Bearer robbie-bearer.othertokenstuffhere"),
+	}
+	expected := []struct {
+		ClientID string
+		Source   ClientIDSource
+		Err      error
+	}{
+		{ClientID: "robbie-query", Source: SourceURLQuery},
+		{Source: SourceNone, Err: ErrMissingClientID},
+		{ClientID: "robbie-body", Source: SourceRequestBody},
+		{Source: SourceNone, Err: ErrInvalidBearerToken},
+		{Source: SourceNone, Err: ErrNilRequest},
+		{ClientID: "robbie-bearer", Source: SourceBearerToken},
+	}
+
+	results, err := GetClientIDs(reqs)
+	if !errors.Is(err, ErrNilRequest) || !strings.Contains(err.Error(), "request 4") {
+		t.Errorf("Expected an error reporting the nil request 4 but got: %v", err)
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("GetClientIDs() returned %d results, want %d", len(results), len(expected))
+	}
+	for i, res := range results {
+		if res.ClientID != expected[i].ClientID {
+			t.Errorf("results[%d].ClientID = %q, want %q", i, res.ClientID, expected[i].ClientID)
+		}
+		if res.Source != expected[i].Source {
+			t.Errorf("results[%d].Source = %s, want %s", i, res.Source, expected[i].Source)
+		}
+		if !errors.Is(res.Err, expected[i].Err) {
+			t.Errorf("results[%d].Err = %v, want %v", i, res.Err, expected[i].Err)
+		}
+	}
+}
+
+func TestExtractorExtractBatchSharesTokenCache(t *testing.T) {
+	verifier := &countingVerifier{claims: map[string]any{"client_id": "robbie-cached"}}
+	e := &Extractor{Verifier: verifier, TokenCache: NewLRUTokenCache(10, 0)}
+
+	reqs := make([]*http.Request, 3)
+	for i := range reqs {
+		req, err := http.NewRequest(http.MethodGet, "https://example.com", nil)
+		if err != nil {
+			t.Fatalf("failed to create request for test: %s", err)
+		}
+		req.Header.Set("Authorization", "Bearer opaque-token")
+		reqs[i] = req
+	}
+
+	results, err := e.ExtractBatch(reqs)
+	if err != nil {
+		t.Fatalf("No error expected but got: %q", err)
+	}
+	for i, res := range results {
+		if res.ClientID != "robbie-cached" || res.Err != nil {
+			t.Errorf("results[%d] = %q, %v, want %q without error", i, res.ClientID, res.Err, "robbie-cached")
+		}
+	}
+	if verifier.calls != 1 {
+		t.Errorf("Verify() called %d times, want 1", verifier.calls)
+	}
+}
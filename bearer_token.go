@@ -0,0 +1,28 @@
+package restplay
+
+import (
+	"net/http"
+	"strings"
+)
+
+// GetBearerToken returns the raw bearer token of the Authorization header of req, without parsing it, e.g. for a
+// gateway to forward upstream along with the client_id. It reports false if req carries no bearer token.
+func GetBearerToken(req *http.Request) (string, bool) {
+	return defaultExtractor.BearerToken(req)
+}
+
+// BearerToken behaves like GetBearerToken, but recognizes the BearerSchemes of e, and also reads the
+// Proxy-Authorization header if IncludeProxyAuthorization is set. Tokens passed in the URL or body are ignored.
+func (e *Extractor) BearerToken(req *http.Request) (string, bool) {
+	if req == nil {
+		return "", false
+	}
+	for _, auth := range e.basicAndBearerCredentials(req.Header) {
+		if token, ok := e.bearerToken(auth); ok {
+			if token = strings.TrimSpace(token); token != "" {
+				return token, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,207 @@
+package restplay
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// parseFormBody runs parseForm against the request body, leaving req.Body re-readable with the original bytes.
+// Seekable bodies are parsed in place and rewound, while any other body is buffered into memory first.
+// Compressed bodies are always buffered, and parseForm is handed the decompressed bytes. It reports whether the
+// body was buffered, which reads it to its end.
+func (e *Extractor) parseFormBody(ctx context.Context, req *http.Request, parseForm func() error) (bool, error) {
+	encoding, _ := contentEncoding(req)
+	if seeker, ok := req.Body.(io.ReadSeeker); ok && encoding == "" {
+		return false, e.parseSeekableFormBody(ctx, req, seeker, parseForm)
+	}
+
+	// here is the only case where we will need to copy the whole request body; whichever way this returns,
+	// req.Body is left yielding the original bytes
+	bodyBytes, reset, err := bufferBody(ctx, req, e.MaxBodyBytes)
+	if err != nil {
+		return false, err
+	}
+	if e.MaxBodyBytes > 0 && int64(len(bodyBytes)) > e.MaxBodyBytes {
+		return false, fmt.Errorf("%w: form body exceeds %d bytes", ErrBodyTooLarge, e.MaxBodyBytes)
+	}
+	decoded, err := e.decodeBody(encoding, bodyBytes)
+	if err != nil {
+		return false, err
+	}
+	// ParseForm() reads from req.Body, so hand it a copy of the decoded bytes, then put back the original ones
+	req.Body = io.NopCloser(bytes.NewReader(decoded))
+	defer reset()
+	if err = parseForm(); err != nil {
+		return false, fmt.Errorf("restplay: failed to parse request form from body: %w", err)
+	}
+	return true, nil
+}
+
+// BufferBody reads the whole body of req into memory and replaces it with a copy yielding the same bytes.
+// Calling reset rewinds req.Body to the start of those bytes, so the body can be consumed by any number of
+// operations as long as reset is called after each. Once the length of a chunked body is known, it is set as
+// the ContentLength. If reading fails midway, the error is a *BodyReadError and req.Body yields the bytes read
+// before the failure followed by the unread remainder.
+func BufferBody(req *http.Request) (reset func(), err error) {
+	if req == nil {
+		return nil, ErrNilRequest
+	}
+	_, reset, err = bufferBody(context.Background(), req, 0)
+	return reset, err
+}
+
+// bufferBody implements BufferBody, bounding the read by ctx and, if limit is positive, reading no more than one
+// byte beyond limit, which is enough to tell that it was exceeded. It returns the bytes read, and whichever way
+// it returns, req.Body is left yielding them followed by the unread remainder.
+func bufferBody(ctx context.Context, req *http.Request, limit int64) ([]byte, func(), error) {
+	body := req.Body
+	if body == nil || body == http.NoBody {
+		return nil, func() { req.Body = body }, nil
+	}
+
+	var r io.Reader = body
+	if limit > 0 {
+		r = io.LimitReader(body, limit+1)
+	}
+	bodyBytes, err := io.ReadAll(&contextReader{ctx: ctx, r: r})
+	reset := func() {
+		req.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(bodyBytes), body), Closer: body}
+	}
+	reset()
+	if err != nil {
+		return bodyBytes, reset, &BodyReadError{BytesRead: int64(len(bodyBytes)), Err: err}
+	}
+	if limit <= 0 || int64(len(bodyBytes)) <= limit {
+		// the whole body is buffered now, so a chunked body's length is finally known
+		req.ContentLength = int64(len(bodyBytes))
+		req.TransferEncoding = nil
+	}
+	return bodyBytes, reset, nil
+}
+
+// parseSeekableFormBody parses the form straight from a seekable body, then seeks back to where it started,
+// so the body never has to be buffered and req.Body keeps its original identity.
+func (e *Extractor) parseSeekableFormBody(ctx context.Context, req *http.Request, seeker io.ReadSeeker, parseForm func() error) error {
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("restplay: failed to seek request body: %w", err)
+	}
+	if e.MaxBodyBytes > 0 {
+		// the size of a seekable body is known up front, so an oversized body is never read at all
+		end, err := seeker.Seek(0, io.SeekEnd)
+		if err != nil {
+			return fmt.Errorf("restplay: failed to seek request body: %w", err)
+		}
+		if _, err = seeker.Seek(start, io.SeekStart); err != nil {
+			return fmt.Errorf("restplay: failed to seek request body: %w", err)
+		}
+		if end-start > e.MaxBodyBytes {
+			return fmt.Errorf("%w: form body exceeds %d bytes", ErrBodyTooLarge, e.MaxBodyBytes)
+		}
+	}
+
+	// bound the parse by ctx, then put the original body back in place
+	body := req.Body
+	req.Body = readCloser{Reader: &contextReader{ctx: ctx, r: body}, Closer: body}
+	parseErr := parseForm()
+	req.Body = body
+	if _, err = seeker.Seek(start, io.SeekStart); err != nil {
+		return fmt.Errorf("restplay: failed to reset request body: %w", err)
+	}
+	if parseErr != nil {
+		return fmt.Errorf("restplay: failed to parse request form from body: %w", parseErr)
+	}
+	return nil
+}
+
+// contentEncoding returns the lowercased Content-Encoding of req, with "identity" reported as none, and whether
+// the body can be decoded
+func contentEncoding(req *http.Request) (string, bool) {
+	switch encoding := strings.ToLower(strings.TrimSpace(req.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+		return "", true
+	case "gzip", "x-gzip", "deflate":
+		return encoding, true
+	default:
+		return encoding, false
+	}
+}
+
+// decodeBody decompresses body according to encoding. The decompressed size is limited to MaxBodyBytes, or
+// DefaultMaxBodyBytes if that is unlimited, so that a small compressed body cannot expand without bound.
+func (e *Extractor) decodeBody(encoding string, body []byte) ([]byte, error) {
+	var (
+		r   io.Reader
+		err error
+	)
+	switch encoding {
+	case "":
+		return body, nil
+	case "gzip", "x-gzip":
+		r, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		// HTTP's deflate is the zlib format
+		r, err = zlib.NewReader(bytes.NewReader(body))
+	default:
+		err = fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("restplay: failed to decode request body: %w", err)
+	}
+
+	limit := e.MaxBodyBytes
+	if limit <= 0 {
+		limit = DefaultMaxBodyBytes
+	}
+	decoded, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("restplay: failed to decode request body: %w", err)
+	}
+	if int64(len(decoded)) > limit {
+		return nil, fmt.Errorf("%w: decompressed form body exceeds %d bytes", ErrBodyTooLarge, limit)
+	}
+	return decoded, nil
+}
+
+// parseURLEncodedBody parses a form-encoded body into req.PostForm, then lets ParseForm merge the URL query into
+// req.Form as it does for the methods whose body it reads itself
+func parseURLEncodedBody(req *http.Request) error {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	values, err := url.ParseQuery(string(body))
+	req.PostForm = values
+	if parseErr := req.ParseForm(); err == nil {
+		err = parseErr
+	}
+	return err
+}
+
+// readCloser pairs a reader with the Closer of the body it replaces
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// contextReader is an io.Reader that stops reading once its context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Read checks the context before every read from the underlying reader, so a cancelled
+// context stops a copy loop (like io.ReadAll) promptly
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
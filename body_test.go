@@ -0,0 +1,552 @@
+package restplay
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// seekableBody is a request body that supports seeking, like a replayed request or an *os.File
+type seekableBody struct {
+	*bytes.Reader
+	reads int
+}
+
+func (sb *seekableBody) Read(p []byte) (int, error) {
+	sb.reads++
+	return sb.Reader.Read(p)
+}
+
+func (sb *seekableBody) Close() error { return nil }
+
+func TestExtractorSeekableBody(t *testing.T) {
+	tests := map[string]struct {
+		Extractor        Extractor
+		Body             string
+		Seekable         bool
+		ExpectedClientID string
+		ExpectedErr      error
+		ExpectedErrorSub string
+	}{
+		"should parse a seekable body in place and rewind it": {
+			Body:             "client_id=robbie-seekable-client-id&other=stuff",
+			Seekable:         true,
+			ExpectedClientID: "robbie-seekable-client-id",
+		},
+		"should buffer a non-seekable body and reset it": {
+			Body:             "client_id=robbie-buffered-client-id&other=stuff",
+			ExpectedClientID: "robbie-buffered-client-id",
+		},
+		"should rewind a seekable body after a parse error": {
+			Body:             "client_id=%zz",
+			Seekable:         true,
+			ExpectedErrorSub: "failed to parse request form from body",
+		},
+		"should reject an oversized seekable body without reading it": {
+			Extractor:   Extractor{MaxBodyBytes: 8},
+			Body:        "client_id=robbie-too-big",
+			Seekable:    true,
+			ExpectedErr: ErrBodyTooLarge,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				seekable = &seekableBody{Reader: bytes.NewReader([]byte(tc.Body))}
+				body     io.Reader
+			)
+			if tc.Seekable {
+				body = seekable
+			} else {
+				body = strings.NewReader(tc.Body)
+			}
+			req, err := http.NewRequest(http.MethodPost, "https://example.com", body)
+			if err != nil {
+				t.Fatalf("failed to create request for test: %s", err)
+			}
+			if tc.Seekable {
+				// NewRequest only keeps the body as-is when it is already a ReadCloser
+				req.Body = seekable
+			}
+			req.Header.Set(contentTypeHeaderKey, formContentType)
+
+			clientID, req, err := tc.Extractor.Extract(req)
+			switch {
+			case tc.ExpectedErr != nil:
+				if !errors.Is(err, tc.ExpectedErr) {
+					t.Errorf("Expected error to match %v but got: %v", tc.ExpectedErr, err)
+				}
+			case tc.ExpectedErrorSub != "":
+				if err == nil || !strings.Contains(err.Error(), tc.ExpectedErrorSub) {
+					t.Errorf("Expected an error that contained: %q but got: %v", tc.ExpectedErrorSub, err)
+				}
+			case err != nil:
+				t.Errorf("No error expected but got: %q", err)
+			}
+			if clientID != tc.ExpectedClientID {
+				t.Errorf("Extract() got = %q, want %q", clientID, tc.ExpectedClientID)
+			}
+			if tc.Seekable {
+				if req.Body != seekable {
+					t.Errorf("Expected the seekable body to be kept in place but got %T", req.Body)
+				}
+				if tc.ExpectedErr != nil && seekable.reads != 0 {
+					t.Errorf("Expected the oversized body to never be read but got %d reads", seekable.reads)
+				}
+			}
+			afterBody, err := io.ReadAll(req.Body)
+			if err != nil {
+				t.Fatalf("Unable to read request body after Extract(): %s", err)
+			}
+			if string(afterBody) != tc.Body {
+				t.Errorf("Request body changed:\n  Original: %q\n  After:   %q", tc.Body, afterBody)
+			}
+		})
+	}
+}
+
+func TestExtractorBufferedBodyReset(t *testing.T) {
+	tests := map[string]struct {
+		Body             string
+		MaxBodyBytes     int64
+		ExpectedClientID string
+		ExpectedErr      error
+		ExpectedErrorSub string
+	}{
+		"should restore the body after a successful parse": {
+			Body:             "client_id=robbie-buffered&other=stuff",
+			ExpectedClientID: "robbie-buffered",
+		},
+		"should restore the body after ParseForm fails on invalid percent-encoding": {
+			Body:             "other=stuff&client_id=robbie%zz-bad",
+			ExpectedErrorSub: "failed to parse request form from body",
+		},
+		"should restore the body after exceeding the limit": {
+			Body:         "client_id=robbie-too-long&" + strings.Repeat("x", 64),
+			MaxBodyBytes: 32,
+			ExpectedErr:  ErrBodyTooLarge,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "https://example.com", nil)
+			if err != nil {
+				t.Fatalf("failed to create request for test: %s", err)
+			}
+			// a plain io.ReadCloser forces the body to be buffered rather than seeked
+			req.Body = io.NopCloser(strings.NewReader(tc.Body))
+			req.Header.Set(contentTypeHeaderKey, formContentType)
+
+			e := &Extractor{MaxBodyBytes: tc.MaxBodyBytes}
+			clientID, req, err := e.Extract(req)
+			switch {
+			case tc.ExpectedErr != nil:
+				if !errors.Is(err, tc.ExpectedErr) {
+					t.Errorf("Expected error to match %v but got: %v", tc.ExpectedErr, err)
+				}
+			case tc.ExpectedErrorSub != "":
+				if err == nil || !strings.Contains(err.Error(), tc.ExpectedErrorSub) {
+					t.Errorf("Expected an error that contained: %q but got: %v", tc.ExpectedErrorSub, err)
+				}
+			case err != nil:
+				t.Errorf("No error expected but got: %q", err)
+			}
+			if clientID != tc.ExpectedClientID {
+				t.Errorf("Extract() got = %q, want %q", clientID, tc.ExpectedClientID)
+			}
+			afterBody, err := io.ReadAll(req.Body)
+			if err != nil {
+				t.Fatalf("Unable to read request body after Extract(): %s", err)
+			}
+			if string(afterBody) != tc.Body {
+				t.Errorf("Request body changed:\n  Original: %q\n  After:   %q", tc.Body, afterBody)
+			}
+		})
+	}
+}
+
+// streamingBody is a non-seekable body delivered in small chunks, like an HTTP/2 request body read off the wire
+func streamingBody(body string, chunkSize int) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		for len(body) > 0 {
+			n := min(chunkSize, len(body))
+			if _, err := io.WriteString(pw, body[:n]); err != nil {
+				return
+			}
+			body = body[n:]
+		}
+		pw.Close()
+	}()
+	return pr
+}
+
+func TestExtractorStreamingBody(t *testing.T) {
+	tests := map[string]struct {
+		ContentType      string
+		Body             string
+		ExpectedClientID string
+	}{
+		"should find client_id in a streamed form body": {
+			ContentType:      formContentType,
+			Body:             "other=" + strings.Repeat("x", 100) + "&client_id=robbie-h2-form",
+			ExpectedClientID: "robbie-h2-form",
+		},
+		"should find client_id in a streamed JSON body": {
+			ContentType:      jsonContentType,
+			Body:             `{"client_id":"robbie-h2-json","other":"` + strings.Repeat("x", 100) + `"}`,
+			ExpectedClientID: "robbie-h2-json",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "https://example.com", nil)
+			if err != nil {
+				t.Fatalf("failed to create request for test: %s", err)
+			}
+			req.Proto, req.ProtoMajor, req.ProtoMinor = "HTTP/2.0", 2, 0
+			req.Body = streamingBody(tc.Body, 7)
+			// HTTP/2 requests need not declare their length up front
+			req.ContentLength = -1
+			req.Header.Set(contentTypeHeaderKey, tc.ContentType)
+
+			clientID, req, err := GetClientID(req)
+			if err != nil {
+				t.Errorf("No error expected but got: %q", err)
+			}
+			if clientID != tc.ExpectedClientID {
+				t.Errorf("GetClientID() got = %q, want %q", clientID, tc.ExpectedClientID)
+			}
+			afterBody, err := io.ReadAll(req.Body)
+			if err != nil {
+				t.Fatalf("Unable to read request body after GetClientID(): %s", err)
+			}
+			if string(afterBody) != tc.Body {
+				t.Errorf("Request body changed:\n  Original: %q\n  After:   %q", tc.Body, afterBody)
+			}
+		})
+	}
+}
+
+func TestGetClientIDOverHTTP2(t *testing.T) {
+	const body = "client_id=robbie-h2&other=stuff"
+	var (
+		proto     int
+		clientID  string
+		afterBody []byte
+		err       error
+	)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proto = r.ProtoMajor
+		if clientID, r, err = GetClientID(r); err == nil {
+			afterBody, err = io.ReadAll(r.Body)
+		}
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	req, reqErr := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(body))
+	if reqErr != nil {
+		t.Fatalf("failed to create request for test: %s", reqErr)
+	}
+	req.Header.Set(contentTypeHeaderKey, formContentType)
+	resp, reqErr := server.Client().Do(req)
+	if reqErr != nil {
+		t.Fatalf("failed to send request for test: %s", reqErr)
+	}
+	resp.Body.Close()
+
+	if proto != 2 {
+		t.Fatalf("Expected the request to arrive over HTTP/2 but got HTTP/%d", proto)
+	}
+	if err != nil {
+		t.Errorf("No error expected but got: %q", err)
+	}
+	if clientID != "robbie-h2" {
+		t.Errorf("GetClientID() got = %q, want %q", clientID, "robbie-h2")
+	}
+	if string(afterBody) != body {
+		t.Errorf("Request body changed:\n  Original: %q\n  After:   %q", body, afterBody)
+	}
+}
+
+var errConnReset = errors.New("connection reset by peer")
+
+// failingBody yields body and then fails with errConnReset, like a client that went away midstream
+func failingBody(body string) io.ReadCloser {
+	return io.NopCloser(io.MultiReader(strings.NewReader(body), iotest.ErrReader(errConnReset)))
+}
+
+func TestExtractorBodyReadError(t *testing.T) {
+	tests := map[string]struct {
+		ContentType string
+		Body        string
+	}{
+		"should report how much of a form body was read": {
+			ContentType: formContentType,
+			Body:        "other=stuff&client_id=robbie-",
+		},
+		"should report how much of a JSON body was read": {
+			ContentType: jsonContentType,
+			Body:        `{"other":"stuff","client_id":"robbie-`,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "https://example.com", nil)
+			if err != nil {
+				t.Fatalf("failed to create request for test: %s", err)
+			}
+			req.Body = failingBody(tc.Body)
+			req.ContentLength = -1
+			req.Header.Set(contentTypeHeaderKey, tc.ContentType)
+
+			_, req, err = GetClientID(req)
+			var readErr *BodyReadError
+			if !errors.As(err, &readErr) {
+				t.Fatalf("Expected a *BodyReadError but got: %v", err)
+			}
+			if readErr.BytesRead != int64(len(tc.Body)) {
+				t.Errorf("BytesRead got = %d, want %d", readErr.BytesRead, len(tc.Body))
+			}
+			if !errors.Is(err, errConnReset) {
+				t.Errorf("Expected errors.Is(err, errConnReset) but got: %v", err)
+			}
+			// the partial body is put back in front of the failed remainder
+			afterBody, err := io.ReadAll(req.Body)
+			if string(afterBody) != tc.Body {
+				t.Errorf("Request body changed:\n  Original: %q\n  After:   %q", tc.Body, afterBody)
+			}
+			if !errors.Is(err, errConnReset) {
+				t.Errorf("Expected re-reading the body to fail with errConnReset but got: %v", err)
+			}
+		})
+	}
+}
+
+func TestExtractorChunkedFormBody(t *testing.T) {
+	const body = "other=stuff&client_id=robbie-chunked"
+	raw := "POST /token HTTP/1.1\r\n" +
+		"Host: example.com\r\n" +
+		"Content-Type: " + formContentType + "\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n" +
+		"b\r\n" + body[:11] + "\r\n" +
+		"19\r\n" + body[11:] + "\r\n" +
+		"0\r\n\r\n"
+	req, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+	if err != nil {
+		t.Fatalf("failed to read chunked request for test: %s", err)
+	}
+	if req.ContentLength != -1 || len(req.TransferEncoding) == 0 {
+		t.Fatalf("Expected a chunked request of unknown length but got ContentLength %d and TransferEncoding %q",
+			req.ContentLength, req.TransferEncoding)
+	}
+
+	clientID, req, err := GetClientID(req)
+	if err != nil {
+		t.Errorf("No error expected but got: %q", err)
+	}
+	if clientID != "robbie-chunked" {
+		t.Errorf("GetClientID() got = %q, want %q", clientID, "robbie-chunked")
+	}
+	if req.ContentLength != int64(len(body)) {
+		t.Errorf("ContentLength got = %d, want %d", req.ContentLength, len(body))
+	}
+	if len(req.TransferEncoding) != 0 {
+		t.Errorf("TransferEncoding got = %q, want none", req.TransferEncoding)
+	}
+	afterBody, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatalf("Unable to read request body after GetClientID(): %s", err)
+	}
+	if string(afterBody) != body {
+		t.Errorf("Request body changed:\n  Original: %q\n  After:   %q", body, afterBody)
+	}
+}
+
+func TestExtractorCompressedFormBody(t *testing.T) {
+	compress := func(t *testing.T, encoding, body string) []byte {
+		t.Helper()
+		var (
+			buf bytes.Buffer
+			w   io.WriteCloser
+		)
+		switch encoding {
+		case "gzip":
+			w = gzip.NewWriter(&buf)
+		case "deflate":
+			w = zlib.NewWriter(&buf)
+		default:
+			return []byte(body)
+		}
+		if _, err := io.WriteString(w, body); err != nil {
+			t.Fatalf("failed to compress body for test: %s", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("failed to compress body for test: %s", err)
+		}
+		return buf.Bytes()
+	}
+
+	tests := map[string]struct {
+		Encoding         string
+		Body             string
+		Uncompressed     bool
+		MaxBodyBytes     int64
+		ExpectedClientID string
+		ExpectedErr      error
+		ExpectedErrorSub string
+	}{
+		"should find client_id in a gzipped form body": {
+			Encoding:         "gzip",
+			Body:             "other=stuff&client_id=robbie-gzip",
+			ExpectedClientID: "robbie-gzip",
+		},
+		"should find client_id in a deflated form body": {
+			Encoding:         "deflate",
+			Body:             "other=stuff&client_id=robbie-deflate",
+			ExpectedClientID: "robbie-deflate",
+		},
+		"should reject a body that decompresses beyond the limit": {
+			Encoding:     "gzip",
+			Body:         "client_id=robbie-bomb&padding=" + strings.Repeat("0", 4096),
+			MaxBodyBytes: 1024,
+			ExpectedErr:  ErrBodyTooLarge,
+		},
+		"should not read a body with an unsupported content encoding": {
+			Encoding:         "br",
+			Body:             "client_id=robbie-brotli",
+			ExpectedErrorSub: `content encoding "br" not supported`,
+		},
+		"should return error for a body that is not actually gzipped": {
+			Encoding:         "gzip",
+			Uncompressed:     true,
+			Body:             "client_id=robbie-plain",
+			ExpectedErrorSub: "failed to decode request body",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			compressed := []byte(tc.Body)
+			if !tc.Uncompressed {
+				compressed = compress(t, tc.Encoding, tc.Body)
+			}
+			req, err := http.NewRequest(http.MethodPost, "https://example.com", bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatalf("failed to create request for test: %s", err)
+			}
+			req.Header.Set(contentTypeHeaderKey, formContentType)
+			req.Header.Set("Content-Encoding", tc.Encoding)
+
+			e := &Extractor{Sources: []ClientIDSource{SourceRequestBody}, MaxBodyBytes: tc.MaxBodyBytes}
+			clientID, req, err := e.Extract(req)
+			switch {
+			case tc.ExpectedErr != nil:
+				if !errors.Is(err, tc.ExpectedErr) {
+					t.Errorf("Extract() error = %v, want %v", err, tc.ExpectedErr)
+				}
+			case tc.ExpectedErrorSub != "":
+				if err == nil || !strings.Contains(err.Error(), tc.ExpectedErrorSub) {
+					t.Errorf("Expected an error that contained: %q but got: %v", tc.ExpectedErrorSub, err)
+				}
+			case err != nil:
+				t.Errorf("No error expected but got: %q", err)
+			}
+			if clientID != tc.ExpectedClientID {
+				t.Errorf("Extract() got = %q, want %q", clientID, tc.ExpectedClientID)
+			}
+			// the compressed bytes are put back, not the decompressed ones
+			afterBody, err := io.ReadAll(req.Body)
+			if err != nil {
+				t.Fatalf("Unable to read request body after Extract(): %s", err)
+			}
+			if !bytes.Equal(afterBody, compressed) {
+				t.Errorf("Request body changed:\n  Original: %q\n  After:   %q", compressed, afterBody)
+			}
+		})
+	}
+}
+
+func TestBufferBody(t *testing.T) {
+	const body = "client_id=robbie-buffered&other=stuff"
+
+	tests := map[string]struct {
+		Body                  func() io.ReadCloser
+		ExpectedBody          string
+		ExpectedContentLength int64
+	}{
+		"should buffer an in-memory body": {
+			Body:                  func() io.ReadCloser { return io.NopCloser(strings.NewReader(body)) },
+			ExpectedBody:          body,
+			ExpectedContentLength: int64(len(body)),
+		},
+		"should buffer a streamed body of unknown length": {
+			Body:                  func() io.ReadCloser { return streamingBody(body, 5) },
+			ExpectedBody:          body,
+			ExpectedContentLength: int64(len(body)),
+		},
+		"should leave an absent body alone": {
+			Body: func() io.ReadCloser { return http.NoBody },
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "https://example.com", nil)
+			if err != nil {
+				t.Fatalf("failed to create request for test: %s", err)
+			}
+			req.Body = tc.Body()
+			req.ContentLength = -1
+
+			reset, err := BufferBody(req)
+			if err != nil {
+				t.Fatalf("No error expected but got: %q", err)
+			}
+			for i := range 2 {
+				got, err := io.ReadAll(req.Body)
+				if err != nil {
+					t.Fatalf("Unable to read request body the %d. time: %s", i+1, err)
+				}
+				if string(got) != tc.ExpectedBody {
+					t.Errorf("Read %d got = %q, want %q", i+1, got, tc.ExpectedBody)
+				}
+				reset()
+			}
+			if tc.ExpectedContentLength > 0 && req.ContentLength != tc.ExpectedContentLength {
+				t.Errorf("ContentLength got = %d, want %d", req.ContentLength, tc.ExpectedContentLength)
+			}
+		})
+	}
+}
+
+func TestBufferBodyErrors(t *testing.T) {
+	if _, err := BufferBody(nil); !errors.Is(err, ErrNilRequest) {
+		t.Errorf("Expected errors.Is(err, ErrNilRequest) but got: %v", err)
+	}
+
+	const partial = "client_id=robbie-"
+	req, err := http.NewRequest(http.MethodPost, "https://example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to create request for test: %s", err)
+	}
+	req.Body = failingBody(partial)
+	_, err = BufferBody(req)
+	var readErr *BodyReadError
+	if !errors.As(err, &readErr) || readErr.BytesRead != int64(len(partial)) {
+		t.Fatalf("Expected a *BodyReadError after %d bytes but got: %v", len(partial), err)
+	}
+	afterBody, err := io.ReadAll(req.Body)
+	if string(afterBody) != partial || !errors.Is(err, errConnReset) {
+		t.Errorf("Expected the partial body %q then errConnReset but got: %q, %v", partial, afterBody, err)
+	}
+}
@@ -0,0 +1,41 @@
+package restplay
+
+import (
+	"crypto/x509"
+	"net/http"
+	"strings"
+)
+
+// CertCommonName returns the Common Name of the certificate's subject
+func CertCommonName(cert *x509.Certificate) string {
+	return cert.Subject.CommonName
+}
+
+// CertURISAN returns a function that picks the first URI Subject Alternative Name starting with prefix,
+// e.g. "urn:example:client:", or the first URI SAN of any kind when prefix is empty
+func CertURISAN(prefix string) func(cert *x509.Certificate) string {
+	return func(cert *x509.Certificate) string {
+		for _, uri := range cert.URIs {
+			if s := uri.String(); strings.HasPrefix(s, prefix) {
+				return s
+			}
+		}
+		return ""
+	}
+}
+
+// fromClientCert maps the leaf of a verified client certificate chain to the client_id, or returns the reason
+// there is none. Certificates that were presented but not verified by the server are never trusted.
+func (e *Extractor) fromClientCert(req *http.Request) (string, string) {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.PeerCertificates) == 0 {
+		return "", "no verified client certificate"
+	}
+	field := e.ClientCertField
+	if field == nil {
+		field = CertCommonName
+	}
+	if clientID := field(req.TLS.PeerCertificates[0]); clientID != "" {
+		return clientID, ""
+	}
+	return "", "client certificate field empty"
+}
@@ -0,0 +1,84 @@
+package restplay
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestExtractorClientCert(t *testing.T) {
+	spiffeURI, _ := url.Parse("spiffe://example.com/workload")
+	clientURI, _ := url.Parse("urn:example:client:robbie-san-client-id")
+	cert := &x509.Certificate{
+		Subject: pkix.Name{CommonName: "robbie-cn-client-id"},
+		URIs:    []*url.URL{spiffeURI, clientURI},
+	}
+	verified := &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+
+	tests := map[string]struct {
+		Field            func(cert *x509.Certificate) string
+		TLS              *tls.ConnectionState
+		ExpectedClientID string
+		ExpectedReason   string
+	}{
+		"should use the Common Name by default": {
+			TLS:              verified,
+			ExpectedClientID: "robbie-cn-client-id",
+		},
+		"should use a URI SAN with the configured prefix": {
+			Field:            CertURISAN("urn:example:client:"),
+			TLS:              verified,
+			ExpectedClientID: "urn:example:client:robbie-san-client-id",
+		},
+		"should use a custom field func": {
+			Field:            func(cert *x509.Certificate) string { return "custom-" + cert.Subject.CommonName },
+			TLS:              verified,
+			ExpectedClientID: "custom-robbie-cn-client-id",
+		},
+		"should skip when the configured field is empty": {
+			Field:          CertURISAN("https://"),
+			TLS:            verified,
+			ExpectedReason: "client certificate field empty",
+		},
+		"should skip plaintext requests": {
+			ExpectedReason: "no verified client certificate",
+		},
+		"should skip certificates that were not verified": {
+			TLS:            &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}},
+			ExpectedReason: "no verified client certificate",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "https://example.com", nil)
+			if err != nil {
+				t.Fatalf("failed to create request for test: %s", err)
+			}
+			req.TLS = tc.TLS
+
+			e := &Extractor{Sources: []ClientIDSource{SourceClientCert}, ClientCertField: tc.Field}
+			res, err := e.ExtractResult(req)
+			if tc.ExpectedReason != "" {
+				var missing *MissingClientIDError
+				if !errors.As(err, &missing) || len(missing.Attempts) != 1 || missing.Attempts[0].Reason != tc.ExpectedReason {
+					t.Errorf("Expected a MissingClientIDError with reason %q but got: %v", tc.ExpectedReason, err)
+				}
+			} else if err != nil {
+				t.Errorf("No error expected but got: %q", err)
+			}
+			if res.ClientID != tc.ExpectedClientID {
+				t.Errorf("ExtractResult() ClientID = %q, want %q", res.ClientID, tc.ExpectedClientID)
+			}
+			if tc.ExpectedClientID != "" && res.Source != SourceClientCert {
+				t.Errorf("ExtractResult() Source = %s, want %s", res.Source, SourceClientCert)
+			}
+		})
+	}
+}
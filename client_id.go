@@ -0,0 +1,22 @@
+package restplay
+
+import "net/http"
+
+// ClientID is an extracted client_id. Being a distinct type, it cannot be confused with other strings.
+type ClientID string
+
+// IsEmpty reports whether no client_id is held
+func (c ClientID) IsEmpty() bool {
+	return c == ""
+}
+
+// String returns the client_id as a plain string
+func (c ClientID) String() string {
+	return string(c)
+}
+
+// GetClientIDTyped behaves like GetClientID, but returns the client_id as a ClientID
+func GetClientIDTyped(req *http.Request) (ClientID, *http.Request, error) {
+	clientID, req, err := GetClientID(req)
+	return ClientID(clientID), req, err
+}
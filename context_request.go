@@ -0,0 +1,34 @@
+package restplay
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// ContextWithRequest returns a copy of ctx carrying req, for handlers further down that only receive a context.
+// net/http itself never stores the request in its context, so middleware has to put it there.
+func ContextWithRequest(ctx context.Context, req *http.Request) context.Context {
+	return context.WithValue(ctx, requestContextKey, req)
+}
+
+// ClientIDFromRequestContext extracts the client_id from the *http.Request stored in ctx by ContextWithRequest,
+// using the default extraction rules
+func ClientIDFromRequestContext(ctx context.Context) (string, error) {
+	return defaultExtractor.ClientIDFromRequestContext(ctx)
+}
+
+// ClientIDFromRequestContext extracts the client_id from the *http.Request stored in ctx under RequestContextKey.
+// If no request is stored there, the error matches ErrNilRequest.
+func (e *Extractor) ClientIDFromRequestContext(ctx context.Context) (string, error) {
+	var key any = requestContextKey
+	if e.RequestContextKey != nil {
+		key = e.RequestContextKey
+	}
+	req, _ := ctx.Value(key).(*http.Request)
+	if req == nil {
+		return "", fmt.Errorf("%w: no *http.Request in context", ErrNilRequest)
+	}
+	clientID, _, err := e.ExtractContext(ctx, req)
+	return clientID, err
+}
@@ -0,0 +1,77 @@
+package restplay
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// otherContextKey stands in for the context key type of another middleware stack
+type otherContextKey struct{}
+
+func TestClientIDFromRequestContext(t *testing.T) {
+	tests := map[string]struct {
+		Extractor        *Extractor
+		Context          func(req *http.Request) context.Context
+		ExpectedClientID string
+		ExpectedErr      error
+	}{
+		"should extract from a request stored by ContextWithRequest": {
+			Context: func(req *http.Request) context.Context {
+				return ContextWithRequest(context.Background(), req)
+			},
+			ExpectedClientID: "robbie-context",
+		},
+		"should extract from a request stored under the configured key": {
+			Extractor: &Extractor{RequestContextKey: otherContextKey{}},
+			Context: func(req *http.Request) context.Context {
+				return context.WithValue(context.Background(), otherContextKey{}, req)
+			},
+			ExpectedClientID: "robbie-context",
+		},
+		"should not look under the default key when another is configured": {
+			Extractor: &Extractor{RequestContextKey: otherContextKey{}},
+			Context: func(req *http.Request) context.Context {
+				return ContextWithRequest(context.Background(), req)
+			},
+			ExpectedErr: ErrNilRequest,
+		},
+		"should fail for a context without a request": {
+			Context: func(*http.Request) context.Context {
+				return context.Background()
+			},
+			ExpectedErr: ErrNilRequest,
+		},
+		"should fail for a nil request stored in the context": {
+			Context: func(*http.Request) context.Context {
+				return ContextWithRequest(context.Background(), nil)
+			},
+			ExpectedErr: ErrNilRequest,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "https://example.com", strings.NewReader("client_id=robbie-context"))
+			if err != nil {
+				t.Fatalf("failed to create request for test: %s", err)
+			}
+			req.Header.Set(contentTypeHeaderKey, formContentType)
+
+			ctx := tc.Context(req)
+			var clientID string
+			if tc.Extractor != nil {
+				clientID, err = tc.Extractor.ClientIDFromRequestContext(ctx)
+			} else {
+				clientID, err = ClientIDFromRequestContext(ctx)
+			}
+			if !errors.Is(err, tc.ExpectedErr) {
+				t.Errorf("ClientIDFromRequestContext() error = %v, want %v", err, tc.ExpectedErr)
+			}
+			if clientID != tc.ExpectedClientID {
+				t.Errorf("ClientIDFromRequestContext() got = %q, want %q", clientID, tc.ExpectedClientID)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package restplay
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// credentialsPresent reports whether any of the sources carries credential material in the request, whether or
+// not it holds a usable client_id. It must only be called after the sources were consulted, so that the
+// request form has been parsed wherever it was allowed to be.
+func (e *Extractor) credentialsPresent(req *http.Request, sources []ClientIDSource) bool {
+	for _, source := range sources {
+		switch source {
+		case SourceBasicAuth, SourceBearerToken, SourceDigestAuth:
+			if req.Header.Get("Authorization") != "" {
+				return true
+			}
+			if source != SourceDigestAuth && e.IncludeProxyAuthorization && req.Header.Get("Proxy-Authorization") != "" {
+				return true
+			}
+			if source == SourceBearerToken && hasAnyKey(req.URL.Query(), e.tokenQueryKeys()) {
+				return true
+			}
+			if source == SourceBearerToken && hasAnyKey(req.PostForm, []string{accessTokenKey}) {
+				return true
+			}
+		case SourceHeader:
+			for _, key := range e.HeaderKeys {
+				if len(req.Header.Values(key)) > 0 {
+					return true
+				}
+			}
+		case SourceCookie:
+			for _, name := range e.CookieNames {
+				if _, err := req.Cookie(name); err == nil {
+					return true
+				}
+			}
+		case SourceDPoP:
+			if req.Header.Get("Authorization") != "" || req.Header.Get(dpopHeaderKey) != "" {
+				return true
+			}
+		case SourceXFCC:
+			if e.TrustXFCC && req.Header.Get(xfccHeaderKey) != "" {
+				return true
+			}
+		case SourceClientCert, SourceSPIFFE:
+			if req.TLS != nil && len(req.TLS.PeerCertificates) > 0 {
+				return true
+			}
+		case SourceURLQuery:
+			if e.hasFormKey(req.URL.Query()) {
+				return true
+			}
+		case SourceRequestBody:
+			if e.hasFormKey(req.PostForm) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasFormKey reports whether any configured form key is present in values, even without a value
+func (e *Extractor) hasFormKey(values url.Values) bool {
+	for _, key := range e.valuesKeys() {
+		for _, k := range e.matchingFormKeys(values, key) {
+			if _, ok := values[k]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasAnyKey reports whether any of keys is present in values, even without a value
+func hasAnyKey(values url.Values, keys []string) bool {
+	for _, key := range keys {
+		if _, ok := values[key]; ok {
+			return true
+		}
+	}
+	return false
+}
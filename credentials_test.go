@@ -0,0 +1,82 @@
+package restplay
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGetClientIDNoCredentials(t *testing.T) {
+	tests := map[string]struct {
+		Method                string
+		URL                   string
+		Body                  string
+		Authorization         string
+		ExpectedErr           error
+		ExpectedNoCredentials bool
+	}{
+		"should report no credentials for a bare GET": {
+			Method:                http.MethodGet,
+			URL:                   "https://example.com?other=stuff",
+			ExpectedErr:           ErrMissingClientID,
+			ExpectedNoCredentials: true,
+		},
+		"should report no credentials for a form POST without client_id": {
+			Method:                http.MethodPost,
+			URL:                   "https://example.com",
+			Body:                  "other=stuff",
+			ExpectedErr:           ErrMissingClientID,
+			ExpectedNoCredentials: true,
+		},
+		"should report an invalid token for a bearer token without a client_id": {
+			Method:        http.MethodGet,
+			URL:           "https://example.com",
+			Authorization: "Bearer " + makeUnsignedJWT(t, map[string]any{"scope": "read"}),
+			ExpectedErr:   ErrInvalidBearerToken,
+		},
+		"should report unusable credentials for basic auth with an empty username": {
+			Method:        http.MethodGet,
+			URL:           "https://example.com",
+			Authorization: "Basic OnNlY3JldA==",
+			ExpectedErr:   ErrMissingClientID,
+		},
+		"should report unusable credentials for an unrecognized Authorization scheme": {
+			Method:        http.MethodGet,
+			URL:           "https://example.com",
+			Authorization: "Token robbie-token",
+			ExpectedErr:   ErrMissingClientID,
+		},
+		"should report unusable credentials for an empty client_id in the URL": {
+			Method:      http.MethodGet,
+			URL:         "https://example.com?client_id=",
+			ExpectedErr: ErrMissingClientID,
+		},
+		"should report unusable credentials for an empty client_id in the body": {
+			Method:      http.MethodPost,
+			URL:         "https://example.com",
+			Body:        "client_id=",
+			ExpectedErr: ErrMissingClientID,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.Method, tc.URL, strings.NewReader(tc.Body))
+			if err != nil {
+				t.Fatalf("failed to create request for test: %s", err)
+			}
+			req.Header.Set(contentTypeHeaderKey, formContentType)
+			if tc.Authorization != "" {
+				req.Header.Set("Authorization", tc.Authorization)
+			}
+
+			_, _, err = GetClientID(req)
+			if !errors.Is(err, tc.ExpectedErr) {
+				t.Errorf("GetClientID() error = %v, want %v", err, tc.ExpectedErr)
+			}
+			if noCredentials := errors.Is(err, ErrNoCredentials); noCredentials != tc.ExpectedNoCredentials {
+				t.Errorf("errors.Is(err, ErrNoCredentials) = %t, want %t for error: %v", noCredentials, tc.ExpectedNoCredentials, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package restplay
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// debugResponse is the JSON document DebugHandler responds with
+type debugResponse struct {
+	ClientID   string `json:"client_id,omitempty"`
+	Source     string `json:"source,omitempty"`
+	MatchedKey string `json:"matched_key,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// DebugHandler returns a handler that responds with the client_id the default extraction rules resolve for each
+// request, see Extractor.DebugHandler
+func DebugHandler() http.Handler {
+	return defaultExtractor.DebugHandler()
+}
+
+// DebugHandler returns a handler that extracts the client_id from each request and responds with a JSON document
+// like {"client_id":"...","source":"header","matched_key":"X-Client-ID"}, or {"error":"..."} with a status code
+// matching the failure, e.g. 401 Unauthorized if there was no client_id. It is meant for debugging and integration
+// tests, and should only be mounted behind authentication outside of production, since error documents explain
+// why credentials were rejected.
+func (e *Extractor) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		res, err := e.ExtractResultContext(req.Context(), req)
+		status, doc := http.StatusOK, debugResponse{ClientID: res.ClientID, MatchedKey: res.MatchedKey}
+		if err != nil {
+			status, doc = debugStatus(err), debugResponse{Error: err.Error()}
+		} else {
+			doc.Source = res.Source.String()
+		}
+		w.Header().Set(contentTypeHeaderKey, jsonContentType)
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		// the status is already written, so there is nothing left to do about a client that went away
+		_ = json.NewEncoder(w).Encode(doc)
+	})
+}
+
+// debugStatus returns the status code DebugHandler responds with when extraction failed with err
+func debugStatus(err error) int {
+	var bodyErr *BodyReadError
+	switch {
+	case errors.Is(err, ErrBodyTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrMalformedQuery), errors.As(err, &bodyErr):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrVerifierUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ErrInsecureTransport), errors.Is(err, ErrInvalidClientID), errors.Is(err, ErrClientNotAllowed),
+		errors.Is(err, ErrInsufficientTrust):
+		return http.StatusForbidden
+	case errors.Is(err, ErrExtraction):
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
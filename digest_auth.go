@@ -0,0 +1,107 @@
+package restplay
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// digestScheme is the Authorization scheme of HTTP Digest authentication
+const digestScheme = "Digest"
+
+// fromDigestAuth returns the username directive of the first Digest Authorization credential per RFC 7616
+// that has one, or the reason there is none. Malformed headers are reported as a miss so the next source can
+// be consulted.
+func fromDigestAuth(req *http.Request) (string, string) {
+	reason := "digest auth absent"
+	for _, auth := range authorizationValues(req.Header, "Authorization") {
+		scheme, credentials, _ := strings.Cut(auth, " ")
+		if !strings.EqualFold(scheme, digestScheme) {
+			continue
+		}
+		username, miss := digestUsername(credentials)
+		if username != "" {
+			return username, ""
+		}
+		if reason == "digest auth absent" {
+			// the first Digest credential explains the miss best
+			reason = miss
+		}
+	}
+	return "", reason
+}
+
+// digestUsername returns the username directive of Digest credentials, or the reason there is none
+func digestUsername(credentials string) (string, string) {
+	params, ok := parseAuthParams(credentials)
+	if !ok {
+		return "", "digest auth malformed"
+	}
+	if strings.EqualFold(params["userhash"], "true") {
+		// a hashed username can only be resolved with the server's user table
+		return "", "digest auth username hashed"
+	}
+	if encoded, ok := params["username*"]; ok {
+		// RFC 8187 extended notation: charset'language'percent-encoded-value
+		parts := strings.SplitN(encoded, "'", 3)
+		if len(parts) != 3 || !strings.EqualFold(parts[0], "UTF-8") {
+			return "", "digest auth malformed"
+		}
+		username, err := url.PathUnescape(parts[2])
+		if err != nil {
+			return "", "digest auth malformed"
+		}
+		params["username"] = username
+	}
+	if params["username"] == "" {
+		return "", "digest auth username empty"
+	}
+	return params["username"], ""
+}
+
+// parseAuthParams parses a comma-separated list of RFC 7235 auth-params, whose values are either tokens or
+// quoted strings, into a map keyed by lowercase name. It reports false if the list is malformed.
+func parseAuthParams(s string) (map[string]string, bool) {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return params, len(params) > 0
+		}
+		name, rest, ok := strings.Cut(s, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || name == "" || strings.ContainsAny(name, " \t,\"") {
+			return nil, false
+		}
+		rest = strings.TrimLeft(rest, " \t")
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					// quoted-pair: the backslash escapes the next character
+					i++
+				}
+				b.WriteByte(rest[i])
+			}
+			if i >= len(rest) {
+				// unterminated quoted string
+				return nil, false
+			}
+			value, s = b.String(), rest[i+1:]
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end < 0 {
+				end = len(rest)
+			}
+			value, s = strings.TrimSpace(rest[:end]), rest[end:]
+		}
+		if rest := strings.TrimLeft(s, " \t"); rest != "" && rest[0] != ',' {
+			// anything after a value must be the next separator
+			return nil, false
+		}
+		params[name] = value
+	}
+}
@@ -0,0 +1,91 @@
+package restplay
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestGetClientIDDigestAuth(t *testing.T) {
+	tests := map[string]struct {
+		Authorization    string
+		URL              string
+		ExpectedClientID string
+		ExpectedSource   ClientIDSource
+		ExpectedReason   string
+	}{
+		"should find client_id in a well-formed digest header": {
+			Authorization:    `Digest username="robbie-digest", realm="api@example.com", uri="/resource", algorithm=SHA-256, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", nc=00000001, cnonce="f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ", qop=auth, response="753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"`,
+			URL:              "https://example.com?client_id=robbie-query",
+			ExpectedClientID: "robbie-digest",
+			ExpectedSource:   SourceDigestAuth,
+		},
+		"should match the digest scheme case-insensitively and unescape quoted pairs": {
+			Authorization:    `digest realm="api", username="robbie-\"quoted\""`,
+			ExpectedClientID: `robbie-"quoted"`,
+			ExpectedSource:   SourceDigestAuth,
+		},
+		"should decode an extended username": {
+			Authorization:    `Digest username*=UTF-8''robbie-%C3%A9t%C3%A9, realm="api"`,
+			ExpectedClientID: "robbie-été",
+			ExpectedSource:   SourceDigestAuth,
+		},
+		"should fall through a malformed digest header to the URL query": {
+			Authorization:    `Digest username="robbie-unterminated, realm="api`,
+			URL:              "https://example.com?client_id=robbie-query",
+			ExpectedClientID: "robbie-query",
+			ExpectedSource:   SourceURLQuery,
+		},
+		"should report a malformed digest header": {
+			Authorization:  `Digest username="robbie-unterminated`,
+			ExpectedReason: "digest auth malformed",
+		},
+		"should report a hashed username": {
+			Authorization:  `Digest username="488869477bf257147b804c45308cd62ac4e25eb717b12b298c79e62dcea254ec", userhash=true`,
+			ExpectedReason: "digest auth username hashed",
+		},
+		"should report a missing username": {
+			Authorization:  `Digest realm="api", nonce="abc"`,
+			ExpectedReason: "digest auth username empty",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			url := tc.URL
+			if url == "" {
+				url = "https://example.com"
+			}
+			req, err := http.NewRequest(http.MethodGet, url, nil)
+			if err != nil {
+				t.Fatalf("failed to create request for test: %s", err)
+			}
+			req.Header.Set("Authorization", tc.Authorization)
+
+			res, err := GetClientIDResult(req)
+			if tc.ExpectedReason != "" {
+				var missing *MissingClientIDError
+				if !errors.As(err, &missing) || !hasAttempt(missing, SourceDigestAuth, tc.ExpectedReason) {
+					t.Errorf("Expected a MissingClientIDError with reason %q but got: %v", tc.ExpectedReason, err)
+				}
+			} else if err != nil {
+				t.Errorf("No error expected but got: %q", err)
+			}
+			if res.ClientID != tc.ExpectedClientID {
+				t.Errorf("GetClientIDResult() ClientID = %q, want %q", res.ClientID, tc.ExpectedClientID)
+			}
+			if res.Source != tc.ExpectedSource {
+				t.Errorf("GetClientIDResult() Source = %s, want %s", res.Source, tc.ExpectedSource)
+			}
+		})
+	}
+}
+
+// hasAttempt reports whether the error recorded the given reason for source
+func hasAttempt(missing *MissingClientIDError, source ClientIDSource, reason string) bool {
+	for _, attempt := range missing.Attempts {
+		if attempt.Source == source && attempt.Reason == reason {
+			return true
+		}
+	}
+	return false
+}
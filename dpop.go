@@ -0,0 +1,271 @@
+package restplay
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultDPoPMaxAge is how old a DPoP proof may be when an Extractor configures no DPoPMaxAge
+const DefaultDPoPMaxAge = 5 * time.Minute
+
+const (
+	dpopScheme    = "DPoP"
+	dpopHeaderKey = "DPoP"
+	dpopProofType = "dpop+jwt"
+)
+
+// fromDPoP returns the client_id of a DPoP-bound access token (RFC 9449), or the reason there is none. The
+// token's client_id is only trusted once the Verifier accepted the token and the DPoP proof is shown to be made
+// for this request and token, and signed by the key whose thumbprint the token's "cnf.jkt" claim is bound to.
+// Without a Verifier the source is skipped, since anyone can mint an unsigned token bound to a key of their own.
+func (e *Extractor) fromDPoP(ctx context.Context, req *http.Request) (string, string, error) {
+	var token string
+	for _, auth := range authorizationValues(req.Header, "Authorization") {
+		if scheme, credentials, ok := strings.Cut(auth, " "); ok && strings.EqualFold(scheme, dpopScheme) {
+			token = token68(credentials)
+			break
+		}
+	}
+	if token == "" {
+		return "", "DPoP token absent", nil
+	}
+	if e.Verifier == nil {
+		return "", "DPoP token not verified without a Verifier", nil
+	}
+	proofs := req.Header.Values(dpopHeaderKey)
+	if len(proofs) != 1 {
+		return "", "", fmt.Errorf("%w: expected 1 DPoP proof but found %d", ErrInvalidBearerToken, len(proofs))
+	}
+	thumbprint, err := e.verifyDPoPProof(req, strings.TrimSpace(proofs[0]), token)
+	if err != nil {
+		return "", "", err
+	}
+
+	// the TokenCache is never consulted, since every request carries a fresh proof anyway
+	claims, err := e.verifyToken(ctx, token)
+	if err != nil {
+		if e.VerifierErrorPolicy == FallThrough && errors.Is(err, ErrVerifierUnavailable) {
+			return "", "token verifier unavailable", nil
+		}
+		return "", "", err
+	}
+	jkt, _ := claimAtPath(claims, "cnf.jkt").(string)
+	if jkt == "" {
+		return "", "", fmt.Errorf("%w: access token has no cnf.jkt claim", ErrDPoPBindingMismatch)
+	}
+	if subtle.ConstantTimeCompare([]byte(jkt), []byte(thumbprint)) != 1 {
+		return "", "", fmt.Errorf("%w: proof key thumbprint does not match cnf.jkt", ErrDPoPBindingMismatch)
+	}
+	clientID, err := e.clientIDFromClaims(claims, e.now())
+	return clientID, "", err
+}
+
+// verifyDPoPProof checks that proof is a DPoP proof JWT signed by the public key in its header, made for the
+// method and URI of req within DPoPMaxAge, and bound to token. It returns the JWK thumbprint of the key.
+// Replayed proofs are not detected, as that needs a store of the "jti" claims already seen.
+func (e *Extractor) verifyDPoPProof(req *http.Request, proof string, token string) (string, error) {
+	parsed, err := parseJWT(proof)
+	if err != nil {
+		return "", fmt.Errorf("restplay: malformed DPoP proof: %w", err)
+	}
+	if typ, _ := parsed.header["typ"].(string); !strings.EqualFold(typ, dpopProofType) {
+		return "", fmt.Errorf("%w: DPoP proof has type %q", ErrInvalidBearerToken, typ)
+	}
+	jwk, ok := parsed.header["jwk"].(map[string]any)
+	if !ok {
+		return "", fmt.Errorf("%w: DPoP proof has no jwk header", ErrInvalidBearerToken)
+	}
+	key, thumbprint, err := parseJWK(jwk)
+	if err != nil {
+		return "", err
+	}
+	alg, _ := parsed.header["alg"].(string)
+	if err = verifySignature(key, alg, parsed.signingInput, parsed.signature); err != nil {
+		return "", fmt.Errorf("restplay: DPoP proof signature invalid: %w", err)
+	}
+
+	if htm, _ := parsed.claims["htm"].(string); htm != req.Method {
+		return "", fmt.Errorf("%w: DPoP proof made for method %q", ErrInvalidBearerToken, htm)
+	}
+	if htu, _ := parsed.claims["htu"].(string); !e.matchesTargetURI(req, htu) {
+		return "", fmt.Errorf("%w: DPoP proof made for URI %q", ErrInvalidBearerToken, htu)
+	}
+	iat, ok, err := numericDateClaim(parsed.claims, "iat")
+	if err != nil {
+		return "", err
+	}
+	maxAge := e.DPoPMaxAge
+	if maxAge <= 0 {
+		maxAge = DefaultDPoPMaxAge
+	}
+	now := e.now()
+	if !ok || now.Add(e.Leeway).Before(iat) || now.After(iat.Add(maxAge+e.Leeway)) {
+		return "", fmt.Errorf("%w: DPoP proof not issued within the last %s", ErrInvalidBearerToken, maxAge)
+	}
+
+	// the proof must be bound to this very token, so a proof can't be lifted from another request
+	sum := sha256.Sum256([]byte(token))
+	ath, _ := parsed.claims["ath"].(string)
+	if subtle.ConstantTimeCompare([]byte(ath), []byte(base64.RawURLEncoding.EncodeToString(sum[:]))) != 1 {
+		return "", fmt.Errorf("%w: DPoP proof ath does not match the access token", ErrDPoPBindingMismatch)
+	}
+	return thumbprint, nil
+}
+
+// matchesTargetURI reports whether htu names the URI of req, ignoring its query and fragment as RFC 9449 asks
+func (e *Extractor) matchesTargetURI(req *http.Request, htu string) bool {
+	u, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+	scheme := "http"
+	if req.TLS != nil || (e.TrustForwardedProto && forwardedHTTPS(req)) {
+		scheme = "https"
+	}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	return strings.EqualFold(u.Scheme, scheme) &&
+		strings.EqualFold(withoutDefaultPort(u.Host, scheme), withoutDefaultPort(host, scheme)) &&
+		pathOrRoot(u.EscapedPath()) == pathOrRoot(req.URL.EscapedPath())
+}
+
+// withoutDefaultPort strips the port from host if it is the default one of scheme
+func withoutDefaultPort(host string, scheme string) string {
+	if scheme == "https" {
+		return strings.TrimSuffix(host, ":443")
+	}
+	return strings.TrimSuffix(host, ":80")
+}
+
+// pathOrRoot returns path, or "/" if it is empty
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+// parseJWK returns the public key of a JSON Web Key along with its RFC 7638 SHA-256 thumbprint.
+// Keys carrying private material are refused, since a DPoP proof must only ever hold the public half.
+func parseJWK(jwk map[string]any) (crypto.PublicKey, string, error) {
+	member := func(name string) string {
+		s, _ := jwk[name].(string)
+		return s
+	}
+	if _, ok := jwk["d"]; ok {
+		return nil, "", fmt.Errorf("%w: DPoP proof jwk holds a private key", ErrInvalidBearerToken)
+	}
+
+	var (
+		key crypto.PublicKey
+		// the required members of the key type, from which the thumbprint is computed
+		required []string
+		err      error
+	)
+	switch kty := member("kty"); kty {
+	case "EC":
+		required = []string{"crv", "kty", "x", "y"}
+		key, err = ecJWK(member("crv"), member("x"), member("y"))
+	case "RSA":
+		required = []string{"e", "kty", "n"}
+		key, err = rsaJWK(member("n"), member("e"))
+	case "OKP":
+		required = []string{"crv", "kty", "x"}
+		key, err = okpJWK(member("crv"), member("x"))
+	default:
+		err = fmt.Errorf("unsupported key type %q", kty)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: DPoP proof jwk: %w", ErrInvalidBearerToken, err)
+	}
+
+	// marshaling a map sorts its keys and leaves out whitespace, just as the thumbprint's canonical form needs
+	members := make(map[string]string, len(required))
+	for _, name := range required {
+		members[name] = member(name)
+	}
+	canonical, err := json.Marshal(members)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: DPoP proof jwk: %w", ErrInvalidBearerToken, err)
+	}
+	sum := sha256.Sum256(canonical)
+	return key, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// ecJWK decodes the members of an EC JSON Web Key
+func ecJWK(crv, x, y string) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", crv)
+	}
+	xb, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil {
+		return nil, fmt.Errorf("malformed x: %w", err)
+	}
+	yb, err := base64.RawURLEncoding.DecodeString(y)
+	if err != nil {
+		return nil, fmt.Errorf("malformed y: %w", err)
+	}
+	key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(xb), Y: new(big.Int).SetBytes(yb)}
+	// converting the key checks that the point is actually on the curve
+	if _, err = key.ECDH(); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// rsaJWK decodes the members of an RSA JSON Web Key
+func rsaJWK(n, e string) (*rsa.PublicKey, error) {
+	nb, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, fmt.Errorf("malformed n: %w", err)
+	}
+	eb, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, fmt.Errorf("malformed e: %w", err)
+	}
+	exponent := new(big.Int).SetBytes(eb)
+	if len(nb) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("invalid RSA key")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(nb), E: int(exponent.Int64())}, nil
+}
+
+// okpJWK decodes the members of an OKP JSON Web Key, of which only Ed25519 is supported
+func okpJWK(crv, x string) (ed25519.PublicKey, error) {
+	if crv != "Ed25519" {
+		return nil, fmt.Errorf("unsupported curve %q", crv)
+	}
+	xb, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil {
+		return nil, fmt.Errorf("malformed x: %w", err)
+	}
+	if len(xb) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid Ed25519 key")
+	}
+	return ed25519.PublicKey(xb), nil
+}
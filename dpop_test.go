@@ -0,0 +1,322 @@
+package restplay
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// dpopTestNow is the fixed clock of the DPoP tests
+var dpopTestNow = time.Unix(1700000000, 0)
+
+// ecJWKMembers returns the base64url-encoded coordinates of the public half of key
+func ecJWKMembers(key *ecdsa.PrivateKey) (string, string) {
+	size := (key.Curve.Params().BitSize + 7) / 8
+	x := base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, size)))
+	y := base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, size)))
+	return x, y
+}
+
+// ecThumbprint computes the RFC 7638 thumbprint of the public half of a P-256 key
+func ecThumbprint(key *ecdsa.PrivateKey) string {
+	x, y := ecJWKMembers(key)
+	sum := sha256.Sum256([]byte(fmt.Sprintf(`{"crv":"P-256","kty":"EC","x":"%s","y":"%s"}`, x, y)))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// signDPoPProof builds a DPoP proof JWT signed by key and carrying its public half. Claims not given are filled
+// in for a GET of https://example.com/resource at dpopTestNow, bound to token.
+func signDPoPProof(t *testing.T, key *ecdsa.PrivateKey, token string, claims map[string]any) string {
+	t.Helper()
+	x, y := ecJWKMembers(key)
+	header, err := json.Marshal(map[string]any{
+		"alg": "ES256",
+		"typ": "dpop+jwt",
+		"jwk": map[string]any{"kty": "EC", "crv": "P-256", "x": x, "y": y},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal DPoP proof header for test: %s", err)
+	}
+	sum := sha256.Sum256([]byte(token))
+	all := map[string]any{
+		"jti": "robbie-jti",
+		"htm": http.MethodGet,
+		"htu": "https://example.com/resource",
+		"iat": dpopTestNow.Unix(),
+		"ath": base64.RawURLEncoding.EncodeToString(sum[:]),
+	}
+	for k, v := range claims {
+		all[k] = v
+	}
+	payload, err := json.Marshal(all)
+	if err != nil {
+		t.Fatalf("failed to marshal DPoP proof claims for test: %s", err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	r, s, err := ecdsa.Sign(rand.Reader, key, hashOf(crypto.SHA256, signingInput))
+	if err != nil {
+		t.Fatalf("failed to sign DPoP proof for test: %s", err)
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestExtractorDPoP(t *testing.T) {
+	proofKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key for test: %s", err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key for test: %s", err)
+	}
+	secret := []byte("robbie-secret")
+	boundToken := signJWT(t, "HS256", secret, map[string]any{
+		"client_id": "robbie-dpop",
+		"cnf":       map[string]any{"jkt": ecThumbprint(proofKey)},
+	})
+	otherToken := signJWT(t, "HS256", secret, map[string]any{
+		"client_id": "robbie-other",
+		"cnf":       map[string]any{"jkt": ecThumbprint(otherKey)},
+	})
+	unboundToken := signJWT(t, "HS256", secret, map[string]any{"client_id": "robbie-unbound"})
+
+	tests := map[string]struct {
+		Method           string
+		Authorization    string
+		Proofs           []string
+		ExpectedClientID string
+		ExpectedErr      error
+	}{
+		"should trust the client_id of a token bound to the proof key": {
+			Authorization:    "DPoP " + boundToken,
+			Proofs:           []string{signDPoPProof(t, proofKey, boundToken, nil)},
+			ExpectedClientID: "robbie-dpop",
+		},
+		"should match the DPoP scheme case-insensitively": {
+			Authorization:    "dpop " + boundToken,
+			Proofs:           []string{signDPoPProof(t, proofKey, boundToken, nil)},
+			ExpectedClientID: "robbie-dpop",
+		},
+		"should reject a token bound to a different key than the proof's": {
+			Authorization: "DPoP " + otherToken,
+			Proofs:        []string{signDPoPProof(t, proofKey, otherToken, nil)},
+			ExpectedErr:   ErrDPoPBindingMismatch,
+		},
+		"should reject a token that is not bound to any key": {
+			Authorization: "DPoP " + unboundToken,
+			Proofs:        []string{signDPoPProof(t, proofKey, unboundToken, nil)},
+			ExpectedErr:   ErrDPoPBindingMismatch,
+		},
+		"should reject a proof made for another access token": {
+			Authorization: "DPoP " + boundToken,
+			Proofs:        []string{signDPoPProof(t, proofKey, otherToken, nil)},
+			ExpectedErr:   ErrDPoPBindingMismatch,
+		},
+		"should reject a proof made for another method": {
+			Authorization: "DPoP " + boundToken,
+			Proofs:        []string{signDPoPProof(t, proofKey, boundToken, map[string]any{"htm": http.MethodPost})},
+			ExpectedErr:   ErrInvalidBearerToken,
+		},
+		"should reject a proof made for another URI": {
+			Authorization: "DPoP " + boundToken,
+			Proofs:        []string{signDPoPProof(t, proofKey, boundToken, map[string]any{"htu": "https://example.com/other"})},
+			ExpectedErr:   ErrInvalidBearerToken,
+		},
+		"should ignore the query of the proof URI": {
+			Authorization:    "DPoP " + boundToken,
+			Proofs:           []string{signDPoPProof(t, proofKey, boundToken, map[string]any{"htu": "https://EXAMPLE.com:443/resource?x=1"})},
+			ExpectedClientID: "robbie-dpop",
+		},
+		"should reject a stale proof": {
+			Authorization: "DPoP " + boundToken,
+			Proofs:        []string{signDPoPProof(t, proofKey, boundToken, map[string]any{"iat": dpopTestNow.Add(-time.Hour).Unix()})},
+			ExpectedErr:   ErrInvalidBearerToken,
+		},
+		"should reject a proof issued in the future": {
+			Authorization: "DPoP " + boundToken,
+			Proofs:        []string{signDPoPProof(t, proofKey, boundToken, map[string]any{"iat": dpopTestNow.Add(time.Hour).Unix()})},
+			ExpectedErr:   ErrInvalidBearerToken,
+		},
+		"should reject a proof whose signature does not match its key": {
+			Authorization: "DPoP " + boundToken,
+			Proofs:        []string{tamperJWT(t, signDPoPProof(t, proofKey, boundToken, nil), map[string]any{"htm": http.MethodGet})},
+			ExpectedErr:   ErrInvalidBearerToken,
+		},
+		"should reject a DPoP token without a proof": {
+			Authorization: "DPoP " + boundToken,
+			ExpectedErr:   ErrInvalidBearerToken,
+		},
+		"should reject a DPoP token with several proofs": {
+			Authorization: "DPoP " + boundToken,
+			Proofs: []string{
+				signDPoPProof(t, proofKey, boundToken, nil),
+				signDPoPProof(t, proofKey, boundToken, nil),
+			},
+			ExpectedErr: ErrInvalidBearerToken,
+		},
+		"should fall through a request without a DPoP token": {
+			Authorization: "Bearer " + boundToken,
+			Proofs:        []string{signDPoPProof(t, proofKey, boundToken, nil)},
+			ExpectedErr:   ErrMissingClientID,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "https://example.com/resource?client=robbie", nil)
+			req.Header.Set("Authorization", tc.Authorization)
+			for _, proof := range tc.Proofs {
+				req.Header.Add("DPoP", proof)
+			}
+
+			e := &Extractor{
+				Sources:  []ClientIDSource{SourceDPoP},
+				Verifier: &HMACVerifier{Key: secret},
+				Now:      func() time.Time { return dpopTestNow },
+			}
+			res, err := e.ExtractResult(req)
+			if !errors.Is(err, tc.ExpectedErr) {
+				t.Errorf("ExtractResult() error = %v, want %v", err, tc.ExpectedErr)
+			}
+			if res.ClientID != tc.ExpectedClientID {
+				t.Errorf("ExtractResult() ClientID = %q, want %q", res.ClientID, tc.ExpectedClientID)
+			}
+			if tc.ExpectedErr == nil && res.Source != SourceDPoP {
+				t.Errorf("ExtractResult() Source = %s, want %s", res.Source, SourceDPoP)
+			}
+		})
+	}
+}
+
+func TestExtractorDPoPVerifier(t *testing.T) {
+	proofKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key for test: %s", err)
+	}
+	secret := []byte("robbie-secret")
+	token := signJWT(t, "HS256", secret, map[string]any{
+		"client_id": "robbie-verified",
+		"cnf":       map[string]any{"jkt": ecThumbprint(proofKey)},
+	})
+
+	tests := map[string]struct {
+		Key              []byte
+		ExpectedClientID string
+		ExpectedErr      error
+	}{
+		"should trust a verified token bound to the proof key": {
+			Key:              secret,
+			ExpectedClientID: "robbie-verified",
+		},
+		"should reject a token the verifier rejects": {
+			Key:         []byte("robbie-wrong-secret"),
+			ExpectedErr: ErrInvalidBearerToken,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "https://example.com/resource", nil)
+			req.Header.Set("Authorization", "DPoP "+token)
+			req.Header.Set("DPoP", signDPoPProof(t, proofKey, token, nil))
+
+			e := &Extractor{
+				Sources:  []ClientIDSource{SourceDPoP},
+				Verifier: &HMACVerifier{Key: tc.Key},
+				Now:      func() time.Time { return dpopTestNow },
+			}
+			clientID, _, err := e.Extract(req)
+			if !errors.Is(err, tc.ExpectedErr) {
+				t.Errorf("Extract() error = %v, want %v", err, tc.ExpectedErr)
+			}
+			if clientID != tc.ExpectedClientID {
+				t.Errorf("Extract() clientID = %q, want %q", clientID, tc.ExpectedClientID)
+			}
+		})
+	}
+}
+
+func TestExtractorDPoPWithoutVerifier(t *testing.T) {
+	proofKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key for test: %s", err)
+	}
+	// anyone can mint an unsigned token bound to a key of their own and sign a valid proof with it
+	token := makeUnsignedJWT(t, map[string]any{
+		"client_id": "robbie-self-minted",
+		"cnf":       map[string]any{"jkt": ecThumbprint(proofKey)},
+	})
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/resource", nil)
+	req.Header.Set("Authorization", "DPoP "+token)
+	req.Header.Set("DPoP", signDPoPProof(t, proofKey, token, nil))
+
+	e := &Extractor{Sources: []ClientIDSource{SourceDPoP}, Now: func() time.Time { return dpopTestNow }}
+	clientID, _, err := e.Extract(req)
+	var missing *MissingClientIDError
+	if !errors.As(err, &missing) || !hasAttempt(missing, SourceDPoP, "DPoP token not verified without a Verifier") {
+		t.Errorf("Expected a MissingClientIDError for the unverified DPoP token but got: %v", err)
+	}
+	if clientID != "" {
+		t.Errorf("Extract() clientID = %q, want none for a self-minted token", clientID)
+	}
+}
+
+func TestExtractorDPoPTokenAsBearer(t *testing.T) {
+	proofKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key for test: %s", err)
+	}
+	secret := []byte("robbie-secret")
+	token := signJWT(t, "HS256", secret, map[string]any{
+		"client_id": "robbie-victim",
+		"cnf":       map[string]any{"jkt": ecThumbprint(proofKey)},
+	})
+
+	tests := map[string]struct {
+		Sources  []ClientIDSource
+		Verifier TokenVerifier
+	}{
+		"should refuse a bound token sent as bearer after the DPoP source": {
+			Sources:  []ClientIDSource{SourceDPoP, SourceBearerToken},
+			Verifier: &HMACVerifier{Key: secret},
+		},
+		"should refuse a bound token sent as bearer with the default sources": {
+			Verifier: &HMACVerifier{Key: secret},
+		},
+		"should refuse a bound token sent as bearer without a Verifier": {},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "https://example.com/resource", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			e := &Extractor{
+				Sources:    tc.Sources,
+				Verifier:   tc.Verifier,
+				TokenCache: NewLRUTokenCache(10, time.Minute),
+				Now:        func() time.Time { return dpopTestNow },
+			}
+			// twice, so that a cached result could not let the token through either
+			for range 2 {
+				res, err := e.ExtractResult(req)
+				if !errors.Is(err, ErrDPoPBindingMismatch) {
+					t.Errorf("ExtractResult() error = %v, want %v", err, ErrDPoPBindingMismatch)
+				}
+				if res.ClientID != "" {
+					t.Errorf("ExtractResult() ClientID = %q from %s, want none", res.ClientID, res.Source)
+				}
+			}
+		})
+	}
+}
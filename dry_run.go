@@ -0,0 +1,35 @@
+package restplay
+
+import "net/http"
+
+// DryRun behaves like GetClientID, but leaves req completely untouched, see Extractor.DryRun
+func DryRun(req *http.Request) (string, error) {
+	return defaultExtractor.DryRun(req)
+}
+
+// DryRun returns the client_id of req like Extract, but extracts from a clone so that req itself, including the
+// identity of its Body and its parsed forms, is left exactly as it was. Since the body cannot be read without
+// consuming it, the clone reads a fresh copy from req.GetBody if it is set, as it is for requests made with
+// http.NewRequest; otherwise the body is not consulted at all.
+//
+// This costs a deep copy of the URL, headers, and any parsed forms of req on every call, plus a whole second copy
+// of the body when it is read.
+func (e *Extractor) DryRun(req *http.Request) (string, error) {
+	if req == nil {
+		return "", ErrNilRequest
+	}
+	clone := req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody {
+		clone.Body = nil
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return "", &BodyReadError{Err: err}
+			}
+			clone.Body = body
+			defer body.Close()
+		}
+	}
+	clientID, _, err := e.Extract(clone)
+	return clientID, err
+}
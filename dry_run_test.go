@@ -0,0 +1,103 @@
+package restplay
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// identityBody is a request body whose identity can be compared
+type identityBody struct {
+	io.Reader
+}
+
+func (b *identityBody) Close() error { return nil }
+
+func TestDryRun(t *testing.T) {
+	tests := map[string]struct {
+		Method           string
+		URL              string
+		Body             string
+		KeepGetBody      bool
+		ExpectedClientID string
+		ExpectedErr      error
+	}{
+		"should find the client_id in the URL query": {
+			Method:           http.MethodGet,
+			URL:              "?client_id=robbie-query",
+			ExpectedClientID: "robbie-query",
+		},
+		"should read the form body from a fresh copy": {
+			Method:           http.MethodPost,
+			Body:             "client_id=robbie-body&other=stuff",
+			KeepGetBody:      true,
+			ExpectedClientID: "robbie-body",
+		},
+		"should not consult a body that cannot be copied": {
+			Method:           http.MethodPost,
+			URL:              "?client_id=robbie-query",
+			Body:             "client_id=robbie-body",
+			ExpectedClientID: "robbie-query",
+		},
+		"should find no client_id in a body that cannot be copied": {
+			Method:      http.MethodPost,
+			Body:        "client_id=robbie-body",
+			ExpectedErr: ErrMissingClientID,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.Method, "https://example.com"+tc.URL, strings.NewReader(tc.Body))
+			if err != nil {
+				t.Fatalf("failed to create request for test: %s", err)
+			}
+			req.Header.Set(contentTypeHeaderKey, formContentType)
+			// GetBody is left as set by http.NewRequest only where it is wanted, and then the original body must not
+			// be read at all
+			if !tc.KeepGetBody {
+				req.GetBody = nil
+			}
+			body := &identityBody{Reader: strings.NewReader(tc.Body)}
+			if tc.KeepGetBody {
+				body.Reader = failingReader{t}
+			}
+			req.Body = body
+			header := req.Header.Clone()
+
+			clientID, err := DryRun(req)
+			if !errors.Is(err, tc.ExpectedErr) {
+				t.Errorf("DryRun() error = %v, want %v", err, tc.ExpectedErr)
+			}
+			if clientID != tc.ExpectedClientID {
+				t.Errorf("DryRun() got = %q, want %q", clientID, tc.ExpectedClientID)
+			}
+
+			if req.Body != body {
+				t.Errorf("DryRun() replaced the request body with %T", req.Body)
+			}
+			if req.Form != nil || req.PostForm != nil || req.MultipartForm != nil {
+				t.Error("DryRun() parsed the form of the original request")
+			}
+			if len(header) != len(req.Header) || header.Get(contentTypeHeaderKey) != req.Header.Get(contentTypeHeaderKey) {
+				t.Errorf("DryRun() changed the request headers to %v", req.Header)
+			}
+			if !tc.KeepGetBody {
+				afterBody, err := io.ReadAll(req.Body)
+				if err != nil {
+					t.Fatalf("Unable to read request body after DryRun(): %s", err)
+				}
+				if string(afterBody) != tc.Body {
+					t.Errorf("DryRun() left body = %q, want %q", afterBody, tc.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestDryRunNilRequest(t *testing.T) {
+	if _, err := DryRun(nil); !errors.Is(err, ErrNilRequest) {
+		t.Errorf("Expected errors.Is(err, ErrNilRequest) but got: %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package restplay
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// extractionError is a sentinel error that wraps ErrExtraction without changing its own message
+type extractionError struct {
+	msg string
+}
+
+// newExtractionError returns a sentinel error with the given message that matches ErrExtraction with errors.Is
+func newExtractionError(msg string) error {
+	return &extractionError{msg: msg}
+}
+
+// Error returns the sentinel's own message
+func (e *extractionError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns ErrExtraction
+func (e *extractionError) Unwrap() error {
+	return ErrExtraction
+}
+
+// loggedSentinels are the sentinel errors whose messages stand in for errors in log records, in the order they are
+// matched
+var loggedSentinels = []error{
+	ErrInvalidClientID,
+	ErrClientNotAllowed,
+	ErrInsufficientTrust,
+	ErrTokenExpired,
+	ErrTokenNotYetValid,
+	ErrDPoPBindingMismatch,
+	ErrInvalidBearerToken,
+	ErrVerifierUnavailable,
+	ErrEmptyBasicAuthPassword,
+	ErrMalformedQuery,
+	ErrBodyTooLarge,
+	ErrInsecureTransport,
+	ErrMissingClientID,
+}
+
+// loggedError describes err for a log record by the sentinel it matches, since its own message may hold the
+// client_id or credentials, e.g. a rejected basic-auth password. Errors matching none are described by their type.
+func loggedError(err error) string {
+	for _, sentinel := range loggedSentinels {
+		if errors.Is(err, sentinel) {
+			return sentinel.Error()
+		}
+	}
+	return fmt.Sprintf("%T", err)
+}
+
+// SourceAttempt records why a source consulted during extraction did not yield a client_id
+type SourceAttempt struct {
+	// Source is the source that was consulted
+	Source ClientIDSource
+	// Reason describes why the source held no client_id, e.g. "bearer token absent"
+	Reason string
+}
+
+// MissingClientIDError is returned when no source yields a client_id.
+// It matches ErrMissingClientID with errors.Is and records every source that was tried.
+// If the request carried no credential material at all, it also matches ErrNoCredentials.
+type MissingClientIDError struct {
+	// Attempts lists each consulted source in the order it was tried
+	Attempts []SourceAttempt
+	// NoCredentials is set when none of the consulted sources were present in the request, as opposed to
+	// present but unusable, e.g. basic auth with an empty username
+	NoCredentials bool
+}
+
+// Error lists the reason each source failed after the ErrMissingClientID message
+func (e *MissingClientIDError) Error() string {
+	if len(e.Attempts) == 0 {
+		return ErrMissingClientID.Error()
+	}
+	var sb strings.Builder
+	sb.WriteString(ErrMissingClientID.Error())
+	sb.WriteString(": ")
+	for i, attempt := range e.Attempts {
+		if i > 0 {
+			sb.WriteString("; ")
+		}
+		sb.WriteString(attempt.Source.String())
+		sb.WriteString(": ")
+		sb.WriteString(attempt.Reason)
+	}
+	return sb.String()
+}
+
+// Unwrap returns ErrMissingClientID, along with ErrNoCredentials if the request carried none
+func (e *MissingClientIDError) Unwrap() []error {
+	if e.NoCredentials {
+		return []error{ErrMissingClientID, ErrNoCredentials}
+	}
+	return []error{ErrMissingClientID}
+}
+
+// InvalidClientIDError is returned when a found client_id is rejected by the Extractor's ClientIDValidator.
+// It matches both ErrInvalidClientID and the validator's error with errors.Is.
+type InvalidClientIDError struct {
+	// Source is where the rejected client_id was found
+	Source ClientIDSource
+	// ClientID is the rejected value. Error leaves it out, so it is only exposed to callers reading it on purpose.
+	ClientID string
+	// Err is the error returned by the validator, which should leave out the client_id as the built-in ones do
+	Err error
+}
+
+// Error names the source of the rejected client_id and the validator's reason
+func (e *InvalidClientIDError) Error() string {
+	return fmt.Sprintf("%s from %s: %s", ErrInvalidClientID, e.Source, e.Err)
+}
+
+// Unwrap returns ErrInvalidClientID and the validator's error
+func (e *InvalidClientIDError) Unwrap() []error {
+	return []error{ErrInvalidClientID, e.Err}
+}
+
+// ClientNotAllowedError is returned when a found client_id is not in the Extractor's AllowList.
+// It matches ErrClientNotAllowed with errors.Is.
+type ClientNotAllowedError struct {
+	// Source is where the rejected client_id was found
+	Source ClientIDSource
+	// ClientID is the rejected value. Error redacts it, so it can be logged.
+	ClientID string
+}
+
+// Error names the source and the redacted client_id that was rejected
+func (e *ClientNotAllowedError) Error() string {
+	return fmt.Sprintf("%s: %s from %s", ErrClientNotAllowed, Redact(e.ClientID), e.Source)
+}
+
+// Unwrap returns ErrClientNotAllowed
+func (e *ClientNotAllowedError) Unwrap() error {
+	return ErrClientNotAllowed
+}
+
+// BodyReadError is returned when reading the request body fails partway, e.g. because the client went away or
+// the context was cancelled. The bytes read before the failure are put back in front of the unread remainder,
+// so req.Body still yields them before failing again the same way.
+type BodyReadError struct {
+	// BytesRead is how many bytes were read before the failure
+	BytesRead int64
+	// Err is the error the body failed with
+	Err error
+}
+
+// Error reports how far reading got before the failure
+func (e *BodyReadError) Error() string {
+	return fmt.Sprintf("restplay: failed to read request body after %d bytes: %s", e.BytesRead, e.Err)
+}
+
+// Unwrap returns the error the body failed with
+func (e *BodyReadError) Unwrap() error {
+	return e.Err
+}
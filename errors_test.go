@@ -0,0 +1,222 @@
+package restplay
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMissingClientIDError(t *testing.T) {
+	const baseURL = "https://example.com"
+
+	tests := map[string]struct {
+		Extractor        Extractor
+		Method           string
+		URL              string
+		ContentType      string
+		Body             string
+		Setup            func(req *http.Request)
+		ExpectedAttempts []SourceAttempt
+	}{
+		"should record every default source tried for a bare GET": {
+			Method: http.MethodGet,
+			URL:    baseURL,
+			ExpectedAttempts: []SourceAttempt{
+				{Source: SourceBasicAuth, Reason: "basic auth absent"},
+				{Source: SourceBearerToken, Reason: "bearer token absent"},
+				{Source: SourceDigestAuth, Reason: "digest auth absent"},
+				{Source: SourceHeader, Reason: "no header keys configured"},
+				{Source: SourceCookie, Reason: "no cookie names configured"},
+				{Source: SourcePath, Reason: "no path pattern configured"},
+				{Source: SourceRequestBody, Reason: "request body not read for GET requests"},
+				{Source: SourceURLQuery, Reason: `form keys ["client_id"] empty in URL query`},
+			},
+		},
+		"should record an empty basic auth username and empty form keys for a form POST": {
+			Extractor:   Extractor{Sources: []ClientIDSource{SourceBasicAuth, SourceRequestBody}},
+			Method:      http.MethodPost,
+			URL:         baseURL,
+			ContentType: formContentType,
+			Body:        "other=stuff",
+			Setup: func(req *http.Request) {
+				req.SetBasicAuth("", "password")
+			},
+			ExpectedAttempts: []SourceAttempt{
+				{Source: SourceBasicAuth, Reason: "basic auth username empty"},
+				{Source: SourceRequestBody, Reason: `form keys ["client_id"] empty in request body`},
+			},
+		},
+		"should record configured headers and cookies that were empty": {
+			Extractor: Extractor{
+				Sources:     []ClientIDSource{SourceHeader, SourceCookie},
+				HeaderKeys:  []string{"X-Client-ID"},
+				CookieNames: []string{"cid"},
+			},
+			Method: http.MethodGet,
+			URL:    baseURL,
+			ExpectedAttempts: []SourceAttempt{
+				{Source: SourceHeader, Reason: `headers ["X-Client-ID"] empty`},
+				{Source: SourceCookie, Reason: `cookies ["cid"] empty`},
+			},
+		},
+		"should record an unsupported body content type": {
+			Extractor:   Extractor{Sources: []ClientIDSource{SourceRequestBody}},
+			Method:      http.MethodPut,
+			URL:         baseURL,
+			ContentType: "text/plain",
+			Body:        "client_id=robbie-ignored",
+			ExpectedAttempts: []SourceAttempt{
+				{Source: SourceRequestBody, Reason: `content type "text/plain" not supported`},
+			},
+		},
+		"should record empty JSON keys": {
+			Extractor:   Extractor{Sources: []ClientIDSource{SourceRequestBody}},
+			Method:      http.MethodPatch,
+			URL:         baseURL,
+			ContentType: jsonContentType,
+			Body:        `{"other":"stuff"}`,
+			ExpectedAttempts: []SourceAttempt{
+				{Source: SourceRequestBody, Reason: `JSON keys ["client_id"] empty in request body`},
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.Method, tc.URL, strings.NewReader(tc.Body))
+			if err != nil {
+				t.Fatalf("failed to create request for test: %s", err)
+			}
+			if tc.ContentType != "" {
+				req.Header.Set(contentTypeHeaderKey, tc.ContentType)
+			}
+			if tc.Setup != nil {
+				tc.Setup(req)
+			}
+
+			_, _, err = tc.Extractor.Extract(req)
+			if !errors.Is(err, ErrMissingClientID) {
+				t.Fatalf("Expected errors.Is(err, ErrMissingClientID) but got: %v", err)
+			}
+			var missing *MissingClientIDError
+			if !errors.As(err, &missing) {
+				t.Fatalf("Expected a *MissingClientIDError but got: %T", err)
+			}
+			if !reflect.DeepEqual(missing.Attempts, tc.ExpectedAttempts) {
+				t.Errorf("Attempts got:\n  %+v\nwant:\n  %+v", missing.Attempts, tc.ExpectedAttempts)
+			}
+			for _, attempt := range tc.ExpectedAttempts {
+				if !strings.Contains(err.Error(), attempt.Reason) {
+					t.Errorf("Expected error %q to mention %q", err, attempt.Reason)
+				}
+			}
+		})
+	}
+}
+
+func TestMissingClientIDErrorString(t *testing.T) {
+	err := &MissingClientIDError{}
+	if err.Error() != ErrMissingClientID.Error() {
+		t.Errorf("Error() got = %q, want %q", err.Error(), ErrMissingClientID.Error())
+	}
+
+	err.Attempts = []SourceAttempt{
+		{Source: SourceBasicAuth, Reason: "basic auth absent"},
+		{Source: SourceBearerToken, Reason: "bearer token absent"},
+	}
+	expected := "restplay: failed to find client_id in request: basic_auth: basic auth absent; bearer_token: bearer token absent"
+	if err.Error() != expected {
+		t.Errorf("Error() got = %q, want %q", err.Error(), expected)
+	}
+}
+
+func TestErrExtraction(t *testing.T) {
+	sentinels := []error{
+		ErrInvalidBearerToken,
+		ErrNilRequest,
+		ErrMissingClientID,
+		ErrBodyTooLarge,
+		ErrTokenExpired,
+		ErrTokenNotYetValid,
+		ErrNoCredentials,
+		ErrInvalidClientID,
+		ErrClientNotAllowed,
+		ErrInsufficientTrust,
+		ErrInsecureTransport,
+		ErrVerifierUnavailable,
+		ErrDPoPBindingMismatch,
+		ErrMalformedQuery,
+		ErrEmptyBasicAuthPassword,
+	}
+	for _, sentinel := range sentinels {
+		if !errors.Is(sentinel, ErrExtraction) {
+			t.Errorf("errors.Is(%q, ErrExtraction) = false, want true", sentinel)
+		}
+		for _, other := range sentinels {
+			if other != sentinel && errors.Is(sentinel, other) {
+				t.Errorf("errors.Is(%q, %q) = true, want false", sentinel, other)
+			}
+		}
+	}
+
+	tests := map[string]struct {
+		Extractor     Extractor
+		Request       func() *http.Request
+		ExpectedErr   error
+		UnexpectedErr error
+	}{
+		"should match both for a nil request": {
+			Request:       func() *http.Request { return nil },
+			ExpectedErr:   ErrNilRequest,
+			UnexpectedErr: ErrMissingClientID,
+		},
+		"should match both for a missing client_id": {
+			Request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "https://example.com", nil)
+			},
+			ExpectedErr:   ErrMissingClientID,
+			UnexpectedErr: ErrInvalidBearerToken,
+		},
+		"should match both for an invalid bearer token": {
+			Request: func() *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "https://example.com", nil)
+				req.Header.Set("Authorization", "Bearer ")
+				return req
+			},
+			ExpectedErr:   ErrInvalidBearerToken,
+			UnexpectedErr: ErrMissingClientID,
+		},
+		"should match both for a plaintext request when TLS is required": {
+			Extractor: Extractor{RequireTLS: true},
+			Request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "http://example.com?client_id=robbie-query", nil)
+			},
+			ExpectedErr:   ErrInsecureTransport,
+			UnexpectedErr: ErrMissingClientID,
+		},
+		"should match both for a rejected client_id": {
+			Extractor: Extractor{ClientIDValidator: ValidateUUID},
+			Request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "https://example.com?client_id=robbie-query", nil)
+			},
+			ExpectedErr:   ErrInvalidClientID,
+			UnexpectedErr: ErrMissingClientID,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := tc.Extractor.Extract(tc.Request())
+			if !errors.Is(err, ErrExtraction) {
+				t.Errorf("Extract() error = %v, want a match for ErrExtraction", err)
+			}
+			if !errors.Is(err, tc.ExpectedErr) {
+				t.Errorf("Extract() error = %v, want a match for %v", err, tc.ExpectedErr)
+			}
+			if errors.Is(err, tc.UnexpectedErr) {
+				t.Errorf("Extract() error = %v, want no match for %v", err, tc.UnexpectedErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,931 @@
+package restplay
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	// defaultFormKeys are the form keys consulted when an Extractor configures none
+	defaultFormKeys = []string{clientIDKey}
+	// defaultBodyMethods are the methods whose request body is consulted when an Extractor configures none
+	defaultBodyMethods = []string{http.MethodPost, http.MethodPut, http.MethodPatch}
+	// defaultBearerSchemes are the Authorization schemes recognized when an Extractor configures none
+	defaultBearerSchemes = []string{bearerScheme}
+	// defaultSources is the extraction order used when an Extractor configures none
+	defaultSources = []ClientIDSource{
+		SourceBasicAuth,
+		SourceBearerToken,
+		SourceDigestAuth,
+		SourceHeader,
+		SourceCookie,
+		SourcePath,
+		SourceRequestBody,
+		SourceURLQuery,
+	}
+	// defaultExtractor backs the package-level GetClientID functions
+	defaultExtractor = &Extractor{
+		FormKeys:     defaultFormKeys,
+		MaxBodyBytes: DefaultMaxBodyBytes,
+	}
+)
+
+// Extractor extracts a client_id from requests according to its configuration.
+// The zero value is ready to use and behaves like GetClientID, except that it does not limit the size of form bodies.
+//
+// Unless Sources says otherwise, sources are consulted in this order, and the first one holding a client_id wins:
+//  1. basic-auth username (or password, see BasicAuthField)
+//  2. bearer token in the Authorization header
+//  3. digest-auth username
+//  4. configured HeaderKeys
+//  5. configured CookieNames
+//  6. URL path wildcards, see PathPattern
+//  7. the request form (the body for POST, PUT, and PATCH requests, or the BodyMethods, then the URL query).
+//     The body of a Server-Sent Events request, i.e. one accepting text/event-stream, is never read.
+//
+// An Extractor is safe for concurrent use by multiple goroutines, as long as its fields are not changed once it
+// is in use. The Verifier, TokenCache, and MetricsHook it holds must be safe for concurrent use as well, as
+// every implementation in this package is.
+type Extractor struct {
+	// Sources declares exactly which sources are consulted and in what order; sources not listed are skipped.
+	// SourceRequestBody and SourceURLQuery share the parsed request form, so they are consulted together at
+	// the position of whichever is listed first. Omitting SourceRequestBody guarantees the body is never read.
+	// If empty, the default order is used. SourceClientCert, SourceSPIFFE, SourceDPoP, and SourceXFCC are not part
+	// of the default order.
+	Sources []ClientIDSource
+	// FormKeys are the form (body or URL query) keys consulted in order; the first non-empty value wins.
+	// If empty, the default "client_id" key is used. Form bodies are recognized by their media type alone, so
+	// parameters like charset are ignored and values are returned as the percent-decoded bytes were sent,
+	// without transcoding non-UTF-8 charsets.
+	FormKeys []string
+	// NestedFormKeys are bracketed keys, e.g. "client[id]" or "auth[client_id]", with which frameworks encode
+	// nested data in forms. They are consulted in order after FormKeys, in the URL query and form bodies but
+	// not JSON bodies, and are matched against the parsed keys as they are.
+	NestedFormKeys []string
+	// JSONBodyPaths are dotted paths into the nested objects of JSON bodies, e.g. "variables.client_id" for the
+	// variables of a GraphQL request, consulted in order after FormKeys are looked up at the top level. As with
+	// ClaimKeys, a path is first tried as a whole key. Paths leading to or through arrays, and to values other than
+	// non-empty strings, are skipped.
+	JSONBodyPaths []string
+	// JSONArrayPaths are dotted paths, resolved like JSONBodyPaths, to arrays of client_ids in JSON bodies, e.g.
+	// "client_ids" for multi-tenant batch requests. Only ExtractAll consults them, collecting the non-empty string
+	// elements in order after any client_id found with FormKeys or JSONBodyPaths. Other elements are skipped with
+	// a warning logged to Logger.
+	JSONArrayPaths []string
+	// TrailerKeys are HTTP trailers, e.g. X-Client-ID, consulted in order once a streamed form body was buffered to
+	// its end for SourceRequestBody, since trailers are only complete after the body. JSON bodies are decoded only
+	// as far as needed, and pre-parsed forms are not read again, so their trailers are never consulted. They are
+	// consulted after the URL query, and a client_id found in one is reported as coming from SourceRequestBody.
+	TrailerKeys []string
+	// CaseInsensitiveFormKeys matches FormKeys against the keys of the parsed form without regard to case, so
+	// "client_id" also finds "Client_ID". An exact match is still preferred. JSON bodies are always matched exactly.
+	CaseInsensitiveFormKeys bool
+	// BasicAuthField selects whether the basic-auth username (the default) or password holds the client_id
+	BasicAuthField BasicAuthField
+	// IncludeProxyAuthorization also consults the Proxy-Authorization header for basic and bearer credentials,
+	// as set by clients of forward proxies. It is only consulted if the Authorization header holds neither.
+	IncludeProxyAuthorization bool
+	// RejectEmptyBasicAuthPassword fails extraction with ErrEmptyBasicAuthPassword for a basic-auth username
+	// without a password. Otherwise such a username is accepted as the client_id, as test setups of OAuth
+	// client-credentials flows sometimes send it.
+	RejectEmptyBasicAuthPassword bool
+	// IgnoreBasicAuthUsernames are sentinel basic-auth usernames, e.g. "anonymous", that never hold a client_id.
+	// Basic-auth credentials with one of them are skipped, so that extraction continues with the next source.
+	IgnoreBasicAuthUsernames []string
+	// BodyMethods are the methods of requests whose body is consulted for SourceRequestBody; requests with any
+	// other method only have their URL query consulted. If empty, POST, PUT, and PATCH are used.
+	BodyMethods []string
+	// HeaderKeys are request headers (e.g. X-Client-ID set by an upstream proxy) consulted in order
+	// before the request form; the first non-empty value wins.
+	HeaderKeys []string
+	// MaxBodyBytes limits how much of a request body is read while looking for a client_id; larger bodies
+	// fail with ErrBodyTooLarge. Zero means form bodies are unlimited, while JSON bodies fall back to
+	// DefaultMaxBodyBytes since they can be decoded without buffering everything. Form bodies compressed
+	// with a gzip or deflate Content-Encoding are limited both before and after decompression, with the
+	// decompressed size falling back to DefaultMaxBodyBytes as well.
+	MaxBodyBytes int64
+	// CookieNames are cookies consulted in order after HeaderKeys; the first non-empty value wins
+	CookieNames []string
+	// PathPattern is an http.ServeMux style pattern, e.g. "/clients/{client_id}/resources", matched against the
+	// URL path for SourcePath. The client_id is read from the wildcard named after the first form key present.
+	// Wildcards matched by an http.ServeMux routing the request are honored even without a PathPattern.
+	PathPattern string
+	// SubprotocolPrefixes are the Sec-WebSocket-Protocol token prefixes consulted in order by ClientIDFromUpgrade;
+	// the rest of the first matching token is the client_id. If empty, "client_id." is used.
+	SubprotocolPrefixes []string
+	// ClientCertField maps a verified mutual-TLS client certificate to the client_id for SourceClientCert.
+	// If nil, CertCommonName is used.
+	ClientCertField func(cert *x509.Certificate) string
+	// SPIFFEClientID maps the SPIFFE ID of a verified X.509 SVID, e.g. "spiffe://example.org/workload", to the
+	// client_id for SourceSPIFFE. If nil, the full SPIFFE ID is used.
+	SPIFFEClientID func(id *url.URL) string
+	// TrustXFCC lets SourceXFCC read the X-Forwarded-Client-Cert header. Any client can send that header, so only
+	// set it behind a proxy, like Envoy, that terminates mutual TLS and sanitizes or sets the header itself.
+	TrustXFCC bool
+	// XFCCClientID maps the last element of a trusted X-Forwarded-Client-Cert header, describing the client of the
+	// nearest proxy, to the client_id for SourceXFCC. If nil, the URI SAN is used, falling back to the subject's
+	// Common Name.
+	XFCCClientID func(element XFCCElement) string
+	// ClaimKeys are the JWT claims consulted in order for the client_id; the first non-empty string wins.
+	// A key may be a full namespaced claim name, like "https://example.com/claims/client_id", or a dotted
+	// path into nested objects, like "act.client_id". If empty, "client_id" then "sub" are used.
+	ClaimKeys []string
+	// DisableLegacyTokens rejects bearer tokens that are not three-segment JWTs, instead of
+	// accepting the legacy "<client_id>.<anything>" two-field format.
+	DisableLegacyTokens bool
+	// LegacyTokenSeparator separates the fields of legacy tokens, e.g. ":" for "<client_id>:<secret>" tokens.
+	// If empty, "." is used. Tokens of three dot-separated segments are always decoded as JWTs.
+	LegacyTokenSeparator string
+	// LegacyTokenFields is the number of fields legacy tokens must have, the first of which is the client_id.
+	// If zero, 2 is used.
+	LegacyTokenFields int
+	// StrictBearerFormat rejects legacy tokens with any empty field, e.g. "abc.", rather than only an empty
+	// client_id field
+	StrictBearerFormat bool
+	// Verifier, if set, must validate every bearer token before its claims are trusted.
+	// Legacy tokens are never accepted when a Verifier is set.
+	Verifier TokenVerifier
+	// VerifierErrorPolicy decides whether extraction fails or moves on to the next source when the Verifier
+	// cannot tell whether a token is valid, e.g. because it cannot reach the auth server. A token the Verifier
+	// rejects always fails extraction.
+	VerifierErrorPolicy VerifierErrorPolicy
+	// DPoPMaxAge is how old the DPoP proof of a SourceDPoP request may be according to its "iat" claim, on top
+	// of the Leeway. If zero, DefaultDPoPMaxAge is used.
+	DPoPMaxAge time.Duration
+	// VerifierTimeout bounds each call to a Verifier that implements ContextTokenVerifier, like the
+	// IntrospectionVerifier. A call that runs out of time fails with an error matching both
+	// ErrVerifierUnavailable and context.DeadlineExceeded, which the VerifierErrorPolicy then handles.
+	// The context of the extraction, e.g. of ExtractContext, bounds the calls as well. Zero leaves the calls bounded
+	// only by that context and the Verifier itself.
+	VerifierTimeout time.Duration
+	// TokenCache, if set, is consulted before the Verifier and remembers the client_id of each verified token
+	// until the token expires, or for DefaultTokenCacheTTL if the token does not say
+	TokenCache TokenCache
+	// TokenQueryKeys are URL query parameters, e.g. "id_token", consulted in order for a bearer token when the
+	// request has no Authorization header. The token found is handled exactly like one from the header.
+	// The RFC 6750 access_token parameter is always consulted after these, in the URL query and, if
+	// SourceRequestBody is enabled, in form-encoded POST bodies.
+	TokenQueryKeys []string
+	// BearerSchemes are the Authorization schemes whose credentials are treated as bearer tokens, matched
+	// case-insensitively per RFC 7235. If empty, only "Bearer" is recognized.
+	BearerSchemes []string
+	// Now returns the current time when validating the "exp" and "nbf" claims of JWTs. If nil, time.Now is used.
+	Now func() time.Time
+	// Leeway tolerates clock skew when validating the "exp" and "nbf" claims of JWTs
+	Leeway time.Duration
+	// TrimPrefixes are environment prefixes, e.g. "prod:", of which the first matching one is trimmed from the
+	// client_id after validation, whatever its source. A client_id consisting of only a prefix counts as not found.
+	TrimPrefixes []string
+	// ClientIDValidator, if set, must accept a found client_id before it is returned. A rejection fails
+	// extraction with an *InvalidClientIDError rather than falling through to the next source. The error it
+	// returns ends up in that error's message, so it should not repeat the client_id.
+	ClientIDValidator func(clientID string) error
+	// AllowList, if not nil, holds the only client_ids extraction may return, compared after TrimPrefixes and
+	// LowercaseClientID are applied. Any other client_id fails extraction with a *ClientNotAllowedError rather
+	// than falling through to the next source, so an empty non-nil AllowList rejects every client_id.
+	AllowList map[string]struct{}
+	// MinTrust is the lowest TrustLevel a source must rank at, see SourceTrust, for a client_id found in it to be
+	// returned. A client_id from a source ranking below fails extraction with ErrInsufficientTrust rather than
+	// falling through to the next source, so list only sufficiently trusted Sources to look past weaker ones.
+	// The zero TrustNone accepts every source.
+	MinTrust TrustLevel
+	// LowercaseClientID lowercases the client_id before it is returned, whatever its source. It is applied last:
+	// ClientIDValidator sees the client_id as found, and TrimPrefixes are matched against it before lowercasing.
+	LowercaseClientID bool
+	// RequireTLS refuses to read credentials from a request that did not arrive over TLS, or that the
+	// RoundTripper would not send to an https URL, failing extraction with ErrInsecureTransport before any
+	// source is consulted
+	RequireTLS bool
+	// TrustForwardedProto lets RequireTLS accept a plaintext request whose X-Forwarded-Proto header ends in
+	// "https", the value appended by the nearest proxy. Only set it behind a proxy that terminates TLS and sets
+	// that header.
+	TrustForwardedProto bool
+	// RequestContextKey is the context key under which ClientIDFromRequestContext looks for the *http.Request,
+	// for middleware stacks that store it under a key of their own. If nil, the key ContextWithRequest uses.
+	RequestContextKey any
+	// Logger, if set, receives debug records as each source is consulted, and warnings about JSONArrayPaths
+	// elements skipped by ExtractAll. Credentials and client_ids are never logged, only the sources and why they
+	// held no client_id. If nil, nothing is logged.
+	Logger *slog.Logger
+	// MetricsHook, if set, observes the outcome and duration of every extraction
+	MetricsHook MetricsHook
+	// OnFailure is called by Middleware when extraction fails. If nil, the middleware responds 401 Unauthorized.
+	OnFailure func(w http.ResponseWriter, req *http.Request, err error)
+}
+
+// Extract will attempt to extract the client_id from the request.
+// It returns the client_id, the request it inspected, and possible error.
+func (e *Extractor) Extract(req *http.Request) (string, *http.Request, error) {
+	return e.ExtractContext(context.Background(), req)
+}
+
+// ExtractContext behaves like Extract, but bounds any read of the request body, and any call to a
+// ContextTokenVerifier, by ctx.
+func (e *Extractor) ExtractContext(ctx context.Context, req *http.Request) (string, *http.Request, error) {
+	res, err := e.ExtractResultContext(ctx, req)
+	return res.ClientID, res.Request, err
+}
+
+// ExtractResult behaves like Extract, but also reports where the client_id was found
+func (e *Extractor) ExtractResult(req *http.Request) (Result, error) {
+	return e.ExtractResultContext(context.Background(), req)
+}
+
+// ExtractResultContext behaves like ExtractResult, but bounds any read of the request body, and any call to a
+// ContextTokenVerifier, by ctx.
+func (e *Extractor) ExtractResultContext(ctx context.Context, req *http.Request) (Result, error) {
+	return e.observedExtractResult(ctx, req, extractMode{})
+}
+
+// extractMode tells extractResult what kind of request it extracts from, for the entry points that know more
+// than the request itself says
+type extractMode struct {
+	// upgrade has SourceHeader also consult the Sec-WebSocket-Protocol tokens of a WebSocket upgrade request
+	upgrade bool
+	// outgoing marks a request about to be sent by a client, which RequireTLS judges by its URL scheme since
+	// such a request has no TLS connection state yet
+	outgoing bool
+}
+
+// observedExtractResult extracts like extractResult and reports the extraction to the MetricsHook
+func (e *Extractor) observedExtractResult(ctx context.Context, req *http.Request, mode extractMode) (Result, error) {
+	start := time.Now()
+	res, err := e.extractResult(ctx, req, nil, mode)
+	res.Err = err
+	e.metricsHook().ObserveExtraction(res.Source, err, time.Since(start))
+	return res, err
+}
+
+// extractResult consults each configured source in turn until one yields a client_id. What came of each
+// source is recorded in trace, if it is not nil.
+func (e *Extractor) extractResult(ctx context.Context, req *http.Request, trace *ExtractionTrace, mode extractMode) (Result, error) {
+	if req == nil {
+		return Result{}, ErrNilRequest
+	}
+	if err := e.checkTransport(req, mode.outgoing); err != nil {
+		return Result{Request: req}, err
+	}
+
+	var (
+		sources     = e.sources()
+		formChecked bool
+		// set once a source has read the body to its end, after which its trailers are complete
+		bodyRead bool
+		missing  = &MissingClientIDError{}
+		// checked once up front so that a silent extractor never builds log attributes
+		debug = e.Logger != nil && e.Logger.Enabled(ctx, slog.LevelDebug)
+	)
+	for _, source := range sources {
+		var (
+			clientID string
+			key      string
+			found    = source
+			reason   string
+			misses   []SourceAttempt
+			err      error
+		)
+		switch source {
+		case SourceBasicAuth:
+			clientID, reason, err = e.fromBasicAuth(req.Header)
+		case SourceBearerToken:
+			clientID, reason, err = e.fromBearerToken(ctx, req, slices.Contains(sources, SourceRequestBody), &bodyRead)
+		case SourceHeader:
+			clientID, key, reason = e.fromHeaders(req)
+			if clientID == "" && mode.upgrade {
+				clientID, key, reason = e.fromSubprotocols(req, reason)
+			}
+		case SourceCookie:
+			clientID, key, reason = e.fromCookies(req)
+		case SourceClientCert:
+			clientID, reason = e.fromClientCert(req)
+		case SourceDigestAuth:
+			clientID, reason = fromDigestAuth(req)
+		case SourcePath:
+			clientID, reason = e.fromPath(req)
+		case SourceSPIFFE:
+			clientID, reason = e.fromSPIFFE(req)
+		case SourceDPoP:
+			clientID, reason, err = e.fromDPoP(ctx, req)
+		case SourceXFCC:
+			clientID, reason = e.fromXFCC(req)
+		case SourceURLQuery, SourceRequestBody:
+			// both live in the request form, so they are checked together at the first of their positions
+			if formChecked {
+				continue
+			}
+			formChecked = true
+			useQuery := slices.Contains(sources, SourceURLQuery)
+			useBody := slices.Contains(sources, SourceRequestBody)
+			clientID, key, found, misses, err = e.fromForm(ctx, req, useQuery, useBody, bodyRead)
+		default:
+			reason = "unknown source"
+		}
+		if err != nil {
+			if debug {
+				e.Logger.LogAttrs(ctx, slog.LevelDebug, "restplay: source failed",
+					slog.String("source", source.String()), slog.String("error", loggedError(err)))
+			}
+			trace.record(source, OutcomeErrored, "", err)
+			return Result{Request: req}, err
+		}
+		if clientID != "" {
+			if clientID, err = e.acceptClientID(ctx, found, clientID); err != nil {
+				trace.record(found, OutcomeErrored, "", err)
+				return Result{Request: req}, err
+			}
+			if clientID != "" {
+				if debug {
+					e.Logger.LogAttrs(ctx, slog.LevelDebug, "restplay: client_id found", slog.String("source", found.String()))
+				}
+				for _, miss := range misses {
+					trace.record(miss.Source, OutcomeEmpty, miss.Reason, nil)
+				}
+				trace.record(found, OutcomeFound, "", nil)
+				return Result{ClientID: clientID, Source: found, MatchedKey: key, Request: req}, nil
+			}
+			// nothing but a prefix was left, so carry on as if the source were empty
+			source, reason = found, "client_id empty after trimming prefix"
+		}
+		if reason != "" {
+			misses = append(misses, SourceAttempt{Source: source, Reason: reason})
+		}
+		for _, miss := range misses {
+			if debug {
+				e.Logger.LogAttrs(ctx, slog.LevelDebug, "restplay: source yielded no client_id",
+					slog.String("source", miss.Source.String()), slog.String("reason", miss.Reason))
+			}
+			trace.record(miss.Source, OutcomeEmpty, miss.Reason, nil)
+		}
+		missing.Attempts = append(missing.Attempts, misses...)
+	}
+
+	// all known cases exhausted without finding a client_id
+	missing.NoCredentials = !e.credentialsPresent(req, sources)
+	return Result{Request: req}, missing
+}
+
+// BasicAuthField selects which basic-auth field holds the client_id
+type BasicAuthField int
+
+const (
+	// BasicAuthUsername reads the client_id from the basic-auth username, the usual convention
+	BasicAuthUsername BasicAuthField = iota
+	// BasicAuthPassword reads the client_id from the basic-auth password, for providers that reverse the convention
+	BasicAuthPassword
+)
+
+// fromBasicAuth returns the configured basic-auth field of the first Authorization credential in h that has
+// one, or the reason there is none. A username without a password is an error with RejectEmptyBasicAuthPassword.
+// Credentials with one of the IgnoreBasicAuthUsernames are skipped whichever field holds the client_id.
+func (e *Extractor) fromBasicAuth(h http.Header) (string, string, error) {
+	reason := "basic auth absent"
+	for _, auth := range e.basicAndBearerCredentials(h) {
+		// the request is only a vehicle for net/http's basic-auth parsing
+		username, password, ok := (&http.Request{Header: http.Header{"Authorization": {auth}}}).BasicAuth()
+		switch {
+		case !ok:
+			continue
+		case slices.Contains(e.IgnoreBasicAuthUsernames, username):
+			reason = fmt.Sprintf("basic auth username %q ignored", username)
+		case e.BasicAuthField == BasicAuthPassword && password == "":
+			reason = "basic auth password empty"
+		case e.BasicAuthField == BasicAuthPassword:
+			return password, "", nil
+		case username == "":
+			reason = "basic auth username empty"
+		case password == "" && e.RejectEmptyBasicAuthPassword:
+			return "", "", ErrEmptyBasicAuthPassword
+		default:
+			return username, "", nil
+		}
+	}
+	return "", reason, nil
+}
+
+// fromBearerToken returns the client_id of a bearer token, or the reason there is none.
+// A bearer token that is present but invalid is an error, rather than a reason to fall through to the next source.
+// Without an Authorization header, or an included Proxy-Authorization header, the token may instead be a query
+// parameter or, if useBody is set, the RFC 6750 access_token parameter of a form-encoded POST body. If that reads
+// the body to its end, bodyRead is set.
+func (e *Extractor) fromBearerToken(ctx context.Context, req *http.Request, useBody bool, bodyRead *bool) (string, string, error) {
+	if req.Header.Get("Authorization") != "" || (e.IncludeProxyAuthorization && req.Header.Get("Proxy-Authorization") != "") {
+		return e.fromBearerHeader(ctx, req.Header)
+	}
+
+	// front-channel flows pass the token in the URL
+	query := req.URL.Query()
+	for _, key := range e.tokenQueryKeys() {
+		if token := query.Get(key); token != "" {
+			return e.bearerClientID(ctx, token)
+		}
+	}
+
+	// RFC 6750 only allows the body parameter in form-encoded POSTs
+	mimetype, _, _ := mime.ParseMediaType(req.Header.Get(contentTypeHeaderKey))
+	if useBody && req.Method == http.MethodPost && mimetype == formContentType {
+		// parsed exactly as for the form sources, so the body is left re-readable and is only read once
+		_, _, _, read, err := e.parseRequestForm(ctx, req)
+		if err != nil {
+			return "", "", err
+		}
+		*bodyRead = read
+		if token := req.PostForm.Get(accessTokenKey); token != "" {
+			return e.bearerClientID(ctx, token)
+		}
+	}
+	return "", "bearer token absent", nil
+}
+
+// tokenQueryKeys returns the TokenQueryKeys followed by the RFC 6750 access_token parameter
+func (e *Extractor) tokenQueryKeys() []string {
+	return append(slices.Clip(e.TokenQueryKeys), accessTokenKey)
+}
+
+// fromBearerHeader returns the client_id of the first bearer token in the Authorization headers in h that
+// yields one, or the reason there is none. If every bearer token is invalid, the first one's error is returned.
+func (e *Extractor) fromBearerHeader(ctx context.Context, h http.Header) (string, string, error) {
+	var (
+		firstErr error
+		reason   = "bearer token absent"
+	)
+	for _, auth := range e.basicAndBearerCredentials(h) {
+		token, ok := e.bearerToken(auth)
+		if !ok {
+			continue
+		}
+		clientID, miss, err := e.bearerClientID(ctx, token)
+		if clientID != "" {
+			return clientID, "", nil
+		}
+		if miss != "" {
+			reason = miss
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return "", "", firstErr
+	}
+	return "", reason, nil
+}
+
+// bearerClientID returns the client_id of token, or the reason there is none if the Verifier is unavailable
+// and the VerifierErrorPolicy lets extraction fall through to the next source
+func (e *Extractor) bearerClientID(ctx context.Context, token string) (string, string, error) {
+	clientID, err := e.ClientIDFromBearerTokenContext(ctx, token)
+	if err != nil && e.VerifierErrorPolicy == FallThrough && errors.Is(err, ErrVerifierUnavailable) {
+		return "", "token verifier unavailable", nil
+	}
+	return clientID, "", err
+}
+
+// fromHeaders returns the first non-empty configured header, or the reason there is none.
+// This never requires touching the body.
+func (e *Extractor) fromHeaders(req *http.Request) (string, string, string) {
+	if len(e.HeaderKeys) == 0 {
+		return "", "", "no header keys configured"
+	}
+	for _, key := range e.HeaderKeys {
+		if clientID := req.Header.Get(key); clientID != "" {
+			return clientID, key, ""
+		}
+	}
+	return "", "", fmt.Sprintf("headers %q empty", e.HeaderKeys)
+}
+
+// fromCookies returns the first non-empty configured cookie, or the reason there is none.
+// Malformed cookies are skipped by req.Cookie.
+func (e *Extractor) fromCookies(req *http.Request) (string, string, string) {
+	if len(e.CookieNames) == 0 {
+		return "", "", "no cookie names configured"
+	}
+	for _, name := range e.CookieNames {
+		if cookie, err := req.Cookie(name); err == nil && cookie.Value != "" {
+			return cookie.Value, name, ""
+		}
+	}
+	return "", "", fmt.Sprintf("cookies %q empty", e.CookieNames)
+}
+
+// fromForm looks for the client_id in the request form, reading the body only if useBody is set.
+// It reports the key that held the client_id and whether it came from the URL query or the request body, or
+// why neither held one. bodyRead tells whether an earlier source already read the body to its end.
+func (e *Extractor) fromForm(ctx context.Context, req *http.Request, useQuery, useBody, bodyRead bool) (string, string, ClientIDSource, []SourceAttempt, error) {
+	queryMiss := fmt.Sprintf("form keys %q empty in URL query", e.valuesKeys())
+	if e.isBodyMethod(req.Method) && !useBody {
+		// the body must not be touched, so only the URL itself can be consulted
+		query, err := parseQuery(req)
+		if err != nil {
+			return "", "", SourceNone, nil, err
+		}
+		if clientID, key := e.lookupFormKey(query); clientID != "" {
+			return clientID, key, SourceURLQuery, nil, nil
+		}
+		return "", "", SourceNone, []SourceAttempt{{Source: SourceURLQuery, Reason: queryMiss}}, nil
+	}
+
+	jsonClientID, jsonKey, bodyMiss, read, err := e.parseRequestForm(ctx, req)
+	if err != nil || jsonClientID != "" {
+		return jsonClientID, jsonKey, SourceRequestBody, nil, err
+	}
+	bodyRead = bodyRead || read
+
+	// it is now safe to access the request's form, so try each configured key in order
+	for _, key := range e.valuesKeys() {
+		// PostForm only holds values parsed from the body, so anything else in Form came from the URL
+		bodyClientID := e.formValue(req.PostForm, key)
+		if bodyClientID != "" && useBody {
+			return bodyClientID, key, SourceRequestBody, nil, nil
+		}
+		if clientID := e.formValue(req.Form, key); clientID != "" && bodyClientID == "" && useQuery {
+			var misses []SourceAttempt
+			if useBody {
+				// the body was consulted first, which only matters to traces
+				misses = append(misses, SourceAttempt{Source: SourceRequestBody, Reason: bodyMiss})
+			}
+			return clientID, key, SourceURLQuery, misses, nil
+		}
+	}
+
+	var misses []SourceAttempt
+	if useQuery {
+		misses = append(misses, SourceAttempt{Source: SourceURLQuery, Reason: queryMiss})
+	}
+	if useBody {
+		if clientID, key := e.fromTrailers(req, bodyRead); clientID != "" {
+			return clientID, key, SourceRequestBody, misses, nil
+		}
+		misses = append([]SourceAttempt{{Source: SourceRequestBody, Reason: bodyMiss}}, misses...)
+	}
+	return "", "", SourceNone, misses, nil
+}
+
+// fromTrailers returns the first of the TrailerKeys that is non-empty in the trailers of req, along with that key.
+// Trailers are only consulted if bodyRead reports the body was read to its end, as they are incomplete before.
+func (e *Extractor) fromTrailers(req *http.Request, bodyRead bool) (string, string) {
+	if len(e.TrailerKeys) == 0 || !bodyRead {
+		return "", ""
+	}
+	for _, key := range e.TrailerKeys {
+		if clientID := strings.TrimSpace(req.Trailer.Get(key)); clientID != "" {
+			return clientID, key
+		}
+	}
+	return "", ""
+}
+
+// parseRequestForm makes req.Form safe to access, reading the body of requests with one of the body methods if
+// their content type calls for it. JSON bodies are not parsed into the form; instead any client_id found in them
+// is returned directly, along with the key that held it. If the body holds no client_id, the reason is returned
+// as bodyMiss. bodyRead reports whether the body was read to its end, after which its trailers are complete.
+func (e *Extractor) parseRequestForm(ctx context.Context, req *http.Request) (jsonClientID string, jsonKey string, bodyMiss string, bodyRead bool, err error) {
+	bodyMiss = fmt.Sprintf("form keys %q empty in request body", e.valuesKeys())
+	// before accessing the form we may need to read the body so
+	if !e.isBodyMethod(req.Method) || isEventStream(req) {
+		bodyMiss = fmt.Sprintf("request body not read for %s requests", req.Method)
+		if isEventStream(req) {
+			bodyMiss = "request body not read for event streams"
+		}
+		switch {
+		case req.Form != nil:
+		case slices.Contains(defaultBodyMethods, req.Method):
+			// ParseForm() would read the body of these methods, so only the URL query is parsed, leaving
+			// PostForm for whoever does read the body
+			if req.Form, err = parseQuery(req); err != nil {
+				return "", "", "", false, err
+			}
+		default:
+			// this call to ParseFrom() will not touch the body because the request's method doesn't call for it
+			if err = req.ParseForm(); err != nil {
+				return "", "", "", false, fmt.Errorf("%w: %w", ErrMalformedQuery, err)
+			}
+		}
+		return "", "", bodyMiss, false, nil
+	}
+
+	// if the content-type is application/x-www-form-urlencoded or multipart/form-data then we look in the PostForm;
+	// only the parsed media type is compared, so parameters like charset don't get in the way
+	mimetype, _, _ := mime.ParseMediaType(req.Header.Get(contentTypeHeaderKey))
+	encoding, decodable := contentEncoding(req)
+	// http.NoBody is as good as no body at all, and is left in place rather than buffered
+	bodyAbsent := req.Body == nil || req.Body == http.NoBody
+	if (mimetype == formContentType || mimetype == multipartContentType) && !bodyAbsent && decodable {
+		// earlier middleware may have parsed the form already, in which case the body was drained and
+		// must not be read again; multipart bodies are only fully parsed once MultipartForm is set
+		alreadyParsed := req.PostForm != nil && (mimetype != multipartContentType || req.MultipartForm != nil)
+		if alreadyParsed && req.Form == nil {
+			// with PostForm in place this only merges in the URL query, so the body is not touched
+			if err = req.ParseForm(); err != nil {
+				return "", "", "", false, fmt.Errorf("%w: %w", ErrMalformedQuery, err)
+			}
+		}
+		if !alreadyParsed {
+			parseForm := req.ParseForm
+			if !slices.Contains(defaultBodyMethods, req.Method) {
+				// ParseForm leaves the body of other methods alone, so it is parsed here instead
+				parseForm = func() error { return parseURLEncodedBody(req) }
+			}
+			if mimetype == multipartContentType {
+				// file parts beyond the memory bound are spooled to temporary files by the multipart reader
+				parseForm = func() error { return req.ParseMultipartForm(multipartMaxMemory) }
+			}
+			if bodyRead, err = e.parseFormBody(ctx, req, parseForm); err != nil {
+				return "", "", "", false, err
+			}
+		}
+		return "", "", bodyMiss, bodyRead, nil
+	}
+
+	switch {
+	case bodyAbsent:
+		bodyMiss = "request body absent"
+	case !decodable:
+		bodyMiss = fmt.Sprintf("content encoding %q not supported", encoding)
+	case mimetype == jsonContentType && encoding != "":
+		// JSON bodies are decoded as a stream, which compression would get in the way of
+		bodyMiss = fmt.Sprintf("content encoding %q not supported for JSON bodies", encoding)
+	case mimetype == jsonContentType:
+		// JSON bodies are decoded as a stream, so only the bytes needed to find the client_id are buffered
+		if jsonClientID, jsonKey, err = e.extractFromJSONBody(ctx, req); err != nil || jsonClientID != "" {
+			return jsonClientID, jsonKey, "", false, err
+		}
+		bodyMiss = fmt.Sprintf("JSON keys %q empty in request body", slices.Concat(e.formKeys(), e.JSONBodyPaths))
+	default:
+		bodyMiss = fmt.Sprintf("content type %q not supported", mimetype)
+	}
+	// no need to touch the request body, so only the URL query is parsed, which also protects from nil access
+	if req.Form == nil {
+		if req.Form, err = parseQuery(req); err != nil {
+			return "", "", "", false, err
+		}
+	}
+	return "", "", bodyMiss, false, nil
+}
+
+// isBodyMethod reports whether requests with the given method carry a body worth parsing for the client_id
+func (e *Extractor) isBodyMethod(method string) bool {
+	if len(e.BodyMethods) == 0 {
+		return slices.Contains(defaultBodyMethods, method)
+	}
+	return slices.Contains(e.BodyMethods, method)
+}
+
+// parseQuery parses the URL query of req, failing with ErrMalformedQuery where URL.Query() would silently drop
+// the malformed parts, e.g. an invalid percent-encoding
+func parseQuery(req *http.Request) (url.Values, error) {
+	query, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformedQuery, err)
+	}
+	return query, nil
+}
+
+// isEventStream reports whether req opens a Server-Sent Events stream. Its body is never read, even for one of the
+// body methods, since EventSource clients cannot send one and the stream must not be held up waiting for it.
+func isEventStream(req *http.Request) bool {
+	for _, accept := range headerTokens(req.Header, "Accept") {
+		if mimetype, _, _ := mime.ParseMediaType(accept); mimetype == eventStreamContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIDFromValues returns the value of the first configured form key that is non-empty in values,
+// or ErrMissingClientID if there is none
+func (e *Extractor) ClientIDFromValues(values url.Values) (string, error) {
+	if clientID := e.lookupForm(values); clientID != "" {
+		return clientID, nil
+	}
+	return "", ErrMissingClientID
+}
+
+// lookupForm returns the value of the first configured form key that is non-empty in values
+func (e *Extractor) lookupForm(values url.Values) string {
+	clientID, _ := e.lookupFormKey(values)
+	return clientID
+}
+
+// lookupFormKey behaves like lookupForm, but also returns the configured key that held the value
+func (e *Extractor) lookupFormKey(values url.Values) (string, string) {
+	for _, key := range e.valuesKeys() {
+		if clientID := e.formValue(values, key); clientID != "" {
+			return clientID, key
+		}
+	}
+	return "", ""
+}
+
+// formValue returns the first value of key in values, or with CaseInsensitiveFormKeys the first non-empty
+// value among the keys matching it
+func (e *Extractor) formValue(values url.Values, key string) string {
+	if !e.CaseInsensitiveFormKeys {
+		return values.Get(key)
+	}
+	for _, k := range e.matchingFormKeys(values, key) {
+		if value := values.Get(k); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// matchingFormKeys returns the keys of values that key refers to: only key itself unless CaseInsensitiveFormKeys
+// is set, in which case the exact match comes first and any other case-folded matches follow in sorted order
+func (e *Extractor) matchingFormKeys(values url.Values, key string) []string {
+	if !e.CaseInsensitiveFormKeys {
+		return []string{key}
+	}
+	var keys []string
+	for k := range values {
+		if k != key && strings.EqualFold(k, key) {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	return append([]string{key}, keys...)
+}
+
+// sources returns the configured sources, or the default order when none are configured
+func (e *Extractor) sources() []ClientIDSource {
+	if len(e.Sources) == 0 {
+		return defaultSources
+	}
+	return e.Sources
+}
+
+// valuesKeys returns the keys looked up in parsed url.Values: the form keys followed by any NestedFormKeys
+func (e *Extractor) valuesKeys() []string {
+	if len(e.NestedFormKeys) == 0 {
+		return e.formKeys()
+	}
+	return slices.Concat(e.formKeys(), e.NestedFormKeys)
+}
+
+// formKeys returns the configured form keys, or the default when none are configured
+func (e *Extractor) formKeys() []string {
+	if len(e.FormKeys) == 0 {
+		return defaultFormKeys
+	}
+	return e.FormKeys
+}
+
+// ClientIDFromBearerToken will attempt to parse/validate the token and return the identity.
+// If a Verifier is configured, it must validate the token before the client_id is read from the configured claims,
+// unless the TokenCache already holds the client_id for the token.
+// Otherwise three-segment tokens are decoded as JWTs, and the client_id is read from the configured claims.
+// Other tokens use the legacy format, where the client_id is the first of LegacyTokenFields fields separated by
+// LegacyTokenSeparator, unless DisableLegacyTokens is set.
+// JWTs bound to a key by a "cnf.jkt" claim are refused with ErrDPoPBindingMismatch, as they need a DPoP proof.
+// Whitespace around the token and around each of its fields is ignored.
+func (e *Extractor) ClientIDFromBearerToken(token string) (string, error) {
+	return e.ClientIDFromBearerTokenContext(context.Background(), token)
+}
+
+// ClientIDFromBearerTokenContext behaves like ClientIDFromBearerToken, but gives up on the Verifier once ctx is
+// done, if it is a ContextTokenVerifier.
+func (e *Extractor) ClientIDFromBearerTokenContext(ctx context.Context, token string) (string, error) {
+	// proxies rewriting the Authorization header sometimes leave stray whitespace behind
+	fields := trimFields(strings.TrimSpace(token), ".")
+	token = strings.Join(fields, ".")
+
+	if e.Verifier != nil {
+		if e.TokenCache != nil {
+			if clientID, ok := e.TokenCache.Get(token); ok {
+				return clientID, nil
+			}
+		}
+		claims, err := e.verifyToken(ctx, token)
+		if err != nil {
+			return "", err
+		}
+		// validated and cached at the same instant, so the entry cannot outlive the token
+		now := e.now()
+		clientID, err := e.bearerClientIDFromClaims(claims, now)
+		if err != nil || e.TokenCache == nil {
+			return clientID, err
+		}
+		if ttl := e.tokenTTL(claims, now); ttl > 0 {
+			e.TokenCache.Set(token, clientID, ttl)
+		}
+		return clientID, nil
+	}
+
+	switch {
+	case len(fields) == 3:
+		parsed, err := parseJWT(token)
+		if err != nil {
+			return "", err
+		}
+		return e.bearerClientIDFromClaims(parsed.claims, e.now())
+	case e.DisableLegacyTokens:
+		return "", ErrInvalidBearerToken
+	}
+	separator, count := e.legacyTokenFormat()
+	if separator != "." {
+		fields = trimFields(token, separator)
+	}
+	if len(fields) != count || fields[0] == "" {
+		return "", ErrInvalidBearerToken
+	}
+	if e.StrictBearerFormat && slices.Contains(fields, "") {
+		return "", fmt.Errorf("%w: empty token field", ErrInvalidBearerToken)
+	}
+	return fields[0], nil
+}
+
+// legacyTokenFormat returns the configured separator and field count of legacy tokens, or their defaults
+func (e *Extractor) legacyTokenFormat() (string, int) {
+	separator, count := e.LegacyTokenSeparator, e.LegacyTokenFields
+	if separator == "" {
+		separator = "."
+	}
+	if count <= 0 {
+		count = 2
+	}
+	return separator, count
+}
+
+// trimFields splits s at each sep and trims the whitespace around every field
+func trimFields(s string, sep string) []string {
+	fields := strings.Split(s, sep)
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	return fields
+}
+
+// bearerToken returns the token of an Authorization header value whose scheme is one of the bearer schemes,
+// without any auth-params following it
+func (e *Extractor) bearerToken(auth string) (string, bool) {
+	scheme, token, ok := strings.Cut(auth, " ")
+	if !ok {
+		return "", false
+	}
+	schemes := e.BearerSchemes
+	if len(schemes) == 0 {
+		schemes = defaultBearerSchemes
+	}
+	for _, s := range schemes {
+		if strings.EqualFold(scheme, strings.TrimSpace(s)) {
+			return token68(token), true
+		}
+	}
+	return "", false
+}
+
+// clientIDFromClaims validates the time-based claims of a token at now before reading the client_id from its claims
+func (e *Extractor) clientIDFromClaims(claims map[string]any, now time.Time) (string, error) {
+	if err := validateTimeClaims(claims, now, e.Leeway); err != nil {
+		return "", err
+	}
+	return clientIDFromClaims(claims, e.claimKeys())
+}
+
+// bearerClientIDFromClaims reads the client_id from the claims of a bearer token. A token bound to a key by its
+// "cnf.jkt" claim is refused, since it is only good together with a DPoP proof of possession, see SourceDPoP.
+func (e *Extractor) bearerClientIDFromClaims(claims map[string]any, now time.Time) (string, error) {
+	if jkt, _ := claimAtPath(claims, "cnf.jkt").(string); jkt != "" {
+		return "", fmt.Errorf("%w: DPoP-bound access token presented as a bearer token", ErrDPoPBindingMismatch)
+	}
+	return e.clientIDFromClaims(claims, now)
+}
+
+// tokenTTL returns how much longer after now a verified token remains valid according to its "exp" claim.
+// Without one, it is the cache TTL of the Verifier, if it has one, or DefaultTokenCacheTTL.
+func (e *Extractor) tokenTTL(claims map[string]any, now time.Time) time.Duration {
+	exp, ok, err := numericDateClaim(claims, "exp")
+	if err != nil || !ok {
+		if v, ok := e.Verifier.(cacheTTLVerifier); ok {
+			return v.cacheTTL()
+		}
+		return DefaultTokenCacheTTL
+	}
+	return exp.Add(e.Leeway).Sub(now)
+}
+
+// now returns the current time from the configured clock
+func (e *Extractor) now() time.Time {
+	if e.Now == nil {
+		return time.Now()
+	}
+	return e.Now()
+}
+
+// claimKeys returns the configured JWT claim keys, or the default when none are configured
+func (e *Extractor) claimKeys() []string {
+	if len(e.ClaimKeys) == 0 {
+		return defaultClaimKeys
+	}
+	return e.ClaimKeys
+}
@@ -0,0 +1,73 @@
+package restplay
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+)
+
+// fingerprintHeaders are the credential-bearing headers whose presence always counts toward a fingerprint
+var fingerprintHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", dpopHeaderKey}
+
+// Fingerprint returns a stable hash of the shape of req, so that extraction failures of requests alike can be
+// grouped in dashboards, using the default extraction rules
+func Fingerprint(req *http.Request) string {
+	return defaultExtractor.Fingerprint(req)
+}
+
+// Fingerprint returns a stable hash of the method of req, its normalized path, and which credential-bearing
+// headers it carries, including the HeaderKeys. Header values never count toward it, so it is safe to log.
+// The path is normalized to PathPattern if it matches, and otherwise cleaned, with segments that look like ids,
+// i.e. numbers and UUIDs, replaced by "{id}".
+func (e *Extractor) Fingerprint(req *http.Request) string {
+	if req == nil {
+		return ""
+	}
+	var headers []string
+	for _, key := range slices.Concat(fingerprintHeaders, e.HeaderKeys) {
+		if key = http.CanonicalHeaderKey(key); len(req.Header.Values(key)) > 0 && !slices.Contains(headers, key) {
+			headers = append(headers, key)
+		}
+	}
+	slices.Sort(headers)
+
+	// the fields are separated by a newline, which none of them can contain
+	sum := sha256.Sum256([]byte(strings.ToUpper(req.Method) + "\n" + e.pathTemplate(req) + "\n" + strings.Join(headers, ",")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// pathTemplate returns PathPattern if it matches the path of req, or the cleaned path with its id-like segments
+// replaced by "{id}"
+func (e *Extractor) pathTemplate(req *http.Request) string {
+	if e.PathPattern != "" {
+		if _, ok := matchPathPattern(e.PathPattern, req.URL.Path); ok {
+			return e.PathPattern
+		}
+	}
+	segments := strings.Split(path.Clean("/"+req.URL.Path), "/")
+	for i, segment := range segments {
+		if isIDSegment(segment) {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// isIDSegment reports whether a path segment looks like an id, i.e. a number or a UUID
+func isIDSegment(segment string) bool {
+	if segment == "" {
+		return false
+	}
+	if uuidPattern.MatchString(segment) {
+		return true
+	}
+	for _, r := range segment {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
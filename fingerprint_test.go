@@ -0,0 +1,112 @@
+package restplay
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	type request struct {
+		Method  string
+		URL     string
+		Headers map[string]string
+	}
+	tests := map[string]struct {
+		Extractor     *Extractor
+		First         request
+		Second        request
+		ExpectedEqual bool
+	}{
+		"should match requests differing only in header values and query": {
+			First: request{
+				Method:  http.MethodGet,
+				URL:     "https://example.com/widgets?page=1",
+				Headers: map[string]string{"Authorization": "Bearer robbie-one.x", "X-Request-Id": "robbie-1"},
+			},
+			Second: request{
+				Method:  http.MethodGet,
+				URL:     "https://example.com/widgets?page=2",
+				Headers: map[string]string{"Authorization": "Basic cm9iYmllOg==", "X-Request-Id": "robbie-2"},
+			},
+			ExpectedEqual: true,
+		},
+		"should match requests differing only in id-like path segments": {
+			First:         request{Method: http.MethodGet, URL: "https://example.com/widgets/42"},
+			Second:        request{Method: http.MethodGet, URL: "https://example.com/widgets/0b6c3f7e-8f1d-4c55-9a4e-2b1f7f0c9d13/"},
+			ExpectedEqual: true,
+		},
+		"should match paths that clean to the same path": {
+			First:         request{Method: http.MethodGet, URL: "https://example.com/widgets/./list"},
+			Second:        request{Method: http.MethodGet, URL: "https://example.com/widgets//list"},
+			ExpectedEqual: true,
+		},
+		"should match requests matching the configured path pattern": {
+			Extractor:     &Extractor{PathPattern: "/clients/{client_id}/widgets"},
+			First:         request{Method: http.MethodGet, URL: "https://example.com/clients/robbie-one/widgets"},
+			Second:        request{Method: http.MethodGet, URL: "https://example.com/clients/robbie-two/widgets"},
+			ExpectedEqual: true,
+		},
+		"should differ for different methods": {
+			First:  request{Method: http.MethodGet, URL: "https://example.com/widgets"},
+			Second: request{Method: http.MethodPost, URL: "https://example.com/widgets"},
+		},
+		"should differ for different paths": {
+			First:  request{Method: http.MethodGet, URL: "https://example.com/widgets"},
+			Second: request{Method: http.MethodGet, URL: "https://example.com/gadgets"},
+		},
+		"should differ for different credential headers present": {
+			First: request{
+				Method:  http.MethodGet,
+				URL:     "https://example.com/widgets",
+				Headers: map[string]string{"Authorization": "Bearer robbie.x"},
+			},
+			Second: request{
+				Method:  http.MethodGet,
+				URL:     "https://example.com/widgets",
+				Headers: map[string]string{"Cookie": "session=robbie"},
+			},
+		},
+		"should count the configured header keys": {
+			Extractor: &Extractor{HeaderKeys: []string{"x-client-id"}},
+			First:     request{Method: http.MethodGet, URL: "https://example.com/widgets"},
+			Second: request{
+				Method:  http.MethodGet,
+				URL:     "https://example.com/widgets",
+				Headers: map[string]string{"X-Client-ID": "robbie-header"},
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			e := tc.Extractor
+			if e == nil {
+				e = defaultExtractor
+			}
+			fingerprint := func(r request) string {
+				req, err := http.NewRequest(r.Method, r.URL, nil)
+				if err != nil {
+					t.Fatalf("failed to create request for test: %s", err)
+				}
+				for key, value := range r.Headers {
+					req.Header.Set(key, value)
+				}
+				first := e.Fingerprint(req)
+				if again := e.Fingerprint(req); again != first {
+					t.Errorf("Fingerprint() is not deterministic: %q then %q", first, again)
+				}
+				return first
+			}
+
+			first, second := fingerprint(tc.First), fingerprint(tc.Second)
+			if (first == second) != tc.ExpectedEqual {
+				t.Errorf("Fingerprint() = %q and %q, want equal: %t", first, second, tc.ExpectedEqual)
+			}
+		})
+	}
+}
+
+func TestFingerprintNilRequest(t *testing.T) {
+	if fingerprint := Fingerprint(nil); fingerprint != "" {
+		t.Errorf("Fingerprint(nil) = %q, want empty", fingerprint)
+	}
+}
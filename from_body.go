@@ -0,0 +1,86 @@
+package restplay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"slices"
+)
+
+// GetClientIDFromBody returns the client_id held by a request body that the caller has already read, e.g. to
+// verify its signature, given the Content-Type and method of the request it came with
+func GetClientIDFromBody(contentType string, body []byte, method string) (string, error) {
+	return defaultExtractor.ClientIDFromBody(contentType, body, method)
+}
+
+// ClientIDFromBody behaves like GetClientIDFromBody, but extracts with e. The body is parsed as a form-encoded,
+// multipart, or JSON body according to contentType, just as SourceRequestBody would parse it, though without
+// any other source being consulted. When the body yields no client_id the error is a *MissingClientIDError.
+func (e *Extractor) ClientIDFromBody(contentType string, body []byte, method string) (string, error) {
+	if e.MaxBodyBytes > 0 && int64(len(body)) > e.MaxBodyBytes {
+		return "", fmt.Errorf("%w: body exceeds %d bytes", ErrBodyTooLarge, e.MaxBodyBytes)
+	}
+	clientID, reason, err := e.fromBodyBytes(contentType, body, method)
+	if err != nil {
+		return "", err
+	}
+	if clientID != "" {
+		clientID, err = e.acceptClientID(context.Background(), SourceRequestBody, clientID)
+		if err != nil || clientID != "" {
+			return clientID, err
+		}
+		reason = "client_id empty after trimming prefix"
+	}
+	return "", &MissingClientIDError{
+		Attempts:      []SourceAttempt{{Source: SourceRequestBody, Reason: reason}},
+		NoCredentials: len(body) == 0,
+	}
+}
+
+// fromBodyBytes returns the client_id held by body, or the reason there is none
+func (e *Extractor) fromBodyBytes(contentType string, body []byte, method string) (string, string, error) {
+	if !e.isBodyMethod(method) {
+		return "", fmt.Sprintf("request body not read for %s requests", method), nil
+	}
+	if len(body) == 0 {
+		return "", "request body absent", nil
+	}
+
+	mimetype, params, _ := mime.ParseMediaType(contentType)
+	var values url.Values
+	switch mimetype {
+	case formContentType:
+		parsed, err := url.ParseQuery(string(body))
+		if err != nil {
+			return "", "", fmt.Errorf("restplay: failed to parse request form from body: %w", err)
+		}
+		values = parsed
+	case multipartContentType:
+		form, err := multipart.NewReader(bytes.NewReader(body), params["boundary"]).ReadForm(multipartMaxMemory)
+		if err != nil {
+			return "", "", fmt.Errorf("restplay: failed to parse request form from body: %w", err)
+		}
+		// file parts beyond the memory bound were spooled to temporary files, which are not needed
+		defer form.RemoveAll()
+		values = form.Value
+	case jsonContentType:
+		clientID, _, err := decodeJSONClientID(json.NewDecoder(bytes.NewReader(body)), e.formKeys(), e.JSONBodyPaths)
+		if err != nil {
+			return "", "", fmt.Errorf("restplay: failed to decode JSON request body: %w", err)
+		}
+		if clientID == "" {
+			return "", fmt.Sprintf("JSON keys %q empty in request body", slices.Concat(e.formKeys(), e.JSONBodyPaths)), nil
+		}
+		return clientID, "", nil
+	default:
+		return "", fmt.Sprintf("content type %q not supported", mimetype), nil
+	}
+	if clientID := e.lookupForm(values); clientID != "" {
+		return clientID, "", nil
+	}
+	return "", fmt.Sprintf("form keys %q empty in request body", e.valuesKeys()), nil
+}
@@ -0,0 +1,138 @@
+package restplay
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// multipartBody encodes fields as a multipart/form-data body and returns it along with its Content-Type
+func multipartBody(t *testing.T, fields map[string]string) ([]byte, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for name, value := range fields {
+		if err := w.WriteField(name, value); err != nil {
+			t.Fatalf("failed to write multipart field for test: %s", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close multipart writer for test: %s", err)
+	}
+	return buf.Bytes(), w.FormDataContentType()
+}
+
+func TestGetClientIDFromBody(t *testing.T) {
+	multipart, multipartContentType := multipartBody(t, map[string]string{"name": "robbie", "client_id": "robbie-multipart"})
+	multipartOther, multipartOtherContentType := multipartBody(t, map[string]string{"name": "robbie"})
+
+	tests := map[string]struct {
+		Extractor        *Extractor
+		ContentType      string
+		Body             []byte
+		Method           string
+		ExpectedClientID string
+		ExpectedErr      error
+		ExpectedErrorSub string
+	}{
+		"should find client_id in a urlencoded body": {
+			ContentType:      formContentType + "; charset=utf-8",
+			Body:             []byte("name=robbie&client_id=robbie-form"),
+			Method:           http.MethodPost,
+			ExpectedClientID: "robbie-form",
+		},
+		"should find client_id in a JSON body": {
+			ContentType:      jsonContentType,
+			Body:             []byte(`{"name":"robbie","client_id":"robbie-json"}`),
+			Method:           http.MethodPut,
+			ExpectedClientID: "robbie-json",
+		},
+		"should find client_id in a multipart body": {
+			ContentType:      multipartContentType,
+			Body:             multipart,
+			Method:           http.MethodPost,
+			ExpectedClientID: "robbie-multipart",
+		},
+		"should report a multipart body without client_id as missing": {
+			ContentType:      multipartOtherContentType,
+			Body:             multipartOther,
+			Method:           http.MethodPost,
+			ExpectedErr:      ErrMissingClientID,
+			ExpectedErrorSub: "form keys",
+		},
+		"should use the configured form keys": {
+			Extractor:        &Extractor{FormKeys: []string{"app_id"}},
+			ContentType:      formContentType,
+			Body:             []byte("client_id=robbie-ignored&app_id=robbie-app"),
+			Method:           http.MethodPatch,
+			ExpectedClientID: "robbie-app",
+		},
+		"should not consult the body of a method without one": {
+			ContentType:      formContentType,
+			Body:             []byte("client_id=robbie-form"),
+			Method:           http.MethodGet,
+			ExpectedErr:      ErrMissingClientID,
+			ExpectedErrorSub: "request body not read for GET requests",
+		},
+		"should report an unsupported content type": {
+			ContentType:      "text/plain",
+			Body:             []byte("client_id=robbie-form"),
+			Method:           http.MethodPost,
+			ExpectedErr:      ErrMissingClientID,
+			ExpectedErrorSub: `content type "text/plain" not supported`,
+		},
+		"should report an empty body as carrying no credentials": {
+			ContentType: formContentType,
+			Method:      http.MethodPost,
+			ExpectedErr: ErrNoCredentials,
+		},
+		"should fail for malformed JSON": {
+			ContentType:      jsonContentType,
+			Body:             []byte(`{"client_id":`),
+			Method:           http.MethodPost,
+			ExpectedErrorSub: "failed to decode JSON request body",
+		},
+		"should fail for a body exceeding the limit": {
+			Extractor:   &Extractor{MaxBodyBytes: 8},
+			ContentType: formContentType,
+			Body:        []byte("client_id=robbie-form"),
+			Method:      http.MethodPost,
+			ExpectedErr: ErrBodyTooLarge,
+		},
+		"should validate the client_id": {
+			Extractor:   &Extractor{ClientIDValidator: ValidateUUID},
+			ContentType: formContentType,
+			Body:        []byte("client_id=robbie-form"),
+			Method:      http.MethodPost,
+			ExpectedErr: ErrInvalidClientID,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				clientID string
+				err      error
+			)
+			if tc.Extractor != nil {
+				clientID, err = tc.Extractor.ClientIDFromBody(tc.ContentType, tc.Body, tc.Method)
+			} else {
+				clientID, err = GetClientIDFromBody(tc.ContentType, tc.Body, tc.Method)
+			}
+			if tc.ExpectedErr != nil && !errors.Is(err, tc.ExpectedErr) {
+				t.Errorf("GetClientIDFromBody() error = %v, want %v", err, tc.ExpectedErr)
+			}
+			if tc.ExpectedErrorSub != "" && (err == nil || !strings.Contains(err.Error(), tc.ExpectedErrorSub)) {
+				t.Errorf("Expected an error that contained: %q but got: %v", tc.ExpectedErrorSub, err)
+			}
+			if tc.ExpectedErr == nil && tc.ExpectedErrorSub == "" && err != nil {
+				t.Errorf("No error expected but got: %q", err)
+			}
+			if clientID != tc.ExpectedClientID {
+				t.Errorf("GetClientIDFromBody() got = %q, want %q", clientID, tc.ExpectedClientID)
+			}
+		})
+	}
+}
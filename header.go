@@ -0,0 +1,47 @@
+package restplay
+
+import (
+	"context"
+	"net/http"
+)
+
+// GetClientIDFromHeader returns the client_id carried by the Authorization header in h, as basic auth or a
+// bearer token, for callers that hold parsed headers without a request, e.g. from a queued message
+func GetClientIDFromHeader(h http.Header) (string, error) {
+	return defaultExtractor.ClientIDFromHeader(h)
+}
+
+// ClientIDFromHeader behaves like GetClientIDFromHeader, but extracts with e. Of the configured Sources, only
+// SourceBasicAuth and SourceBearerToken are consulted, in their configured order. When neither yields a
+// client_id the error is a *MissingClientIDError.
+func (e *Extractor) ClientIDFromHeader(h http.Header) (string, error) {
+	missing := &MissingClientIDError{}
+	for _, source := range e.sources() {
+		var (
+			clientID string
+			reason   string
+			err      error
+		)
+		switch source {
+		case SourceBasicAuth:
+			clientID, reason, err = e.fromBasicAuth(h)
+		case SourceBearerToken:
+			clientID, reason, err = e.fromBearerHeader(context.Background(), h)
+		default:
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if clientID != "" {
+			if clientID, err = e.acceptClientID(context.Background(), source, clientID); err != nil || clientID != "" {
+				return clientID, err
+			}
+			reason = "client_id empty after trimming prefix"
+		}
+		missing.Attempts = append(missing.Attempts, SourceAttempt{Source: source, Reason: reason})
+	}
+	missing.NoCredentials = h.Get("Authorization") == "" &&
+		(!e.IncludeProxyAuthorization || h.Get("Proxy-Authorization") == "")
+	return "", missing
+}
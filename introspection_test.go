@@ -0,0 +1,269 @@
+package restplay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIntrospectionVerifier(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "robbie-resource-server" || pass != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.PostFormValue("token_type_hint") != "access_token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set(contentTypeHeaderKey, jsonContentType)
+		switch r.PostFormValue("token") {
+		case "active-token":
+			fmt.Fprint(w, `{"active":true,"client_id":"robbie-introspected","sub":"robbie-subject","exp":4102444800}`)
+		case "expired-token":
+			fmt.Fprint(w, `{"active":true,"client_id":"robbie-introspected","exp":946684800}`)
+		case "garbled-token":
+			fmt.Fprint(w, `{"active":`)
+		default:
+			fmt.Fprint(w, `{"active":false}`)
+		}
+	}))
+	defer server.Close()
+
+	verifier := &IntrospectionVerifier{
+		URL:           server.URL,
+		ClientID:      "robbie-resource-server",
+		ClientSecret:  "s3cret",
+		TokenTypeHint: "access_token",
+		Client:        server.Client(),
+	}
+	tests := map[string]struct {
+		Verifier         *IntrospectionVerifier
+		ClaimKeys        []string
+		Token            string
+		ExpectedClientID string
+		ExpectedErr      error
+		ExpectedErrorSub string
+	}{
+		"should read client_id from an active response": {
+			Verifier:         verifier,
+			Token:            "active-token",
+			ExpectedClientID: "robbie-introspected",
+		},
+		"should read the configured field from an active response": {
+			Verifier:         verifier,
+			ClaimKeys:        []string{"sub"},
+			Token:            "active-token",
+			ExpectedClientID: "robbie-subject",
+		},
+		"should reject an inactive token": {
+			Verifier:    verifier,
+			Token:       "revoked-token",
+			ExpectedErr: ErrInvalidBearerToken,
+		},
+		"should reject an active token past its exp": {
+			Verifier:    verifier,
+			Token:       "expired-token",
+			ExpectedErr: ErrTokenExpired,
+		},
+		"should return error for a malformed response": {
+			Verifier:         verifier,
+			Token:            "garbled-token",
+			ExpectedErrorSub: "failed to decode introspection response",
+		},
+		"should return error when the endpoint refuses the client credentials": {
+			Verifier:         &IntrospectionVerifier{URL: server.URL, Client: server.Client()},
+			Token:            "active-token",
+			ExpectedErrorSub: "responded 401 Unauthorized",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			e := &Extractor{Verifier: tc.Verifier, ClaimKeys: tc.ClaimKeys}
+			clientID, err := e.ClientIDFromBearerToken(tc.Token)
+			switch {
+			case tc.ExpectedErr != nil:
+				if !errors.Is(err, tc.ExpectedErr) {
+					t.Errorf("ClientIDFromBearerToken() error = %v, want %v", err, tc.ExpectedErr)
+				}
+			case tc.ExpectedErrorSub != "":
+				if err == nil || !strings.Contains(err.Error(), tc.ExpectedErrorSub) {
+					t.Errorf("Expected an error that contained: %q but got: %v", tc.ExpectedErrorSub, err)
+				}
+			case err != nil:
+				t.Errorf("No error expected but got: %q", err)
+			}
+			if clientID != tc.ExpectedClientID {
+				t.Errorf("ClientIDFromBearerToken() got = %q, want %q", clientID, tc.ExpectedClientID)
+			}
+		})
+	}
+}
+
+func TestExtractorVerifierTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// answer only once the client gave up, or the test is over
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+		w.Header().Set(contentTypeHeaderKey, jsonContentType)
+		fmt.Fprint(w, `{"active":true,"client_id":"robbie-too-late"}`)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	hmacKey := []byte("robbie-shared-secret")
+	tests := map[string]struct {
+		Extractor        Extractor
+		Token            string
+		ExpectedClientID string
+		ExpectedSource   ClientIDSource
+		ExpectedErrs     []error
+	}{
+		"should fail closed once a slow remote verifier times out": {
+			Extractor:    Extractor{Verifier: &IntrospectionVerifier{URL: server.URL}, VerifierTimeout: 20 * time.Millisecond},
+			Token:        "robbie-opaque-token",
+			ExpectedErrs: []error{ErrVerifierUnavailable, context.DeadlineExceeded},
+		},
+		"should fall through to the next source once a slow remote verifier times out": {
+			Extractor: Extractor{
+				Verifier:            &IntrospectionVerifier{URL: server.URL},
+				VerifierTimeout:     20 * time.Millisecond,
+				VerifierErrorPolicy: FallThrough,
+			},
+			Token:            "robbie-opaque-token",
+			ExpectedClientID: "robbie-query",
+			ExpectedSource:   SourceURLQuery,
+		},
+		"should leave a local verifier unaffected": {
+			Extractor:        Extractor{Verifier: &HMACVerifier{Key: hmacKey}, VerifierTimeout: time.Nanosecond},
+			Token:            signJWT(t, "HS256", hmacKey, map[string]any{"client_id": "robbie-hmac"}),
+			ExpectedClientID: "robbie-hmac",
+			ExpectedSource:   SourceBearerToken,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "https://example.com?client_id=robbie-query", nil)
+			req.Header.Set("Authorization", "Bearer "+tc.Token)
+
+			start := time.Now()
+			res, err := tc.Extractor.ExtractResult(req)
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("ExtractResult() took %s, want the verifier call cut short", elapsed)
+			}
+			for _, expected := range tc.ExpectedErrs {
+				if !errors.Is(err, expected) {
+					t.Errorf("ExtractResult() error = %v, want a match for %v", err, expected)
+				}
+			}
+			if len(tc.ExpectedErrs) == 0 && err != nil {
+				t.Errorf("No error expected but got: %q", err)
+			}
+			if res.ClientID != tc.ExpectedClientID {
+				t.Errorf("ExtractResult() ClientID = %q, want %q", res.ClientID, tc.ExpectedClientID)
+			}
+			if res.Source != tc.ExpectedSource {
+				t.Errorf("ExtractResult() Source = %s, want %s", res.Source, tc.ExpectedSource)
+			}
+		})
+	}
+}
+
+func TestIntrospectionVerifierTokenCacheTTL(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set(contentTypeHeaderKey, jsonContentType)
+		if calls == 1 {
+			// active without saying until when
+			fmt.Fprint(w, `{"active":true,"client_id":"robbie-introspected"}`)
+			return
+		}
+		// revoked since
+		fmt.Fprint(w, `{"active":false}`)
+	}))
+	defer server.Close()
+
+	now := time.Unix(1_700_000_000, 0)
+	clock := func() time.Time { return now }
+	// the cache itself keeps entries until their token expires
+	cache := NewLRUTokenCache(10, 0)
+	cache.now = clock
+	e := &Extractor{
+		Verifier:   &IntrospectionVerifier{URL: server.URL, Client: server.Client()},
+		TokenCache: cache,
+		Now:        clock,
+	}
+
+	for _, advance := range []time.Duration{0, DefaultTokenCacheTTL - time.Second} {
+		now = now.Add(advance)
+		clientID, err := e.ClientIDFromBearerToken("revoked-token")
+		if err != nil || clientID != "robbie-introspected" {
+			t.Fatalf("ClientIDFromBearerToken() got = %q, %v, want %q", clientID, err, "robbie-introspected")
+		}
+	}
+	if calls != 1 {
+		t.Errorf("introspection endpoint called %d times within DefaultTokenCacheTTL, want 1", calls)
+	}
+
+	now = now.Add(time.Second)
+	if _, err := e.ClientIDFromBearerToken("revoked-token"); !errors.Is(err, ErrInvalidBearerToken) {
+		t.Errorf("ClientIDFromBearerToken() error = %v after DefaultTokenCacheTTL, want %v", err, ErrInvalidBearerToken)
+	}
+	if calls != 2 {
+		t.Errorf("introspection endpoint called %d times, want 2", calls)
+	}
+}
+
+func TestExtractorVerifierRequestContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// answer only once the client gave up, or the test is over
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+		w.Header().Set(contentTypeHeaderKey, jsonContentType)
+		fmt.Fprint(w, `{"active":true,"client_id":"robbie-too-late"}`)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	tests := map[string]struct {
+		VerifierTimeout time.Duration
+	}{
+		"should give up once the request context expires before the VerifierTimeout": {
+			VerifierTimeout: 5 * time.Second,
+		},
+		"should give up once the request context expires without a VerifierTimeout": {},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "https://example.com", nil)
+			req.Header.Set("Authorization", "Bearer robbie-opaque-token")
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			e := &Extractor{Verifier: &IntrospectionVerifier{URL: server.URL}, VerifierTimeout: tc.VerifierTimeout}
+			start := time.Now()
+			clientID, _, err := e.ExtractContext(ctx, req)
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("ExtractContext() took %s, want the verifier call cut short by the request context", elapsed)
+			}
+			if !errors.Is(err, ErrVerifierUnavailable) || !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("ExtractContext() error = %v, want a match for %v and %v", err, ErrVerifierUnavailable, context.DeadlineExceeded)
+			}
+			if clientID != "" {
+				t.Errorf("ExtractContext() clientID = %q, want none", clientID)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package restplay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// extractFromJSONBody decodes the top-level object of a JSON request body looking for the configured form keys,
+// then the JSONBodyPaths.
+// Only the bytes consumed by the decoder are buffered, and they are always stitched back in front of the
+// unread remainder, so req.Body still yields the exact original bytes afterward.
+func (e *Extractor) extractFromJSONBody(ctx context.Context, req *http.Request) (string, string, error) {
+	var (
+		consumed bytes.Buffer
+		body     = req.Body
+		limit    = e.jsonBodyLimit()
+		read     = &readErrRecorder{r: &contextReader{ctx: ctx, r: body}}
+		limited  = &io.LimitedReader{R: read, N: limit}
+	)
+	defer func() {
+		req.Body = readCloser{Reader: io.MultiReader(&consumed, body), Closer: body}
+	}()
+
+	clientID, key, err := decodeJSONClientID(json.NewDecoder(io.TeeReader(limited, &consumed)), e.formKeys(), e.JSONBodyPaths)
+	if err != nil {
+		if read.err != nil {
+			// the body itself failed, as opposed to the JSON in it
+			return "", "", &BodyReadError{BytesRead: int64(consumed.Len()), Err: read.err}
+		}
+		if limited.N <= 0 {
+			return "", "", fmt.Errorf("%w: JSON request body exceeds %d bytes without finding client_id", ErrBodyTooLarge, limit)
+		}
+		return "", "", fmt.Errorf("restplay: failed to decode JSON request body: %w", err)
+	}
+	return clientID, key, nil
+}
+
+// extractJSONArrays returns the non-empty strings in the arrays that the JSONArrayPaths pick out of a JSON request
+// body, in order. The body is only read if it is JSON and would be read for SourceRequestBody, and the bytes
+// consumed by the decoder are stitched back in front of the unread remainder as for extractFromJSONBody.
+func (e *Extractor) extractJSONArrays(ctx context.Context, req *http.Request) ([]string, error) {
+	if len(e.JSONArrayPaths) == 0 || !e.isBodyMethod(req.Method) || isEventStream(req) ||
+		req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if mimetype, _, _ := mime.ParseMediaType(req.Header.Get(contentTypeHeaderKey)); mimetype != jsonContentType {
+		return nil, nil
+	}
+	if encoding, _ := contentEncoding(req); encoding != "" {
+		return nil, nil
+	}
+
+	var (
+		consumed bytes.Buffer
+		body     = req.Body
+		limit    = e.jsonBodyLimit()
+		read     = &readErrRecorder{r: &contextReader{ctx: ctx, r: body}}
+		limited  = &io.LimitedReader{R: read, N: limit}
+	)
+	defer func() {
+		req.Body = readCloser{Reader: io.MultiReader(&consumed, body), Closer: body}
+	}()
+
+	var value any
+	if err := json.NewDecoder(io.TeeReader(limited, &consumed)).Decode(&value); err != nil {
+		if read.err != nil {
+			return nil, &BodyReadError{BytesRead: int64(consumed.Len()), Err: read.err}
+		}
+		if limited.N <= 0 {
+			return nil, fmt.Errorf("%w: JSON request body exceeds %d bytes", ErrBodyTooLarge, limit)
+		}
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("restplay: failed to decode JSON request body: %w", err)
+	}
+	object, ok := value.(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+	var clientIDs []string
+	for _, path := range e.JSONArrayPaths {
+		elements, _ := claimAtPath(object, path).([]any)
+		for i, element := range elements {
+			str, ok := element.(string)
+			if !ok {
+				if e.Logger != nil {
+					e.Logger.LogAttrs(ctx, slog.LevelWarn, "restplay: skipped JSON array element that is no string",
+						slog.String("path", path), slog.Int("index", i), slog.String("type", jsonTypeName(element)))
+				}
+				continue
+			}
+			if str != "" {
+				clientIDs = append(clientIDs, str)
+			}
+		}
+	}
+	return clientIDs, nil
+}
+
+// jsonTypeName names the JSON type of a value decoded into an any
+func jsonTypeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// jsonBodyLimit returns how much of a JSON body may be buffered. Unlike form bodies, JSON bodies are always
+// bounded, falling back to DefaultMaxBodyBytes when MaxBodyBytes is unlimited.
+func (e *Extractor) jsonBodyLimit() int64 {
+	if e.MaxBodyBytes > 0 {
+		return e.MaxBodyBytes
+	}
+	return DefaultMaxBodyBytes
+}
+
+// decodeJSONClientID streams through a top-level JSON object and returns the client_id of the highest priority
+// key or path, keys first, along with that key or path. Bodies that are not a JSON object yield no client_id.
+func decodeJSONClientID(dec *json.Decoder, keys []string, paths []string) (string, string, error) {
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return "", "", nil
+	}
+
+	var (
+		clientID string
+		best     = len(keys) + len(paths)
+	)
+	for dec.More() {
+		if tok, err = dec.Token(); err != nil {
+			return "", "", err
+		}
+		key, _ := tok.(string)
+		idx := slices.Index(keys, key)
+		if idx < 0 {
+			idx = slices.IndexFunc(paths, func(path string) bool {
+				return path == key || strings.HasPrefix(path, key+".")
+			})
+			if idx >= 0 {
+				idx += len(keys)
+			}
+		}
+		if idx >= 0 && idx < best {
+			var value any
+			if err = dec.Decode(&value); err != nil {
+				return "", "", err
+			}
+			for i := idx; i < best; i++ {
+				if str := jsonValueAt(key, value, keys, paths, i); str != "" {
+					clientID, best = str, i
+					break
+				}
+			}
+			if best == 0 {
+				// nothing can outrank the first key, so stop reading
+				return clientID, keyOrPath(keys, paths, best), nil
+			}
+			continue
+		}
+		// skip over values we don't care about
+		var skip json.RawMessage
+		if err = dec.Decode(&skip); err != nil {
+			return "", "", err
+		}
+	}
+	if clientID == "" {
+		return "", "", nil
+	}
+	return clientID, keyOrPath(keys, paths, best), nil
+}
+
+// keyOrPath returns the i-th of keys followed by paths
+func keyOrPath(keys []string, paths []string, i int) string {
+	if i < len(keys) {
+		return keys[i]
+	}
+	return paths[i-len(keys)]
+}
+
+// jsonValueAt returns the non-empty string that the i-th of keys followed by paths picks out of the value of
+// the top-level key, or "" if it picks out nothing
+func jsonValueAt(key string, value any, keys []string, paths []string, i int) string {
+	if i < len(keys) {
+		if keys[i] != key {
+			return ""
+		}
+		str, _ := value.(string)
+		return str
+	}
+	str, _ := claimAtPath(map[string]any{key: value}, keyOrPath(keys, paths, i)).(string)
+	return str
+}
+
+// readErrRecorder remembers the first error other than io.EOF returned by its reader
+type readErrRecorder struct {
+	r   io.Reader
+	err error
+}
+
+func (rr *readErrRecorder) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	if err != nil && err != io.EOF && rr.err == nil {
+		rr.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,165 @@
+package restplay
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExtractJSONBody(t *testing.T) {
+	const baseURL = "https://example.com"
+
+	tests := map[string]struct {
+		Method           string
+		ContentType      string
+		FormKeys         []string
+		JSONBodyPaths    []string
+		Body             string
+		ExpectedClientID string
+		ExpectedErrorSub string
+	}{
+		"should find client_id in a JSON POST body": {
+			Method:           http.MethodPost,
+			Body:             `{"name":"robbie","client_id":"robbie-json-post"}`,
+			ExpectedClientID: "robbie-json-post",
+		},
+		"should find client_id in a JSON PUT body": {
+			Method:           http.MethodPut,
+			Body:             `{"client_id":"robbie-json-put","nested":{"client_id":"nope"}}`,
+			ExpectedClientID: "robbie-json-put",
+		},
+		"should find client_id in a JSON PATCH body with a charset parameter": {
+			Method:           http.MethodPatch,
+			ContentType:      "application/json; charset=utf-8",
+			Body:             `{"list":[1,2,3],"client_id":"robbie-json-patch"}`,
+			ExpectedClientID: "robbie-json-patch",
+		},
+		"should prefer the first configured key regardless of position in the body": {
+			Method:           http.MethodPost,
+			FormKeys:         []string{"clientId", "app_id"},
+			Body:             `{"app_id":"robbie-second","clientId":"robbie-first"}`,
+			ExpectedClientID: "robbie-first",
+		},
+		"should skip non-string and empty values": {
+			Method:           http.MethodPost,
+			FormKeys:         []string{"clientId", "app_id"},
+			Body:             `{"clientId":42,"app_id":"","other":"x"}`,
+			ExpectedErrorSub: "failed to find client_id",
+		},
+		"should not find a client_id nested below the top level": {
+			Method:           http.MethodPost,
+			Body:             `{"auth":{"client_id":"robbie-nested"}}`,
+			ExpectedErrorSub: "failed to find client_id",
+		},
+		"should find client_id in the variables of a GraphQL body": {
+			Method:           http.MethodPost,
+			JSONBodyPaths:    []string{"variables.client_id"},
+			Body:             `{"query":"query Widgets($client_id: ID!) { widgets(client: $client_id) { id } }","variables":{"client_id":"robbie-graphql"}}`,
+			ExpectedClientID: "robbie-graphql",
+		},
+		"should not find client_id in the variables of a GraphQL body without a path": {
+			Method:           http.MethodPost,
+			Body:             `{"query":"{ widgets { id } }","variables":{"client_id":"robbie-graphql"}}`,
+			ExpectedErrorSub: "failed to find client_id",
+		},
+		"should try the JSON body paths in order": {
+			Method:           http.MethodPost,
+			JSONBodyPaths:    []string{"variables.client_id", "extensions.auth.client_id"},
+			Body:             `{"extensions":{"auth":{"client_id":"robbie-extensions"}},"variables":{"client_id":"robbie-variables"}}`,
+			ExpectedClientID: "robbie-variables",
+		},
+		"should fall back to a later JSON body path": {
+			Method:           http.MethodPost,
+			JSONBodyPaths:    []string{"variables.client_id", "extensions.auth.client_id"},
+			Body:             `{"variables":{"first":10},"extensions":{"auth":{"client_id":"robbie-extensions"}}}`,
+			ExpectedClientID: "robbie-extensions",
+		},
+		"should skip an array at a JSON body path": {
+			Method:           http.MethodPost,
+			JSONBodyPaths:    []string{"auth.client_id", "meta.app"},
+			Body:             `{"auth":{"client_id":["robbie-array"]},"meta":{"app":"robbie-meta"}}`,
+			ExpectedClientID: "robbie-meta",
+		},
+		"should skip an array along a JSON body path": {
+			Method:           http.MethodPost,
+			JSONBodyPaths:    []string{"auth.client_id", "meta.app"},
+			Body:             `{"auth":[{"client_id":"robbie-array"}],"meta":{"app":"robbie-meta"}}`,
+			ExpectedClientID: "robbie-meta",
+		},
+		"should skip a non-string value at a JSON body path": {
+			Method:           http.MethodPost,
+			JSONBodyPaths:    []string{"auth.client_id", "meta.app"},
+			Body:             `{"meta":{"app":"robbie-meta"},"auth":{"client_id":42}}`,
+			ExpectedClientID: "robbie-meta",
+		},
+		"should skip an empty string at a JSON body path": {
+			Method:           http.MethodPost,
+			JSONBodyPaths:    []string{"auth.client_id", "meta.app"},
+			Body:             `{"auth":{"client_id":""},"meta":{"app":"robbie-meta"}}`,
+			ExpectedClientID: "robbie-meta",
+		},
+		"should fail when no JSON body path holds a string": {
+			Method:           http.MethodPost,
+			JSONBodyPaths:    []string{"auth.client_id", "meta.app"},
+			Body:             `{"auth":{"client_id":null},"meta":{"app":{"name":"robbie-object"}}}`,
+			ExpectedErrorSub: "failed to find client_id",
+		},
+		"should prefer a top-level form key over a JSON body path": {
+			Method:           http.MethodPost,
+			JSONBodyPaths:    []string{"variables.client_id"},
+			Body:             `{"variables":{"client_id":"robbie-variables"},"client_id":"robbie-top"}`,
+			ExpectedClientID: "robbie-top",
+		},
+		"should not find a client_id in a JSON array": {
+			Method:           http.MethodPost,
+			Body:             `[{"client_id":"robbie-array"}]`,
+			ExpectedErrorSub: "failed to find client_id",
+		},
+		"should return error for malformed JSON": {
+			Method:           http.MethodPost,
+			Body:             `{"other":}`,
+			ExpectedErrorSub: "failed to decode JSON request body",
+		},
+		"should return error for a JSON body exceeding the limit": {
+			Method:           http.MethodPost,
+			Body:             `{"pad":"` + strings.Repeat("x", DefaultMaxBodyBytes) + `","client_id":"robbie-too-far"}`,
+			ExpectedErrorSub: "exceeds",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.Method, baseURL, strings.NewReader(tc.Body))
+			if err != nil {
+				t.Fatalf("failed to create request for test: %s", err)
+			}
+			contentType := tc.ContentType
+			if contentType == "" {
+				contentType = jsonContentType
+			}
+			req.Header.Set(contentTypeHeaderKey, contentType)
+
+			e := &Extractor{FormKeys: tc.FormKeys, JSONBodyPaths: tc.JSONBodyPaths}
+			clientID, req, err := e.Extract(req)
+			if tc.ExpectedErrorSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.ExpectedErrorSub) {
+					t.Errorf("Expected an error that contained: %q but got: %v", tc.ExpectedErrorSub, err)
+				}
+			} else if err != nil {
+				t.Errorf("No error expected but got: %q", err)
+			}
+			if clientID != tc.ExpectedClientID {
+				t.Errorf("Extract() got = %q, want %q", clientID, tc.ExpectedClientID)
+			}
+
+			// the body must round-trip regardless of outcome
+			afterBody, err := io.ReadAll(req.Body)
+			if err != nil {
+				t.Fatalf("Unable to read request body after Extract(): %s", err)
+			}
+			if string(afterBody) != tc.Body {
+				t.Errorf("Request body changed:\n  Original: %.80q\n  After:   %.80q", tc.Body, afterBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package restplay
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultJWKSRefreshInterval is how long a JWKSVerifier trusts the keys it fetched when no RefreshInterval is set
+	DefaultJWKSRefreshInterval = time.Hour
+	// DefaultJWKSMinRefreshInterval is how often a JWKSVerifier refetches its keys at most when no
+	// MinRefreshInterval is set
+	DefaultJWKSMinRefreshInterval = time.Minute
+	// DefaultJWKSFetchTimeout bounds each fetch of a key set, which outlives the verification that started it
+	DefaultJWKSFetchTimeout = 30 * time.Second
+)
+
+// JWKSVerifier verifies JWTs against the signing keys an OIDC provider publishes as a JSON Web Key Set, choosing
+// the key by the token's "kid" header. The verified claims are returned, so the Extractor's ClaimKeys choose which
+// of them holds the client_id, "client_id" then "sub" by default.
+//
+// The keys are fetched on first use and refetched once RefreshInterval passes, or sooner when a token names a
+// kid that is not known yet, as happens right after the provider rotates its keys. Refetches happen at most once
+// per MinRefreshInterval, so that tokens with made-up kids cannot turn into a storm of requests to the provider.
+// Concurrent verifications share one fetch, and tokens naming a known kid are verified with the known key
+// meanwhile.
+type JWKSVerifier struct {
+	// URL is the JWKS endpoint of the provider, i.e. the jwks_uri of its discovery document
+	URL string
+	// RefreshInterval is how long fetched keys are trusted before they are fetched again.
+	// If zero, DefaultJWKSRefreshInterval is used.
+	RefreshInterval time.Duration
+	// MinRefreshInterval is the least time between two fetches. If zero, DefaultJWKSMinRefreshInterval is used.
+	MinRefreshInterval time.Duration
+	// Client fetches the key set, and its Timeout bounds the fetches on top of DefaultJWKSFetchTimeout.
+	// If nil, http.DefaultClient is used.
+	Client *http.Client
+	// Now returns the current time. If nil, time.Now is used.
+	Now func() time.Time
+
+	// mu guards the fields below
+	mu        sync.Mutex
+	keys      map[string]jwksKey
+	fetched   time.Time
+	attempted time.Time
+	// refresh is the fetch under way, if any
+	refresh *jwksRefresh
+}
+
+// jwksRefresh is a fetch of the key set that concurrent verifications wait for together
+type jwksRefresh struct {
+	// done is closed once the fetch completed, after err is set
+	done chan struct{}
+	err  error
+}
+
+// jwksKey is a signing key of a key set along with the algorithm it is restricted to, if any
+type jwksKey struct {
+	key crypto.PublicKey
+	alg string
+}
+
+// Verify checks the token's signature against the key set and returns its claims.
+// Tokens naming no known key fail with ErrInvalidBearerToken; a failure to fetch the key set is returned as is,
+// since it says nothing about the token.
+func (v *JWKSVerifier) Verify(token string) (map[string]any, error) {
+	return v.VerifyContext(context.Background(), token)
+}
+
+// VerifyContext behaves like Verify, but gives up waiting for the key set to be fetched once ctx is done
+func (v *JWKSVerifier) VerifyContext(ctx context.Context, token string) (map[string]any, error) {
+	parsed, err := parseJWT(token)
+	if err != nil {
+		return nil, err
+	}
+	kid, _ := parsed.header["kid"].(string)
+	key, err := v.key(ctx, kid)
+	if err != nil {
+		return nil, err
+	}
+	alg, _ := parsed.header["alg"].(string)
+	if key.alg != "" && key.alg != alg {
+		return nil, unsupportedAlgorithm(alg)
+	}
+	if err = verifySignature(key.key, alg, parsed.signingInput, parsed.signature); err != nil {
+		return nil, err
+	}
+	return parsed.claims, nil
+}
+
+// key returns the key named kid, fetching the key set if it is stale or does not hold kid. Only a verification
+// that needs a fetch waits for it, and no longer than ctx allows.
+// A token without a kid is only accepted when the key set holds exactly one key.
+func (v *JWKSVerifier) key(ctx context.Context, kid string) (jwksKey, error) {
+	v.mu.Lock()
+	now := v.now()
+	key, ok := v.lookup(kid)
+	fetchedAny := v.keys != nil
+	stale := !fetchedAny || now.Sub(v.fetched) >= orDefault(v.RefreshInterval, DefaultJWKSRefreshInterval)
+	refresh, started := v.refresh, false
+	if refresh == nil && (!ok || stale) && now.Sub(v.attempted) >= orDefault(v.MinRefreshInterval, DefaultJWKSMinRefreshInterval) {
+		v.attempted = now
+		refresh, started = &jwksRefresh{done: make(chan struct{})}, true
+		v.refresh = refresh
+		go v.refreshKeys(ctx, refresh, now)
+	}
+	v.mu.Unlock()
+
+	if refresh != nil && (started || !ok) {
+		select {
+		case <-refresh.done:
+		case <-ctx.Done():
+			if ok {
+				return key, nil
+			}
+			return jwksKey{}, fmt.Errorf("restplay: JWKS from %s unavailable: %w", v.URL, ctx.Err())
+		}
+		if refresh.err != nil {
+			if !ok {
+				return jwksKey{}, refresh.err
+			}
+			// a key known before is still good enough while the provider can't be reached
+			return key, nil
+		}
+		v.mu.Lock()
+		key, ok = v.lookup(kid)
+		fetchedAny = v.keys != nil
+		v.mu.Unlock()
+	}
+	if !ok {
+		if !fetchedAny {
+			// the last fetch failed only moments ago, so the key set is as unavailable as it was then
+			return jwksKey{}, fmt.Errorf("restplay: JWKS from %s unavailable", v.URL)
+		}
+		return jwksKey{}, fmt.Errorf("%w: no signing key with kid %q", ErrInvalidBearerToken, kid)
+	}
+	return key, nil
+}
+
+// refreshKeys fetches the key set for refresh, which was started at now, and stores it unless the fetch failed.
+// The fetch keeps the values of ctx but not its cancellation, as other verifications may be waiting for it.
+func (v *JWKSVerifier) refreshKeys(ctx context.Context, refresh *jwksRefresh, now time.Time) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), DefaultJWKSFetchTimeout)
+	defer cancel()
+	keys, err := v.fetch(ctx)
+
+	v.mu.Lock()
+	if err == nil {
+		v.keys, v.fetched = keys, now
+	}
+	refresh.err = err
+	v.refresh = nil
+	v.mu.Unlock()
+	close(refresh.done)
+}
+
+// lookup returns the key named kid from the fetched key set
+func (v *JWKSVerifier) lookup(kid string) (jwksKey, bool) {
+	if kid == "" {
+		if len(v.keys) != 1 {
+			return jwksKey{}, false
+		}
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+	key, ok := v.keys[kid]
+	return key, ok
+}
+
+// fetch retrieves the key set and returns its signing keys by kid. Keys meant for encryption, and keys of
+// unsupported types, are left out.
+func (v *JWKSVerifier) fetch(ctx context.Context) (map[string]jwksKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("restplay: failed to create JWKS request: %w", err)
+	}
+	req.Header.Set("Accept", jsonContentType)
+
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("restplay: JWKS request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("restplay: JWKS endpoint responded %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []map[string]any `json:"keys"`
+	}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, DefaultMaxBodyBytes)).Decode(&set); err != nil {
+		return nil, fmt.Errorf("restplay: failed to decode JWKS: %w", err)
+	}
+	keys := make(map[string]jwksKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if use, _ := jwk["use"].(string); use != "" && use != "sig" {
+			continue
+		}
+		key, _, err := parseJWK(jwk)
+		if err != nil {
+			continue
+		}
+		kid, _ := jwk["kid"].(string)
+		alg, _ := jwk["alg"].(string)
+		keys[kid] = jwksKey{key: key, alg: alg}
+	}
+	return keys, nil
+}
+
+// now returns the current time from the configured clock
+func (v *JWKSVerifier) now() time.Time {
+	if v.Now == nil {
+		return time.Now()
+	}
+	return v.Now()
+}
+
+// orDefault returns d, or def if d is not positive
+func orDefault(d time.Duration, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return d
+}
@@ -0,0 +1,380 @@
+package restplay
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// jwksServer serves a key set that tests can rotate, and counts how often it was fetched
+type jwksServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	keys    []map[string]any
+	status  int
+	fetches int
+}
+
+func newJWKSServer(t *testing.T, keys ...map[string]any) *jwksServer {
+	t.Helper()
+	s := &jwksServer{keys: keys, status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.fetches++
+		if s.status != http.StatusOK {
+			w.WriteHeader(s.status)
+			return
+		}
+		w.Header().Set(contentTypeHeaderKey, jsonContentType)
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": s.keys})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// rotate replaces the served key set
+func (s *jwksServer) rotate(keys ...map[string]any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+// fail makes the server respond with status from now on
+func (s *jwksServer) fail(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+func (s *jwksServer) fetchCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches
+}
+
+// ecJWKS returns the public half of key as a JWK named kid
+func ecJWKS(key *ecdsa.PrivateKey, kid string) map[string]any {
+	x, y := ecJWKMembers(key)
+	return map[string]any{"kty": "EC", "crv": "P-256", "x": x, "y": y, "kid": kid, "use": "sig"}
+}
+
+// rsaJWKS returns the public half of key as a JWK named kid
+func rsaJWKS(key *rsa.PrivateKey, kid string) map[string]any {
+	return map[string]any{
+		"kty": "RSA",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		"kid": kid,
+		"alg": "RS256",
+	}
+}
+
+func TestJWKSVerifier(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate EC key for test: %s", err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key for test: %s", err)
+	}
+	encryptionKey := ecJWKS(ecKey, "robbie-enc")
+	encryptionKey["use"] = "enc"
+
+	claims := map[string]any{"sub": "robbie-sub"}
+	tests := map[string]struct {
+		Keys             []map[string]any
+		Header           map[string]any
+		Key              any
+		ExpectedClientID string
+		ExpectedErr      error
+	}{
+		"should verify an EC signed token by its kid": {
+			Keys:             []map[string]any{rsaJWKS(rsaKey, "robbie-rsa"), ecJWKS(ecKey, "robbie-ec")},
+			Header:           map[string]any{"alg": "ES256", "kid": "robbie-ec"},
+			Key:              ecKey,
+			ExpectedClientID: "robbie-sub",
+		},
+		"should verify an RSA signed token by its kid": {
+			Keys:             []map[string]any{rsaJWKS(rsaKey, "robbie-rsa"), ecJWKS(ecKey, "robbie-ec")},
+			Header:           map[string]any{"alg": "RS256", "kid": "robbie-rsa"},
+			Key:              rsaKey,
+			ExpectedClientID: "robbie-sub",
+		},
+		"should verify a token without kid against the only key": {
+			Keys:             []map[string]any{ecJWKS(ecKey, "robbie-ec")},
+			Header:           map[string]any{"alg": "ES256"},
+			Key:              ecKey,
+			ExpectedClientID: "robbie-sub",
+		},
+		"should reject a token without kid when there are several keys": {
+			Keys:        []map[string]any{rsaJWKS(rsaKey, "robbie-rsa"), ecJWKS(ecKey, "robbie-ec")},
+			Header:      map[string]any{"alg": "ES256"},
+			Key:         ecKey,
+			ExpectedErr: ErrInvalidBearerToken,
+		},
+		"should reject a token naming an unknown kid": {
+			Keys:        []map[string]any{ecJWKS(ecKey, "robbie-ec")},
+			Header:      map[string]any{"alg": "ES256", "kid": "robbie-unknown"},
+			Key:         ecKey,
+			ExpectedErr: ErrInvalidBearerToken,
+		},
+		"should reject a token signed by another key than its kid names": {
+			Keys:        []map[string]any{rsaJWKS(rsaKey, "robbie-rsa"), ecJWKS(ecKey, "robbie-ec")},
+			Header:      map[string]any{"alg": "RS256", "kid": "robbie-ec"},
+			Key:         rsaKey,
+			ExpectedErr: ErrInvalidBearerToken,
+		},
+		"should reject an algorithm the key is restricted against": {
+			Keys:        []map[string]any{rsaJWKS(rsaKey, "robbie-rsa")},
+			Header:      map[string]any{"alg": "PS256", "kid": "robbie-rsa"},
+			Key:         rsaKey,
+			ExpectedErr: ErrInvalidBearerToken,
+		},
+		"should ignore keys meant for encryption": {
+			Keys:        []map[string]any{encryptionKey},
+			Header:      map[string]any{"alg": "ES256", "kid": "robbie-enc"},
+			Key:         ecKey,
+			ExpectedErr: ErrInvalidBearerToken,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := newJWKSServer(t, tc.Keys...)
+			e := &Extractor{Verifier: &JWKSVerifier{URL: server.URL}}
+			req := httptest.NewRequest(http.MethodGet, "https://example.com", nil)
+			req.Header.Set("Authorization", "Bearer "+signJWTWithHeader(t, tc.Header, tc.Key, claims))
+
+			clientID, _, err := e.Extract(req)
+			if tc.ExpectedErr != nil {
+				if !errors.Is(err, tc.ExpectedErr) {
+					t.Errorf("Extract() error = %v, want %v", err, tc.ExpectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("No error expected but got: %q", err)
+			}
+			if clientID != tc.ExpectedClientID {
+				t.Errorf("Extract() = %q, want %q", clientID, tc.ExpectedClientID)
+			}
+		})
+	}
+}
+
+func TestJWKSVerifierRotation(t *testing.T) {
+	oldKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate EC key for test: %s", err)
+	}
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate EC key for test: %s", err)
+	}
+	server := newJWKSServer(t, ecJWKS(oldKey, "robbie-old"))
+	now := time.Unix(1700000000, 0)
+	v := &JWKSVerifier{
+		URL:                server.URL,
+		RefreshInterval:    time.Hour,
+		MinRefreshInterval: time.Minute,
+		Now:                func() time.Time { return now },
+	}
+	claims := map[string]any{"client_id": "robbie-rotated"}
+	oldToken := signJWTWithHeader(t, map[string]any{"alg": "ES256", "kid": "robbie-old"}, oldKey, claims)
+	newToken := signJWTWithHeader(t, map[string]any{"alg": "ES256", "kid": "robbie-new"}, newKey, claims)
+	unknownToken := signJWTWithHeader(t, map[string]any{"alg": "ES256", "kid": "robbie-unknown"}, newKey, claims)
+
+	verify := func(token string, expectedErr error, expectedFetches int) {
+		t.Helper()
+		_, err := v.Verify(token)
+		if expectedErr == nil && err != nil {
+			t.Errorf("No error expected but got: %q", err)
+		}
+		if expectedErr != nil && !errors.Is(err, expectedErr) {
+			t.Errorf("Verify() error = %v, want %v", err, expectedErr)
+		}
+		if fetches := server.fetchCount(); fetches != expectedFetches {
+			t.Errorf("JWKS fetched %d times, want %d", fetches, expectedFetches)
+		}
+	}
+
+	verify(oldToken, nil, 1)
+	verify(oldToken, nil, 1)
+
+	// the provider rotates its keys, which the verifier picks up on the first token naming the new kid
+	server.rotate(ecJWKS(oldKey, "robbie-old"), ecJWKS(newKey, "robbie-new"))
+	now = now.Add(time.Minute)
+	verify(newToken, nil, 2)
+	verify(oldToken, nil, 2)
+
+	// made-up kids must not make the verifier refetch more than once per MinRefreshInterval
+	for range 5 {
+		verify(unknownToken, ErrInvalidBearerToken, 2)
+	}
+	now = now.Add(time.Minute)
+	verify(unknownToken, ErrInvalidBearerToken, 3)
+
+	// once the old key is retired and RefreshInterval passes, its tokens are rejected
+	server.rotate(ecJWKS(newKey, "robbie-new"))
+	now = now.Add(time.Hour)
+	verify(newToken, nil, 4)
+	verify(oldToken, ErrInvalidBearerToken, 4)
+}
+
+func TestJWKSVerifierUnavailable(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate EC key for test: %s", err)
+	}
+	server := newJWKSServer(t, ecJWKS(key, "robbie-ec"))
+	now := time.Unix(1700000000, 0)
+	v := &JWKSVerifier{URL: server.URL, Now: func() time.Time { return now }}
+	e := &Extractor{Verifier: v}
+	token := signJWTWithHeader(t, map[string]any{"alg": "ES256", "kid": "robbie-ec"}, key, map[string]any{"sub": "robbie-sub"})
+	req := httptest.NewRequest(http.MethodGet, "https://example.com", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	if _, _, err = e.Extract(req); err != nil {
+		t.Fatalf("No error expected but got: %q", err)
+	}
+
+	// a key fetched before keeps working while the provider is down
+	server.fail(http.StatusServiceUnavailable)
+	now = now.Add(2 * DefaultJWKSRefreshInterval)
+	if _, _, err = e.Extract(req); err != nil {
+		t.Errorf("No error expected for a known key but got: %q", err)
+	}
+
+	// without any key fetched, the verifier can't tell whether the token is valid
+	e = &Extractor{Verifier: &JWKSVerifier{URL: server.URL}}
+	_, _, err = e.Extract(req)
+	if !errors.Is(err, ErrVerifierUnavailable) {
+		t.Errorf("Extract() error = %v, want %v", err, ErrVerifierUnavailable)
+	}
+	if errors.Is(err, ErrInvalidBearerToken) {
+		t.Errorf("Extract() error = %v, want no %v", err, ErrInvalidBearerToken)
+	}
+	if err != nil && !strings.Contains(err.Error(), "503") {
+		t.Errorf("Extract() error = %q, want it to hold the endpoint's status", err)
+	}
+}
+
+func TestJWKSVerifierConcurrentRefresh(t *testing.T) {
+	knownKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate EC key for test: %s", err)
+	}
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate EC key for test: %s", err)
+	}
+	var (
+		fetches atomic.Int32
+		// once set, fetches hang until it is closed
+		gate    atomic.Pointer[chan struct{}]
+		arrived = make(chan struct{}, 1)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys := []map[string]any{ecJWKS(knownKey, "robbie-known")}
+		if fetches.Add(1) > 1 {
+			keys = append(keys, ecJWKS(newKey, "robbie-new"))
+		}
+		if g := gate.Load(); g != nil {
+			arrived <- struct{}{}
+			select {
+			case <-*g:
+			case <-r.Context().Done():
+			}
+		}
+		w.Header().Set(contentTypeHeaderKey, jsonContentType)
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	}))
+	defer server.Close()
+
+	now := time.Unix(1700000000, 0)
+	var clock sync.Mutex
+	v := &JWKSVerifier{URL: server.URL, Now: func() time.Time {
+		clock.Lock()
+		defer clock.Unlock()
+		return now
+	}}
+	claims := map[string]any{"client_id": "robbie-refreshed"}
+	knownToken := signJWTWithHeader(t, map[string]any{"alg": "ES256", "kid": "robbie-known"}, knownKey, claims)
+	newToken := signJWTWithHeader(t, map[string]any{"alg": "ES256", "kid": "robbie-new"}, newKey, claims)
+
+	if _, err = v.Verify(knownToken); err != nil {
+		t.Fatalf("No error expected but got: %q", err)
+	}
+
+	// the keys go stale and the next fetch hangs until the gate is closed
+	g := make(chan struct{})
+	gate.Store(&g)
+	clock.Lock()
+	now = now.Add(2 * DefaultJWKSRefreshInterval)
+	clock.Unlock()
+
+	const waiters = 5
+	var wg sync.WaitGroup
+	errs := make(chan error, waiters)
+	verifyNew := func() {
+		defer wg.Done()
+		_, err := v.Verify(newToken)
+		errs <- err
+	}
+	wg.Add(1)
+	go verifyNew()
+	<-arrived
+
+	// a known kid is verified with the known key while the refresh is under way
+	done := make(chan error, 1)
+	go func() {
+		_, err := v.Verify(knownToken)
+		done <- err
+	}()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Errorf("No error expected for a known kid during a refresh but got: %q", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("Verify() of a known kid waited for the refresh under way")
+	}
+
+	// a verification waiting for the refresh gives up once its own ctx is done
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = v.VerifyContext(ctx, newToken); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("VerifyContext() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// the remaining verifications share the one fetch under way
+	for range waiters - 1 {
+		wg.Add(1)
+		go verifyNew()
+	}
+	close(g)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("No error expected once the refresh completed but got: %q", err)
+		}
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("JWKS fetched %d times, want 2", n)
+	}
+}
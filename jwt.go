@@ -0,0 +1,141 @@
+package restplay
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// defaultClaimKeys are the JWT claims consulted when an Extractor configures none
+var defaultClaimKeys = []string{clientIDKey, "sub"}
+
+// jwt is a decoded, but not verified, JSON Web Token
+type jwt struct {
+	header       map[string]any
+	claims       map[string]any
+	signingInput string
+	signature    []byte
+}
+
+// parseJWT decodes the three base64url segments of a compact JWT
+func parseJWT(token string) (*jwt, error) {
+	fields := strings.Split(token, ".")
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("%w: expected 3 JWT segments but found %d", ErrInvalidBearerToken, len(fields))
+	}
+	header, err := decodeJWTSegment(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed JWT header: %w", ErrInvalidBearerToken, err)
+	}
+	claims, err := decodeJWTSegment(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed JWT payload: %w", ErrInvalidBearerToken, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(fields[2], "="))
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed JWT signature: %w", ErrInvalidBearerToken, err)
+	}
+	return &jwt{
+		header:       header,
+		claims:       claims,
+		signingInput: fields[0] + "." + fields[1],
+		signature:    signature,
+	}, nil
+}
+
+// decodeJWTSegment base64url-decodes a JWT segment and unmarshals it as a JSON object.
+// Numbers are kept as json.Number so that large numeric claims don't lose precision.
+func decodeJWTSegment(segment string) (map[string]any, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var obj map[string]any
+	if err = dec.Decode(&obj); err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("segment is not a JSON object")
+	}
+	return obj, nil
+}
+
+// clientIDFromClaims returns the first non-empty string claim among keys, each of which may be a claim path
+func clientIDFromClaims(claims map[string]any, keys []string) (string, error) {
+	for _, key := range keys {
+		if clientID, ok := claimAtPath(claims, key).(string); ok && clientID != "" {
+			return clientID, nil
+		}
+	}
+	return "", fmt.Errorf("%w: none of the claims %q hold a client_id", ErrInvalidBearerToken, keys)
+}
+
+// claimAtPath returns the claim named by path, or nil if there is none. The whole path is tried as a key
+// first, so namespaced claims like "https://example.com/claims/client_id" resolve despite their dots.
+// Otherwise the path is split at each dot in turn, e.g. "https://example.com/claims.client_id" or
+// "act.client_id", and the rest resolved within the nested object named by the part before it.
+func claimAtPath(claims map[string]any, path string) any {
+	if claim, ok := claims[path]; ok {
+		return claim
+	}
+	for i := 0; i < len(path); i++ {
+		if path[i] != '.' {
+			continue
+		}
+		if nested, ok := claims[path[:i]].(map[string]any); ok {
+			if claim := claimAtPath(nested, path[i+1:]); claim != nil {
+				return claim
+			}
+		}
+	}
+	return nil
+}
+
+// validateTimeClaims checks the standard "exp" and "nbf" claims, when present, against now.
+// Leeway is granted in both directions to tolerate clock skew between issuer and verifier.
+func validateTimeClaims(claims map[string]any, now time.Time, leeway time.Duration) error {
+	if exp, ok, err := numericDateClaim(claims, "exp"); err != nil {
+		return err
+	} else if ok && !now.Before(exp.Add(leeway)) {
+		return fmt.Errorf("%w: expired at %s", ErrTokenExpired, exp.UTC().Format(time.RFC3339))
+	}
+	if nbf, ok, err := numericDateClaim(claims, "nbf"); err != nil {
+		return err
+	} else if ok && now.Add(leeway).Before(nbf) {
+		return fmt.Errorf("%w: not valid before %s", ErrTokenNotYetValid, nbf.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// numericDateClaim reads a NumericDate (seconds since the epoch) claim, and reports whether it was present
+func numericDateClaim(claims map[string]any, key string) (time.Time, bool, error) {
+	raw, ok := claims[key]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	var seconds float64
+	switch v := raw.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("%w: malformed %q claim: %w", ErrInvalidBearerToken, key, err)
+		}
+		seconds = f
+	case float64:
+		seconds = v
+	case int64:
+		seconds = float64(v)
+	case int:
+		seconds = float64(v)
+	default:
+		return time.Time{}, false, fmt.Errorf("%w: malformed %q claim of type %T", ErrInvalidBearerToken, key, raw)
+	}
+	whole, frac := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(frac*float64(time.Second))), true, nil
+}
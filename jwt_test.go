@@ -0,0 +1,303 @@
+package restplay
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// makeUnsignedJWT builds a compact JWT with the given claims and an empty signature
+func makeUnsignedJWT(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]any{"alg": "none", "typ": "JWT"})
+	if err != nil {
+		t.Fatalf("failed to marshal JWT header for test: %s", err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("failed to marshal JWT claims for test: %s", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+}
+
+func TestExtractorClientIDFromBearerToken(t *testing.T) {
+	tests := map[string]struct {
+		Extractor        Extractor
+		Token            func(t *testing.T) string
+		ExpectedClientID string
+		ExpectedErrorSub string
+	}{
+		"should read the client_id claim from a JWT": {
+			Token: func(t *testing.T) string {
+				return makeUnsignedJWT(t, map[string]any{"client_id": "robbie-jwt-client-id", "sub": "robbie-sub"})
+			},
+			ExpectedClientID: "robbie-jwt-client-id",
+		},
+		"should fall back to the sub claim when client_id is absent": {
+			Token: func(t *testing.T) string {
+				return makeUnsignedJWT(t, map[string]any{"sub": "robbie-sub", "iss": "https://issuer.example.com"})
+			},
+			ExpectedClientID: "robbie-sub",
+		},
+		"should read a configured claim": {
+			Extractor: Extractor{ClaimKeys: []string{"azp"}},
+			Token: func(t *testing.T) string {
+				return makeUnsignedJWT(t, map[string]any{"azp": "robbie-azp", "client_id": "robbie-ignored"})
+			},
+			ExpectedClientID: "robbie-azp",
+		},
+		"should read a claim nested in an object by dotted path": {
+			Extractor: Extractor{ClaimKeys: []string{"act.client_id"}},
+			Token: func(t *testing.T) string {
+				return makeUnsignedJWT(t, map[string]any{"act": map[string]any{"client_id": "robbie-nested"}})
+			},
+			ExpectedClientID: "robbie-nested",
+		},
+		"should read a namespaced claim by its full name": {
+			Extractor: Extractor{ClaimKeys: []string{"https://myco.com/claims/client_id"}},
+			Token: func(t *testing.T) string {
+				return makeUnsignedJWT(t, map[string]any{"https://myco.com/claims/client_id": "robbie-namespaced"})
+			},
+			ExpectedClientID: "robbie-namespaced",
+		},
+		"should read a claim nested under a namespaced object": {
+			Extractor: Extractor{ClaimKeys: []string{"https://myco.com/claims.client.id"}},
+			Token: func(t *testing.T) string {
+				return makeUnsignedJWT(t, map[string]any{
+					"https://myco.com/claims": map[string]any{"client": map[string]any{"id": "robbie-deep"}},
+				})
+			},
+			ExpectedClientID: "robbie-deep",
+		},
+		"should fall back to the next claim key when a path does not resolve": {
+			Extractor: Extractor{ClaimKeys: []string{"act.client_id", "sub"}},
+			Token: func(t *testing.T) string {
+				return makeUnsignedJWT(t, map[string]any{"act": "robbie-not-an-object", "sub": "robbie-sub"})
+			},
+			ExpectedClientID: "robbie-sub",
+		},
+		"should return error when a path resolves to an object": {
+			Extractor: Extractor{ClaimKeys: []string{"act"}},
+			Token: func(t *testing.T) string {
+				return makeUnsignedJWT(t, map[string]any{"act": map[string]any{"client_id": "robbie-nested"}})
+			},
+			ExpectedErrorSub: "invalid token",
+		},
+		"should return error when no configured claim holds a string": {
+			Token: func(t *testing.T) string {
+				return makeUnsignedJWT(t, map[string]any{"client_id": 42, "iss": "https://issuer.example.com"})
+			},
+			ExpectedErrorSub: "invalid token",
+		},
+		"should return error for a JWT with a malformed payload": {
+			Token: func(*testing.T) string {
+				return "eyJhbGciOiJub25lIn0.not-base64!.sig"
+			},
+			ExpectedErrorSub: "malformed JWT payload",
+		},
+		"should accept legacy two-field tokens by default": {
+			Token:            func(*testing.T) string { return "robbie-legacy.othertokenstuffhere" },
+			ExpectedClientID: "robbie-legacy",
+		},
+		"should reject legacy two-field tokens when disabled": {
+			Extractor:        Extractor{DisableLegacyTokens: true},
+			Token:            func(*testing.T) string { return "robbie-legacy.othertokenstuffhere" },
+			ExpectedErrorSub: "invalid token",
+		},
+		"should reject tokens with too many segments": {
+			Token:            func(*testing.T) string { return "a.b.c.d" },
+			ExpectedErrorSub: "invalid token",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			clientID, err := tc.Extractor.ClientIDFromBearerToken(tc.Token(t))
+			if tc.ExpectedErrorSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.ExpectedErrorSub) {
+					t.Errorf("Expected an error that contained: %q but got: %v", tc.ExpectedErrorSub, err)
+				}
+				if !errors.Is(err, ErrInvalidBearerToken) {
+					t.Errorf("Expected error to match ErrInvalidBearerToken but got: %v", err)
+				}
+			} else if err != nil {
+				t.Errorf("No error expected but got: %q", err)
+			}
+			if clientID != tc.ExpectedClientID {
+				t.Errorf("ClientIDFromBearerToken() got = %q, want %q", clientID, tc.ExpectedClientID)
+			}
+		})
+	}
+}
+
+func TestExtractorLegacyTokenFormat(t *testing.T) {
+	tests := map[string]struct {
+		Extractor        Extractor
+		Token            string
+		ExpectedClientID string
+		ExpectedErr      error
+	}{
+		"should read the first field of a colon-delimited token": {
+			Extractor:        Extractor{LegacyTokenSeparator: ":"},
+			Token:            "robbie-colon:robbie-secret",
+			ExpectedClientID: "robbie-colon",
+		},
+		"should trim whitespace around the fields of a colon-delimited token": {
+			Extractor:        Extractor{LegacyTokenSeparator: ":"},
+			Token:            " robbie-colon : robbie-secret ",
+			ExpectedClientID: "robbie-colon",
+		},
+		"should reject a dot-delimited token when the separator is a colon": {
+			Extractor:   Extractor{LegacyTokenSeparator: ":"},
+			Token:       "robbie-dot.robbie-secret",
+			ExpectedErr: ErrInvalidBearerToken,
+		},
+		"should read the first field of a custom three-field layout": {
+			Extractor:        Extractor{LegacyTokenSeparator: "|", LegacyTokenFields: 3},
+			Token:            "robbie-three|robbie-secret|robbie-nonce",
+			ExpectedClientID: "robbie-three",
+		},
+		"should reject too few fields for a custom three-field layout": {
+			Extractor:   Extractor{LegacyTokenSeparator: "|", LegacyTokenFields: 3},
+			Token:       "robbie-three|robbie-secret",
+			ExpectedErr: ErrInvalidBearerToken,
+		},
+		"should reject too many fields for a custom three-field layout": {
+			Extractor:   Extractor{LegacyTokenSeparator: "|", LegacyTokenFields: 3},
+			Token:       "robbie-three|robbie-secret|robbie-nonce|robbie-extra",
+			ExpectedErr: ErrInvalidBearerToken,
+		},
+		"should reject an empty first field": {
+			Extractor:   Extractor{LegacyTokenSeparator: ":"},
+			Token:       ":robbie-secret",
+			ExpectedErr: ErrInvalidBearerToken,
+		},
+		"should reject a custom layout when legacy tokens are disabled": {
+			Extractor:   Extractor{LegacyTokenSeparator: ":", DisableLegacyTokens: true},
+			Token:       "robbie-colon:robbie-secret",
+			ExpectedErr: ErrInvalidBearerToken,
+		},
+		"should accept an empty second field by default": {
+			Token:            "abc.",
+			ExpectedClientID: "abc",
+		},
+		"should reject an empty second field in strict mode": {
+			Extractor:   Extractor{StrictBearerFormat: true},
+			Token:       "abc.",
+			ExpectedErr: ErrInvalidBearerToken,
+		},
+		"should reject an empty middle field of a custom layout in strict mode": {
+			Extractor:   Extractor{LegacyTokenSeparator: "|", LegacyTokenFields: 3, StrictBearerFormat: true},
+			Token:       "robbie-three||robbie-nonce",
+			ExpectedErr: ErrInvalidBearerToken,
+		},
+		"should accept a token with no empty field in strict mode": {
+			Extractor:        Extractor{StrictBearerFormat: true},
+			Token:            "robbie-strict.robbie-secret",
+			ExpectedClientID: "robbie-strict",
+		},
+		"should keep the default two-field dot layout": {
+			Token:            "robbie-dot.robbie-secret",
+			ExpectedClientID: "robbie-dot",
+		},
+		"should still decode a JWT with a custom separator": {
+			Extractor:        Extractor{LegacyTokenSeparator: ":"},
+			Token:            makeUnsignedJWT(t, map[string]any{"client_id": "robbie-jwt"}),
+			ExpectedClientID: "robbie-jwt",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			clientID, err := tc.Extractor.ClientIDFromBearerToken(tc.Token)
+			if !errors.Is(err, tc.ExpectedErr) {
+				t.Errorf("ClientIDFromBearerToken() error = %v, want %v", err, tc.ExpectedErr)
+			}
+			if clientID != tc.ExpectedClientID {
+				t.Errorf("ClientIDFromBearerToken() got = %q, want %q", clientID, tc.ExpectedClientID)
+			}
+		})
+	}
+}
+
+func TestExtractorTokenTimeClaims(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	hmacKey := []byte("robbie-shared-secret")
+
+	tests := map[string]struct {
+		Extractor        Extractor
+		Claims           map[string]any
+		Signed           bool
+		ExpectedClientID string
+		ExpectedErr      error
+	}{
+		"should accept a token expiring in the future": {
+			Extractor:        Extractor{Now: clock},
+			Claims:           map[string]any{"client_id": "robbie-fresh", "exp": now.Add(time.Hour).Unix()},
+			ExpectedClientID: "robbie-fresh",
+		},
+		"should reject a token that expired in the past": {
+			Extractor:   Extractor{Now: clock},
+			Claims:      map[string]any{"client_id": "robbie-stale", "exp": now.Add(-time.Hour).Unix()},
+			ExpectedErr: ErrTokenExpired,
+		},
+		"should reject a verified token that expired in the past": {
+			Extractor:   Extractor{Now: clock, Verifier: &HMACVerifier{Key: hmacKey}},
+			Claims:      map[string]any{"client_id": "robbie-stale", "exp": now.Add(-time.Hour).Unix()},
+			Signed:      true,
+			ExpectedErr: ErrTokenExpired,
+		},
+		"should reject a token expiring exactly now": {
+			Extractor:   Extractor{Now: clock},
+			Claims:      map[string]any{"client_id": "robbie-stale", "exp": now.Unix()},
+			ExpectedErr: ErrTokenExpired,
+		},
+		"should rescue a slightly expired token with leeway": {
+			Extractor:        Extractor{Now: clock, Leeway: time.Minute},
+			Claims:           map[string]any{"client_id": "robbie-skewed", "exp": now.Add(-30 * time.Second).Unix()},
+			ExpectedClientID: "robbie-skewed",
+		},
+		"should rescue a slightly expired verified token with leeway": {
+			Extractor:        Extractor{Now: clock, Leeway: time.Minute, Verifier: &HMACVerifier{Key: hmacKey}},
+			Claims:           map[string]any{"client_id": "robbie-skewed", "exp": now.Add(-30 * time.Second).Unix()},
+			Signed:           true,
+			ExpectedClientID: "robbie-skewed",
+		},
+		"should reject a token not valid until the future": {
+			Extractor:   Extractor{Now: clock},
+			Claims:      map[string]any{"client_id": "robbie-early", "nbf": now.Add(time.Hour).Unix()},
+			ExpectedErr: ErrTokenNotYetValid,
+		},
+		"should rescue a slightly early token with leeway": {
+			Extractor:        Extractor{Now: clock, Leeway: time.Minute},
+			Claims:           map[string]any{"client_id": "robbie-early", "nbf": now.Add(30 * time.Second).Unix()},
+			ExpectedClientID: "robbie-early",
+		},
+		"should reject a malformed exp claim": {
+			Extractor:   Extractor{Now: clock},
+			Claims:      map[string]any{"client_id": "robbie-weird", "exp": "tomorrow"},
+			ExpectedErr: ErrInvalidBearerToken,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			token := makeUnsignedJWT(t, tc.Claims)
+			if tc.Signed {
+				token = signJWT(t, "HS256", hmacKey, tc.Claims)
+			}
+			clientID, err := tc.Extractor.ClientIDFromBearerToken(token)
+			if tc.ExpectedErr != nil {
+				if !errors.Is(err, tc.ExpectedErr) {
+					t.Errorf("Expected error to match %v but got: %v", tc.ExpectedErr, err)
+				}
+			} else if err != nil {
+				t.Errorf("No error expected but got: %q", err)
+			}
+			if clientID != tc.ExpectedClientID {
+				t.Errorf("ClientIDFromBearerToken() got = %q, want %q", clientID, tc.ExpectedClientID)
+			}
+		})
+	}
+}
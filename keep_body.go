@@ -0,0 +1,41 @@
+package restplay
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// ExtractAndKeepBody behaves like GetClientID, but also returns the raw bytes of the request body exactly as they
+// were sent, so that a signature over them (e.g. an HMAC of the body) can be verified without reading it again
+func ExtractAndKeepBody(req *http.Request) (string, []byte, *http.Request, error) {
+	return defaultExtractor.ExtractAndKeepBody(req)
+}
+
+// ExtractAndKeepBody behaves like Extract, but buffers the whole request body first and returns its raw bytes,
+// which are never decompressed. The body is left re-readable from the start whatever the outcome. Bodies larger
+// than MaxBodyBytes fail with ErrBodyTooLarge before any source is consulted.
+func (e *Extractor) ExtractAndKeepBody(req *http.Request) (string, []byte, *http.Request, error) {
+	if req == nil {
+		return "", nil, nil, ErrNilRequest
+	}
+	raw, reset, err := bufferBody(context.Background(), req, e.MaxBodyBytes)
+	if err != nil {
+		return "", nil, req, err
+	}
+	if e.MaxBodyBytes > 0 && int64(len(raw)) > e.MaxBodyBytes {
+		return "", nil, req, fmt.Errorf("%w: body exceeds %d bytes", ErrBodyTooLarge, e.MaxBodyBytes)
+	}
+
+	clientID, extracted, err := e.Extract(req)
+	// the sources may have consumed the body, so it is rewound for whoever verifies the signature next
+	reset()
+	if extracted == nil {
+		extracted = req
+	}
+	extracted.Body = req.Body
+	if err != nil {
+		return "", nil, extracted, err
+	}
+	return clientID, raw, extracted, nil
+}
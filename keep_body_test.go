@@ -0,0 +1,121 @@
+package restplay
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExtractAndKeepBody(t *testing.T) {
+	var gzipped bytes.Buffer
+	w := gzip.NewWriter(&gzipped)
+	_, _ = w.Write([]byte("client_id=robbie-gzip"))
+	_ = w.Close()
+
+	tests := map[string]struct {
+		Extractor        *Extractor
+		ContentType      string
+		Encoding         string
+		Body             func() io.ReadCloser
+		ExpectedClientID string
+		ExpectedBody     string
+		ExpectedErr      error
+	}{
+		"should keep a form body": {
+			ContentType:      formContentType,
+			Body:             func() io.ReadCloser { return io.NopCloser(strings.NewReader("client_id=robbie-form&other=stuff")) },
+			ExpectedClientID: "robbie-form",
+			ExpectedBody:     "client_id=robbie-form&other=stuff",
+		},
+		"should keep a streamed JSON body": {
+			ContentType:      jsonContentType,
+			Body:             func() io.ReadCloser { return streamingBody(`{"client_id": "robbie-json", "amount": 10}`, 5) },
+			ExpectedClientID: "robbie-json",
+			ExpectedBody:     `{"client_id": "robbie-json", "amount": 10}`,
+		},
+		"should keep the compressed bytes of a gzipped body": {
+			ContentType:      formContentType,
+			Encoding:         "gzip",
+			Body:             func() io.ReadCloser { return io.NopCloser(bytes.NewReader(gzipped.Bytes())) },
+			ExpectedClientID: "robbie-gzip",
+			ExpectedBody:     gzipped.String(),
+		},
+		"should handle an absent body": {
+			ContentType:      formContentType,
+			Body:             func() io.ReadCloser { return http.NoBody },
+			ExpectedClientID: "robbie-query",
+		},
+		"should leave the body readable when no client_id is found": {
+			Extractor:    &Extractor{Sources: []ClientIDSource{SourceRequestBody}},
+			ContentType:  formContentType,
+			Body:         func() io.ReadCloser { return io.NopCloser(strings.NewReader("other=stuff")) },
+			ExpectedBody: "other=stuff",
+			ExpectedErr:  ErrMissingClientID,
+		},
+		"should fail for a body beyond MaxBodyBytes": {
+			Extractor:    &Extractor{MaxBodyBytes: 8},
+			ContentType:  formContentType,
+			Body:         func() io.ReadCloser { return io.NopCloser(strings.NewReader("client_id=robbie-large")) },
+			ExpectedBody: "client_id=robbie-large",
+			ExpectedErr:  ErrBodyTooLarge,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "https://example.com?client_id=robbie-query", nil)
+			if err != nil {
+				t.Fatalf("failed to create request for test: %s", err)
+			}
+			req.Body = tc.Body()
+			req.Header.Set(contentTypeHeaderKey, tc.ContentType)
+			if tc.Encoding != "" {
+				req.Header.Set("Content-Encoding", tc.Encoding)
+			}
+
+			var (
+				clientID string
+				raw      []byte
+				after    *http.Request
+			)
+			if tc.Extractor == nil {
+				clientID, raw, after, err = ExtractAndKeepBody(req)
+			} else {
+				clientID, raw, after, err = tc.Extractor.ExtractAndKeepBody(req)
+			}
+			if !errors.Is(err, tc.ExpectedErr) {
+				t.Errorf("ExtractAndKeepBody() error = %v, want %v", err, tc.ExpectedErr)
+			}
+			if clientID != tc.ExpectedClientID {
+				t.Errorf("ExtractAndKeepBody() clientID = %q, want %q", clientID, tc.ExpectedClientID)
+			}
+			if tc.ExpectedErr == nil && string(raw) != tc.ExpectedBody {
+				t.Errorf("ExtractAndKeepBody() body bytes = %q, want %q", raw, tc.ExpectedBody)
+			}
+
+			// whatever the outcome, the body must still yield the original bytes
+			if after.Body == nil {
+				if tc.ExpectedBody != "" {
+					t.Fatalf("ExtractAndKeepBody() left no body, want %q", tc.ExpectedBody)
+				}
+				return
+			}
+			afterBody, err := io.ReadAll(after.Body)
+			if err != nil {
+				t.Fatalf("Unable to read request body after ExtractAndKeepBody(): %s", err)
+			}
+			if string(afterBody) != tc.ExpectedBody {
+				t.Errorf("ExtractAndKeepBody() left body = %q, want %q", afterBody, tc.ExpectedBody)
+			}
+		})
+	}
+}
+
+func TestExtractAndKeepBodyNilRequest(t *testing.T) {
+	if _, _, _, err := ExtractAndKeepBody(nil); !errors.Is(err, ErrNilRequest) {
+		t.Errorf("Expected errors.Is(err, ErrNilRequest) but got: %v", err)
+	}
+}
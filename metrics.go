@@ -0,0 +1,25 @@
+package restplay
+
+import "time"
+
+// MetricsHook observes extractions, e.g. to count how often each source yields the client_id.
+// Implementations must be safe for concurrent use.
+type MetricsHook interface {
+	// ObserveExtraction is called exactly once at the end of every extraction with the source that yielded
+	// the client_id, or SourceNone if extraction failed with err
+	ObserveExtraction(source ClientIDSource, err error, duration time.Duration)
+}
+
+// NopMetricsHook is a MetricsHook that discards every observation
+type NopMetricsHook struct{}
+
+// ObserveExtraction does nothing
+func (NopMetricsHook) ObserveExtraction(ClientIDSource, error, time.Duration) {}
+
+// metricsHook returns the configured MetricsHook, or NopMetricsHook if there is none
+func (e *Extractor) metricsHook() MetricsHook {
+	if e.MetricsHook == nil {
+		return NopMetricsHook{}
+	}
+	return e.MetricsHook
+}
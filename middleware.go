@@ -0,0 +1,93 @@
+package restplay
+
+import (
+	"context"
+	"net/http"
+)
+
+// contextKey is the unexported type for keys this package stores in a context
+type contextKey int
+
+const (
+	// resultContextKey is where Middleware stores the Result of extraction
+	resultContextKey contextKey = iota
+	// requestContextKey is where ContextWithRequest stores the request
+	requestContextKey
+)
+
+// Middleware extracts the client_id from each request using the default extraction rules,
+// stores it in the request context for ClientIDFromContext and ResultFromContext, and forwards the request
+// (with a re-readable body) to next. Requests without a client_id are rejected with 401 Unauthorized.
+func Middleware(next http.Handler) http.Handler {
+	return defaultExtractor.Middleware(next)
+}
+
+// Middleware extracts the client_id from each request, stores it in the request context for
+// ClientIDFromContext and ResultFromContext, and forwards the request (with a re-readable body) to next.
+// If extraction fails, OnFailure is called instead of next.
+func (e *Extractor) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		res, err := e.ExtractResultContext(req.Context(), req)
+		if err != nil {
+			onFailure := e.OnFailure
+			if onFailure == nil {
+				onFailure = unauthorized
+			}
+			onFailure(w, res.Request, err)
+			return
+		}
+		next.ServeHTTP(w, res.Request.WithContext(contextWithResult(res.Request.Context(), res)))
+	})
+}
+
+// EchoHeaderMiddleware returns middleware that extracts the client_id from each request using the default
+// extraction rules, stores it in the request context for ClientIDFromContext and ResultFromContext, and echoes it back in the
+// headerName response header. Extraction is best-effort: requests without a client_id proceed without the header.
+func EchoHeaderMiddleware(headerName string) func(http.Handler) http.Handler {
+	return defaultExtractor.EchoHeaderMiddleware(headerName)
+}
+
+// EchoHeaderMiddleware behaves like the package-level EchoHeaderMiddleware, but extracts with e
+func (e *Extractor) EchoHeaderMiddleware(headerName string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			res, err := e.ExtractResultContext(req.Context(), req)
+			if res.Request != nil {
+				// the body may have been swapped for a re-readable copy, even when extraction failed
+				req = res.Request
+			}
+			if err == nil {
+				w.Header().Set(headerName, res.ClientID)
+				req = req.WithContext(contextWithResult(req.Context(), res))
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// ClientIDFromContext returns the client_id stored by Middleware, and whether one was found.
+// It is a shorthand for the ClientID of ResultFromContext.
+func ClientIDFromContext(ctx context.Context) (ClientID, bool) {
+	res, ok := ResultFromContext(ctx)
+	return ClientID(res.ClientID), ok
+}
+
+// ResultFromContext returns the Result of the extraction stored by Middleware, telling where the client_id was
+// found besides the client_id itself, and whether one was found. Its Request is nil, since the handler holding
+// ctx already has the request.
+func ResultFromContext(ctx context.Context) (Result, bool) {
+	res, ok := ctx.Value(resultContextKey).(Result)
+	return res, ok
+}
+
+// contextWithResult returns a copy of ctx holding the successful res for ResultFromContext
+func contextWithResult(ctx context.Context, res Result) context.Context {
+	// the request would only reference itself from its own context
+	res.Request = nil
+	return context.WithValue(ctx, resultContextKey, res)
+}
+
+// unauthorized is the default failure handler for Middleware
+func unauthorized(w http.ResponseWriter, _ *http.Request, _ error) {
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
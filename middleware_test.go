@@ -0,0 +1,220 @@
+package restplay
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	const baseURL = "https://example.com"
+
+	tests := map[string]struct {
+		Method             string
+		ContentType        string
+		Body               string
+		URL                string
+		ExpectedClientID   string
+		ExpectedSource     ClientIDSource
+		ExpectedMatchedKey string
+		ExpectedStatus     int
+	}{
+		"should pass client_id and a readable body downstream for form POSTs": {
+			Method:             http.MethodPost,
+			ContentType:        formContentType,
+			Body:               "client_id=robbie-middleware-client-id&other=stuff",
+			URL:                baseURL,
+			ExpectedClientID:   "robbie-middleware-client-id",
+			ExpectedSource:     SourceRequestBody,
+			ExpectedMatchedKey: "client_id",
+			ExpectedStatus:     http.StatusOK,
+		},
+		"should pass client_id downstream for URL query requests": {
+			Method:             http.MethodGet,
+			URL:                baseURL + "?client_id=robbie-query-client-id",
+			ExpectedClientID:   "robbie-query-client-id",
+			ExpectedSource:     SourceURLQuery,
+			ExpectedMatchedKey: "client_id",
+			ExpectedStatus:     http.StatusOK,
+		},
+		"should respond 401 when no client_id is found": {
+			Method:         http.MethodGet,
+			URL:            baseURL,
+			ExpectedStatus: http.StatusUnauthorized,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				called         bool
+				actualClientID ClientID
+				actualResult   Result
+				actualBody     []byte
+			)
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				var ok bool
+				if actualClientID, ok = ClientIDFromContext(r.Context()); !ok {
+					t.Error("Expected client_id in the request context")
+				}
+				if actualResult, ok = ResultFromContext(r.Context()); !ok {
+					t.Error("Expected the result in the request context")
+				}
+				var err error
+				if actualBody, err = io.ReadAll(r.Body); err != nil {
+					t.Errorf("Unable to read request body downstream: %s", err)
+				}
+			})
+
+			req := httptest.NewRequest(tc.Method, tc.URL, strings.NewReader(tc.Body))
+			if tc.ContentType != "" {
+				req.Header.Set(contentTypeHeaderKey, tc.ContentType)
+			}
+			rec := httptest.NewRecorder()
+			Middleware(next).ServeHTTP(rec, req)
+
+			if rec.Code != tc.ExpectedStatus {
+				t.Errorf("Middleware status = %d, want %d", rec.Code, tc.ExpectedStatus)
+			}
+			if called != (tc.ExpectedStatus == http.StatusOK) {
+				t.Errorf("Downstream handler called = %t, want %t", called, !called)
+			}
+			if actualClientID.String() != tc.ExpectedClientID {
+				t.Errorf("ClientIDFromContext() got = %q, want %q", actualClientID, tc.ExpectedClientID)
+			}
+			if actualResult.ClientID != actualClientID.String() {
+				t.Errorf("ResultFromContext() ClientID = %q, want %q as ClientIDFromContext()", actualResult.ClientID, actualClientID)
+			}
+			if actualResult.Source != tc.ExpectedSource || actualResult.MatchedKey != tc.ExpectedMatchedKey {
+				t.Errorf("ResultFromContext() got = (%s, %q), want (%s, %q)",
+					actualResult.Source, actualResult.MatchedKey, tc.ExpectedSource, tc.ExpectedMatchedKey)
+			}
+			if actualResult.Request != nil || actualResult.Err != nil {
+				t.Errorf("ResultFromContext() got Request = %v, Err = %v, want neither", actualResult.Request, actualResult.Err)
+			}
+			if called && string(actualBody) != tc.Body {
+				t.Errorf("Downstream body changed:\n  Original: %q\n  After:   %q", tc.Body, actualBody)
+			}
+		})
+	}
+}
+
+func TestExtractorMiddlewareOnFailure(t *testing.T) {
+	var failureErr error
+	e := &Extractor{
+		OnFailure: func(w http.ResponseWriter, _ *http.Request, err error) {
+			failureErr = err
+			w.WriteHeader(http.StatusTeapot)
+		},
+	}
+	next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		t.Error("Downstream handler should not be called on failure")
+	})
+
+	rec := httptest.NewRecorder()
+	e.Middleware(next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "https://example.com", nil))
+
+	if rec.Code != http.StatusTeapot {
+		t.Errorf("Middleware status = %d, want %d", rec.Code, http.StatusTeapot)
+	}
+	if !errors.Is(failureErr, ErrMissingClientID) {
+		t.Errorf("OnFailure error = %v, want %v", failureErr, ErrMissingClientID)
+	}
+}
+
+func TestClientIDFromContextMissing(t *testing.T) {
+	if clientID, ok := ClientIDFromContext(context.Background()); ok || clientID != "" {
+		t.Errorf("ClientIDFromContext() got = %q, %t, want empty and false", clientID, ok)
+	}
+	if res, ok := ResultFromContext(context.Background()); ok || res != (Result{}) {
+		t.Errorf("ResultFromContext() got = %+v, %t, want empty and false", res, ok)
+	}
+}
+
+func TestEchoHeaderMiddleware(t *testing.T) {
+	const (
+		baseURL    = "https://example.com"
+		headerName = "X-Resolved-Client-ID"
+	)
+
+	tests := map[string]struct {
+		Args             argsGetClientID
+		ExpectedClientID string
+	}{
+		"should echo client_id from a form body": {
+			Args: argsGetClientID{
+				Method:      http.MethodPost,
+				ContentType: formContentType,
+				ClientID:    "robbie-echo-form",
+			},
+			ExpectedClientID: "robbie-echo-form",
+		},
+		"should echo client_id from the URL query": {
+			Args:             argsGetClientID{ClientID: "robbie-echo-query"},
+			ExpectedClientID: "robbie-echo-query",
+		},
+		"should echo client_id from basic auth": {
+			Args:             argsGetClientID{ClientID: "robbie-echo-basic", UseBasicAuth: true},
+			ExpectedClientID: "robbie-echo-basic",
+		},
+		"should echo client_id from a bearer token": {
+			Args:             argsGetClientID{ClientID: "robbie-echo-bearer", UseBearerToken: true},
+			ExpectedClientID: "robbie-echo-bearer",
+		},
+		"should omit the header and proceed without any client_id": {
+			Args: argsGetClientID{},
+		},
+		"should omit the header and proceed with an invalid bearer token": {
+			Args: argsGetClientID{UseBearerToken: true},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, bodyAsString, err := setupGetClientID(tc.Args, baseURL)
+			if err != nil {
+				t.Fatalf("failed to create request for test: %s", err)
+			}
+
+			var called bool
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				clientID, ok := ClientIDFromContext(r.Context())
+				if ok != (tc.ExpectedClientID != "") || clientID.String() != tc.ExpectedClientID {
+					t.Errorf("ClientIDFromContext() got = %q, %t, want %q", clientID, ok, tc.ExpectedClientID)
+				}
+				if res, resOK := ResultFromContext(r.Context()); resOK != ok || res.ClientID != clientID.String() {
+					t.Errorf("ResultFromContext() got = %q, %t, want %q, %t", res.ClientID, resOK, clientID, ok)
+				}
+				if r.Body == nil {
+					return
+				}
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Errorf("Unable to read request body downstream: %s", err)
+				}
+				if string(body) != bodyAsString {
+					t.Errorf("Downstream body changed:\n  Original: %q\n  After:   %q", bodyAsString, body)
+				}
+			})
+
+			rec := httptest.NewRecorder()
+			EchoHeaderMiddleware(headerName)(next).ServeHTTP(rec, req)
+
+			if !called {
+				t.Error("Expected the downstream handler to be called")
+			}
+			values := rec.Header().Values(headerName)
+			if tc.ExpectedClientID == "" {
+				if len(values) != 0 {
+					t.Errorf("Expected no %s header but got: %q", headerName, values)
+				}
+			} else if len(values) != 1 || values[0] != tc.ExpectedClientID {
+				t.Errorf("%s header got = %q, want %q", headerName, values, tc.ExpectedClientID)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package restplay
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Option configures an Extractor built by NewExtractor
+type Option func(e *Extractor) error
+
+// NewExtractor returns an Extractor configured by opts, starting from the same defaults as GetClientID.
+// It returns an error if an option is invalid or the resulting configuration could never work.
+func NewExtractor(opts ...Option) (*Extractor, error) {
+	e := &Extractor{MaxBodyBytes: DefaultMaxBodyBytes}
+	for _, opt := range opts {
+		if err := opt(e); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.validate(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// BearerOnly returns an Extractor for endpoints that only ever accept bearer tokens. It skips every other source,
+// so only the Authorization header and the URL query are consulted and the request body is never read.
+func BearerOnly() *Extractor {
+	return &Extractor{Sources: []ClientIDSource{SourceBearerToken}}
+}
+
+// WithSources sets the sources consulted and their order, see Extractor.Sources
+func WithSources(sources ...ClientIDSource) Option {
+	return func(e *Extractor) error {
+		for _, source := range sources {
+			if _, ok := sourceNames[source]; !ok || source == SourceNone {
+				return fmt.Errorf("restplay: unknown source %s", source)
+			}
+		}
+		e.Sources = slices.Clone(sources)
+		return nil
+	}
+}
+
+// WithFormKeys sets the form keys consulted in order, see Extractor.FormKeys
+func WithFormKeys(keys ...string) Option {
+	return func(e *Extractor) error {
+		e.FormKeys = nonBlank(keys)
+		return nil
+	}
+}
+
+// WithHeaderKeys sets the request headers consulted in order, see Extractor.HeaderKeys
+func WithHeaderKeys(keys ...string) Option {
+	return func(e *Extractor) error {
+		e.HeaderKeys = nonBlank(keys)
+		return nil
+	}
+}
+
+// WithCookieNames sets the cookies consulted in order, see Extractor.CookieNames
+func WithCookieNames(names ...string) Option {
+	return func(e *Extractor) error {
+		e.CookieNames = nonBlank(names)
+		return nil
+	}
+}
+
+// WithMaxBodyBytes limits how much of a request body is read, see Extractor.MaxBodyBytes
+func WithMaxBodyBytes(n int64) Option {
+	return func(e *Extractor) error {
+		if n < 0 {
+			return fmt.Errorf("restplay: max body bytes must not be negative but got %d", n)
+		}
+		e.MaxBodyBytes = n
+		return nil
+	}
+}
+
+// WithRejectEmptyBasicAuthPassword sets whether a basic-auth username without a password is rejected
+func WithRejectEmptyBasicAuthPassword(reject bool) Option {
+	return func(e *Extractor) error {
+		e.RejectEmptyBasicAuthPassword = reject
+		return nil
+	}
+}
+
+// WithTokenVerifier sets the verifier every bearer token must pass, see Extractor.Verifier
+func WithTokenVerifier(v TokenVerifier) Option {
+	return func(e *Extractor) error {
+		if v == nil {
+			return fmt.Errorf("restplay: token verifier must not be nil")
+		}
+		e.Verifier = v
+		return nil
+	}
+}
+
+// validate reports configurations that could never find a client_id where they were asked to look
+func (e *Extractor) validate() error {
+	sources := e.sources()
+	usesForm := slices.Contains(sources, SourceURLQuery) || slices.Contains(sources, SourceRequestBody)
+	if usesForm && e.FormKeys != nil && len(e.FormKeys) == 0 {
+		return fmt.Errorf("restplay: form keys must not be empty while a form source is enabled")
+	}
+	return nil
+}
+
+// nonBlank returns a copy of keys without blank entries. The result is never nil, so that an explicitly
+// empty configuration can be told apart from an unset one.
+func nonBlank(keys []string) []string {
+	result := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if strings.TrimSpace(key) != "" {
+			result = append(result, key)
+		}
+	}
+	return result
+}
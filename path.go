@@ -0,0 +1,77 @@
+package restplay
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// fromPath returns the client_id held by a path wildcard named after one of the form keys, or the reason there
+// is none. Wildcards matched by an http.ServeMux pattern are honored first, then PathPattern is matched by hand.
+func (e *Extractor) fromPath(req *http.Request) (string, string) {
+	for _, key := range e.formKeys() {
+		if clientID := req.PathValue(key); clientID != "" {
+			return clientID, ""
+		}
+	}
+	if e.PathPattern == "" {
+		return "", "no path pattern configured"
+	}
+	values, ok := matchPathPattern(e.PathPattern, req.URL.Path)
+	if !ok {
+		return "", fmt.Sprintf("path does not match %q", e.PathPattern)
+	}
+	for _, key := range e.formKeys() {
+		if clientID := values[key]; clientID != "" {
+			return clientID, ""
+		}
+	}
+	return "", fmt.Sprintf("path wildcards %q empty", e.formKeys())
+}
+
+// matchPathPattern matches path against an http.ServeMux style pattern, e.g. "/clients/{client_id}/resources",
+// and returns the values of its wildcards. A leading method is ignored, "{name...}" matches the rest of the
+// path, "{$}" anchors the end, and a trailing slash matches any path below it.
+func matchPathPattern(pattern, path string) (map[string]string, bool) {
+	if method, rest, ok := strings.Cut(pattern, " "); ok && !strings.Contains(method, "/") {
+		pattern = strings.TrimLeft(rest, " \t")
+	}
+	if i := strings.IndexByte(pattern, '/'); i > 0 {
+		// drop the host, since only the path is matched
+		pattern = pattern[i:]
+	}
+
+	patternSegments := strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	values := make(map[string]string)
+	for i, segment := range patternSegments {
+		last := i == len(patternSegments)-1
+		switch {
+		case segment == "{$}" && last:
+			return values, len(pathSegments) == i+1 && pathSegments[i] == ""
+		case segment == "" && last:
+			// a trailing slash matches the directory and everything below it
+			return values, len(pathSegments) > i
+		case strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "...}") && last:
+			if len(pathSegments) < i+1 {
+				return nil, false
+			}
+			values[strings.TrimSuffix(segment[1:], "...}")] = strings.Join(pathSegments[i:], "/")
+			return values, true
+		}
+		if i >= len(pathSegments) {
+			return nil, false
+		}
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if pathSegments[i] == "" {
+				return nil, false
+			}
+			values[segment[1:len(segment)-1]] = pathSegments[i]
+			continue
+		}
+		if segment != pathSegments[i] {
+			return nil, false
+		}
+	}
+	return values, len(pathSegments) == len(patternSegments)
+}
@@ -0,0 +1,125 @@
+package restplay
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExtractorPathPattern(t *testing.T) {
+	tests := map[string]struct {
+		PathPattern      string
+		FormKeys         []string
+		Path             string
+		ExpectedClientID string
+		ExpectedSource   ClientIDSource
+		ExpectedReason   string
+	}{
+		"should find client_id in a path segment": {
+			PathPattern:      "/clients/{client_id}/resources",
+			Path:             "/clients/robbie-path/resources",
+			ExpectedClientID: "robbie-path",
+			ExpectedSource:   SourcePath,
+		},
+		"should ignore a method in the pattern": {
+			PathPattern:      "GET /clients/{client_id}",
+			Path:             "/clients/robbie-path",
+			ExpectedClientID: "robbie-path",
+			ExpectedSource:   SourcePath,
+		},
+		"should use the wildcard named after a configured form key": {
+			PathPattern:      "/tenants/{tenant}/apps/{app_id}",
+			FormKeys:         []string{"app_id"},
+			Path:             "/tenants/acme/apps/robbie-app",
+			ExpectedClientID: "robbie-app",
+			ExpectedSource:   SourcePath,
+		},
+		"should match below a trailing slash": {
+			PathPattern:      "/clients/{client_id}/",
+			Path:             "/clients/robbie-path/resources/42",
+			ExpectedClientID: "robbie-path",
+			ExpectedSource:   SourcePath,
+		},
+		"should match the rest of the path": {
+			PathPattern:      "/files/{client_id...}",
+			Path:             "/files/robbie/path",
+			ExpectedClientID: "robbie/path",
+			ExpectedSource:   SourcePath,
+		},
+		"should not match a longer path without a trailing slash": {
+			PathPattern:    "/clients/{client_id}",
+			Path:           "/clients/robbie-path/resources",
+			ExpectedReason: `path does not match "/clients/{client_id}"`,
+		},
+		"should not match a different literal segment": {
+			PathPattern:    "/clients/{client_id}/resources",
+			Path:           "/users/robbie-path/resources",
+			ExpectedReason: `path does not match "/clients/{client_id}/resources"`,
+		},
+		"should not match an empty wildcard segment": {
+			PathPattern:    "/clients/{client_id}/resources",
+			Path:           "/clients//resources",
+			ExpectedReason: `path does not match "/clients/{client_id}/resources"`,
+		},
+		"should report a pattern without a client_id wildcard": {
+			PathPattern:    "/clients/{id}",
+			Path:           "/clients/robbie-path",
+			ExpectedReason: `path wildcards ["client_id"] empty`,
+		},
+		"should report a missing pattern": {
+			Path:           "/clients/robbie-path",
+			ExpectedReason: "no path pattern configured",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "https://example.com"+tc.Path, nil)
+			if err != nil {
+				t.Fatalf("failed to create request for test: %s", err)
+			}
+
+			e := &Extractor{Sources: []ClientIDSource{SourcePath}, PathPattern: tc.PathPattern, FormKeys: tc.FormKeys}
+			res, err := e.ExtractResult(req)
+			if tc.ExpectedReason != "" {
+				var missing *MissingClientIDError
+				if !errors.As(err, &missing) || !hasAttempt(missing, SourcePath, tc.ExpectedReason) {
+					t.Errorf("Expected a MissingClientIDError with reason %q but got: %v", tc.ExpectedReason, err)
+				}
+			} else if err != nil {
+				t.Errorf("No error expected but got: %q", err)
+			}
+			if res.ClientID != tc.ExpectedClientID {
+				t.Errorf("ExtractResult() ClientID = %q, want %q", res.ClientID, tc.ExpectedClientID)
+			}
+			if res.Source != tc.ExpectedSource {
+				t.Errorf("ExtractResult() Source = %s, want %s", res.Source, tc.ExpectedSource)
+			}
+		})
+	}
+}
+
+func TestGetClientIDServeMuxPathValue(t *testing.T) {
+	var (
+		clientID string
+		source   ClientIDSource
+		err      error
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /clients/{client_id}/resources", func(w http.ResponseWriter, req *http.Request) {
+		var res Result
+		res, err = GetClientIDResult(req)
+		clientID, source = res.ClientID, res.Source
+	})
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/clients/robbie-mux/resources?client_id=robbie-query", nil))
+	if err != nil {
+		t.Fatalf("No error expected but got: %q", err)
+	}
+	if clientID != "robbie-mux" {
+		t.Errorf("GetClientIDResult() ClientID = %q, want %q", clientID, "robbie-mux")
+	}
+	if source != SourcePath {
+		t.Errorf("GetClientIDResult() Source = %s, want %s", source, SourcePath)
+	}
+}
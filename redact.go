@@ -0,0 +1,50 @@
+package restplay
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	// DefaultRedactVisible is how many trailing characters of a client_id Redact leaves visible
+	DefaultRedactVisible = 4
+	// RedactedEmpty stands in for an empty client_id in redacted output
+	RedactedEmpty = "<none>"
+	// redactMask replaces the hidden part of a client_id. It has a fixed width so the length is not revealed.
+	redactMask = "****"
+)
+
+// Redact masks all but the last DefaultRedactVisible characters of clientID so it can be logged,
+// e.g. "robbie-cid1" becomes "****cid1"
+func Redact(clientID string) string {
+	return RedactVisible(clientID, DefaultRedactVisible)
+}
+
+// RedactVisible behaves like Redact, but leaves the last visible characters visible. A client_id no longer than
+// visible is masked entirely, since showing its tail would show all of it. An empty client_id is RedactedEmpty.
+func RedactVisible(clientID string, visible int) string {
+	if clientID == "" {
+		return RedactedEmpty
+	}
+	runes := []rune(clientID)
+	if visible <= 0 || len(runes) <= visible {
+		return redactMask
+	}
+	return redactMask + string(runes[len(runes)-visible:])
+}
+
+// RedactRequest extracts the client_id from req like GetClientID, and returns a summary that is safe to log of
+// which source it came from, e.g. "source=bearer_token client_id=****cid1". It returns the request to use from
+// here on, like GetClientID.
+func RedactRequest(req *http.Request) (string, *http.Request) {
+	res, _ := GetClientIDResult(req)
+	var sb strings.Builder
+	sb.WriteString("source=")
+	sb.WriteString(res.Source.String())
+	sb.WriteString(" client_id=")
+	sb.WriteString(Redact(res.ClientID))
+	if res.Request == nil {
+		return sb.String(), req
+	}
+	return sb.String(), res.Request
+}
@@ -1,108 +1,92 @@
 package restplay
 
 import (
-	"bytes"
+	"context"
 	"errors"
-	"fmt"
-	"io"
-	"mime"
 	"net/http"
 	"net/url"
-	"strings"
 )
 
+// DefaultMaxBodyBytes is the request body limit used by the package-level GetClientID functions
+const DefaultMaxBodyBytes = 1 << 20
+
 const (
-	bearerPrefix         = "Bearer "
-	formContentType      = "application/x-www-form-urlencoded"
-	clientIDKey          = "client_id"
-	contentTypeHeaderKey = "Content-Type"
+	bearerScheme           = "Bearer"
+	formContentType        = "application/x-www-form-urlencoded"
+	jsonContentType        = "application/json"
+	multipartContentType   = "multipart/form-data"
+	eventStreamContentType = "text/event-stream"
+	multipartMaxMemory     = 1 << 20
+	clientIDKey            = "client_id"
+	accessTokenKey         = "access_token"
+	contentTypeHeaderKey   = "Content-Type"
 )
 
 var (
+	// ErrExtraction is wrapped by every other sentinel error in this package, so errors.Is(err, ErrExtraction)
+	// catches any extraction failure while the specific sentinels still tell them apart
+	ErrExtraction = errors.New("restplay: extraction failed")
 	// ErrInvalidBearerToken is returned if a Bearer token is defined but not valid
-	ErrInvalidBearerToken = errors.New("restplay: invalid token")
+	ErrInvalidBearerToken = newExtractionError("restplay: invalid token")
 	// ErrNilRequest is returned if a nil *http.Request is received
-	ErrNilRequest = errors.New("restplay: cannot get client_id from nil request")
+	ErrNilRequest = newExtractionError("restplay: cannot get client_id from nil request")
 	// ErrMissingClientID is the default error returned if no client_id is found
-	ErrMissingClientID = errors.New("restplay: failed to find client_id in request")
+	ErrMissingClientID = newExtractionError("restplay: failed to find client_id in request")
+	// ErrBodyTooLarge is returned if the request body exceeds the configured limit while looking for a client_id
+	ErrBodyTooLarge = newExtractionError("restplay: request body too large")
+	// ErrTokenExpired is returned if a token's "exp" claim has passed
+	ErrTokenExpired = newExtractionError("restplay: token expired")
+	// ErrTokenNotYetValid is returned if a token's "nbf" claim has not yet been reached
+	ErrTokenNotYetValid = newExtractionError("restplay: token not yet valid")
+	// ErrNoCredentials is matched by the error returned if a request carries no credential material at all in the
+	// consulted sources, letting callers tell an anonymous request from one with unusable credentials
+	ErrNoCredentials = newExtractionError("restplay: no credentials in request")
+	// ErrInvalidClientID is returned if a found client_id is rejected by the configured ClientIDValidator
+	ErrInvalidClientID = newExtractionError("restplay: invalid client_id")
+	// ErrClientNotAllowed is returned if a found client_id is not in the configured AllowList
+	ErrClientNotAllowed = newExtractionError("restplay: client_id not allowed")
+	// ErrInsufficientTrust is returned if a client_id is found in a source that ranks below the configured MinTrust
+	ErrInsufficientTrust = newExtractionError("restplay: client_id source insufficiently trusted")
+	// ErrInsecureTransport is returned if an Extractor requires TLS and the request arrived over plaintext HTTP
+	ErrInsecureTransport = newExtractionError("restplay: request did not arrive over TLS")
+	// ErrVerifierUnavailable is returned if the configured TokenVerifier failed without rejecting the token, e.g.
+	// because the auth server could not be reached
+	ErrVerifierUnavailable = newExtractionError("restplay: token verifier unavailable")
+	// ErrDPoPBindingMismatch is returned if a DPoP-bound access token is not bound to the key that signed its
+	// DPoP proof, the proof was not made for that token, or the token is presented as a plain bearer token
+	ErrDPoPBindingMismatch = newExtractionError("restplay: DPoP proof not bound to access token")
+	// ErrMalformedQuery is returned if the URL query that is consulted for the client_id cannot be parsed, e.g.
+	// because of an invalid percent-encoding
+	ErrMalformedQuery = newExtractionError("restplay: malformed URL query")
+	// ErrEmptyBasicAuthPassword is returned if basic auth carries a username but no password and the Extractor
+	// is set to RejectEmptyBasicAuthPassword
+	ErrEmptyBasicAuthPassword = newExtractionError("restplay: basic auth password empty")
 )
 
 // GetClientID will attempt to extract the client_id from the request.
-// It returns the client_id, and possible error.
-func GetClientID(req *http.Request) (string, error) {
-	if req == nil {
-		return "", ErrNilRequest
-	}
-
-	// first attempt basic-auth
-	if clientID, _, ok := req.BasicAuth(); ok && clientID != "" {
-		return clientID, nil
-	}
-
-	// next check bearer token
-	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, bearerPrefix) {
-		return GetClientIDFromBearerToken(strings.TrimPrefix(auth, bearerPrefix))
-	}
-
-	// finally check in the request form
-	// before accessing the form we may need to read the body so
-	switch req.Method {
-	case http.MethodPost, http.MethodPatch, http.MethodPut:
-		// if the content-type is application/x-www-form-urlencoded then we look in the PostForm
-		mimetype, _, _ := mime.ParseMediaType(req.Header.Get(contentTypeHeaderKey))
-		if mimetype == formContentType && req.Body != nil {
-			if req.Form == nil {
-				// here is the only case where we will need to copy the request body
-				bodyBytes, err := io.ReadAll(req.Body)
-				if err != nil {
-					// this fails to reset the body, but not my fault
-					return "", fmt.Errorf("restplay: failed to read request body: %w", err)
-				}
-				// since we had to read the body in order to copy its content,
-				// we must reset it before the following call to ParseForm()
-				req.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-				if err = req.ParseForm(); err != nil {
-					// reset body before returning the error, since the ParseForm() may
-					// have read the body again
-					req.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-					return "", fmt.Errorf("restplay: failed to parse request form from body: %w", err)
-				}
-				// we successfully parsed the form, so we can now reset the body
-				req.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-			}
-		} else {
-			// no need to touch the request body, so this will protect from nil access
-			if req.Form == nil {
-				req.Form = make(url.Values)
-			}
-		}
-	default:
-		if req.Form == nil {
-			// this call to ParseFrom() will not touch the body because the request's method doesn't call for it
-			if err := req.ParseForm(); err != nil {
-				return "", fmt.Errorf("restplay: failed to parse request form from URL: %w", err)
-			}
-		}
-	}
+// It returns the client_id, the request it inspected, and possible error.
+// If the request body had to be read, the returned request carries a fresh,
+// re-readable body with the original bytes, so callers should use it from here on.
+func GetClientID(req *http.Request) (string, *http.Request, error) {
+	return defaultExtractor.Extract(req)
+}
 
-	// it is now safe to access the request's form
-	if clientID := req.Form.Get(clientIDKey); clientID != "" {
-		return clientID, nil
-	}
+// GetClientIDContext behaves like GetClientID, but bounds any read of the request body by ctx.
+// If ctx is cancelled or its deadline passes while the body is being read, the read is
+// aborted and the wrapped ctx.Err() is returned.
+func GetClientIDContext(ctx context.Context, req *http.Request) (string, *http.Request, error) {
+	return defaultExtractor.ExtractContext(ctx, req)
+}
 
-	// all known cases exhausted without finding a client_id
-	return "", ErrMissingClientID
+// GetClientIDFromValues returns the client_id from already parsed values, such as a decoded query string or form,
+// or ErrMissingClientID if there is none
+func GetClientIDFromValues(values url.Values) (string, error) {
+	return defaultExtractor.ClientIDFromValues(values)
 }
 
-// GetClientIDFromBearerToken will attempt to parse/validate the token and return the identity
+// GetClientIDFromBearerToken will attempt to parse/validate the token and return the identity.
+// Three-segment tokens are decoded as JWTs and the client_id is read from the "client_id" claim, falling
+// back to "sub". Legacy two-field tokens of the form "<client_id>.<anything>" are still accepted.
 func GetClientIDFromBearerToken(token string) (string, error) {
-	fields := strings.Split(token, ".")
-	if len(fields) != 2 {
-		return "", ErrInvalidBearerToken
-	}
-	clientID := fields[0]
-	if clientID == "" {
-		return "", ErrInvalidBearerToken
-	}
-	return clientID, nil
+	return defaultExtractor.ClientIDFromBearerToken(token)
 }
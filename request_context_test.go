@@ -1,12 +1,15 @@
 package restplay
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 )
 
 // test case types
@@ -71,7 +74,7 @@ func TestGetClientID(t *testing.T) {
 
 			// Now do the actual thing: GetClientID
 			var actualClientID string
-			actualClientID, err = GetClientID(req)
+			actualClientID, req, err = GetClientID(req)
 
 			// Assert all of our expectations
 			if len(args.ExpectedErrorSub) > 0 {
@@ -111,6 +114,245 @@ func TestGetClientID(t *testing.T) {
 	}
 }
 
+func TestGetClientIDReturnsResetRequest(t *testing.T) {
+	const baseURL = "https://example.com"
+
+	tests := map[string]struct {
+		Body             string
+		ExpectedClientID string
+		ExpectedErrorSub string
+	}{
+		"should return a request with the original body after a successful extraction": {
+			Body:             "client_id=robbie-reset-client-id&other=stuff",
+			ExpectedClientID: "robbie-reset-client-id",
+		},
+		"should return a request with the original body after a missing client_id": {
+			Body:             "other=stuff",
+			ExpectedErrorSub: "failed to find client_id",
+		},
+		"should return a request with the original body after a form parse error": {
+			Body:             "client_id=%zz",
+			ExpectedErrorSub: "failed to parse request form from body",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, baseURL, strings.NewReader(tc.Body))
+			if err != nil {
+				t.Fatalf("failed to create request for test: %s", err)
+			}
+			req.Header.Set(contentTypeHeaderKey, formContentType)
+
+			clientID, actualReq, err := GetClientID(req)
+			if tc.ExpectedErrorSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.ExpectedErrorSub) {
+					t.Errorf("Expected an error that contained: %q but got: %v", tc.ExpectedErrorSub, err)
+				}
+			} else if err != nil {
+				t.Errorf("No error expected but got: %q", err)
+			}
+			if clientID != tc.ExpectedClientID {
+				t.Errorf("GetClientID() got = %q, want %q", clientID, tc.ExpectedClientID)
+			}
+			if actualReq == nil {
+				t.Fatal("GetClientID() returned a nil request")
+			}
+			afterBody, err := io.ReadAll(actualReq.Body)
+			if err != nil {
+				t.Fatalf("Unable to read returned request body: %s", err)
+			}
+			if string(afterBody) != tc.Body {
+				t.Errorf("Returned request body changed:\n  Original: %q\n  After:   %q", tc.Body, afterBody)
+			}
+		})
+	}
+}
+
+func TestGetClientIDNilRequest(t *testing.T) {
+	clientID, req, err := GetClientID(nil)
+	if !errors.Is(err, ErrNilRequest) {
+		t.Errorf("Expected ErrNilRequest but got: %v", err)
+	}
+	if clientID != "" || req != nil {
+		t.Errorf("Expected empty results for nil request but got: %q, %v", clientID, req)
+	}
+}
+
+// slowReader is an endless body that hands out a single byte per delay
+type slowReader struct {
+	delay time.Duration
+	reads int
+}
+
+func (sr *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(sr.delay)
+	sr.reads++
+	if len(p) == 0 {
+		return 0, nil
+	}
+	p[0] = 'a'
+	return 1, nil
+}
+
+func TestGetClientIDContext(t *testing.T) {
+	const baseURL = "https://example.com"
+
+	t.Run("should abort reading a slow body when the context deadline passes", func(t *testing.T) {
+		body := &slowReader{delay: time.Millisecond}
+		req, err := http.NewRequest(http.MethodPost, baseURL, body)
+		if err != nil {
+			t.Fatalf("failed to create request for test: %s", err)
+		}
+		req.Header.Set(contentTypeHeaderKey, formContentType)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		_, _, err = GetClientIDContext(ctx, req)
+		elapsed := time.Since(start)
+
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Expected context.DeadlineExceeded but got: %v", err)
+		}
+		if !strings.Contains(err.Error(), "restplay:") {
+			t.Errorf("Expected a restplay error but got: %q", err)
+		}
+		if elapsed > time.Second {
+			t.Errorf("Expected body read to stop promptly but it took %s", elapsed)
+		}
+	})
+
+	t.Run("should not read the body at all when the context is already cancelled", func(t *testing.T) {
+		body := &slowReader{delay: time.Millisecond}
+		req, err := http.NewRequest(http.MethodPost, baseURL, body)
+		if err != nil {
+			t.Fatalf("failed to create request for test: %s", err)
+		}
+		req.Header.Set(contentTypeHeaderKey, formContentType)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if _, _, err = GetClientIDContext(ctx, req); !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected context.Canceled but got: %v", err)
+		}
+		if body.reads != 0 {
+			t.Errorf("Expected no reads from the body but got %d", body.reads)
+		}
+	})
+
+	t.Run("should extract the client_id when the context is live", func(t *testing.T) {
+		const body = "client_id=robbie-context-client-id"
+		req, err := http.NewRequest(http.MethodPost, baseURL, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("failed to create request for test: %s", err)
+		}
+		req.Header.Set(contentTypeHeaderKey, formContentType)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		clientID, _, err := GetClientIDContext(ctx, req)
+		if err != nil {
+			t.Fatalf("No error expected but got: %q", err)
+		}
+		if clientID != "robbie-context-client-id" {
+			t.Errorf("GetClientIDContext() got = %q, want %q", clientID, "robbie-context-client-id")
+		}
+	})
+}
+
+func TestGetClientIDFromValues(t *testing.T) {
+	tests := map[string]struct {
+		Values           url.Values
+		ExpectedClientID string
+		ExpectedErr      error
+	}{
+		"should find a present client_id": {
+			Values:           url.Values{"client_id": {"robbie-values-client-id"}, "other": {"stuff"}},
+			ExpectedClientID: "robbie-values-client-id",
+		},
+		"should use the first of repeated values": {
+			Values:           url.Values{"client_id": {"robbie-first", "robbie-second"}},
+			ExpectedClientID: "robbie-first",
+		},
+		"should return error on an absent client_id": {
+			Values:      url.Values{"other": {"stuff"}},
+			ExpectedErr: ErrMissingClientID,
+		},
+		"should return error on an empty client_id": {
+			Values:      url.Values{"client_id": {""}},
+			ExpectedErr: ErrMissingClientID,
+		},
+		"should return error on nil values": {
+			ExpectedErr: ErrMissingClientID,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			clientID, err := GetClientIDFromValues(tc.Values)
+			if !errors.Is(err, tc.ExpectedErr) {
+				t.Errorf("GetClientIDFromValues() error = %v, want %v", err, tc.ExpectedErr)
+			}
+			if clientID != tc.ExpectedClientID {
+				t.Errorf("GetClientIDFromValues() got = %q, want %q", clientID, tc.ExpectedClientID)
+			}
+		})
+	}
+}
+
+func TestGetClientIDFromBearerToken(t *testing.T) {
+	tests := map[string]struct {
+		Token            string
+		ExpectedClientID string
+		ExpectedErr      error
+	}{
+		"should find client_id in a legacy token": {
+			Token:            "robbie-token.def",
+			ExpectedClientID: "robbie-token",
+		},
+		"should ignore whitespace around the token": {
+			Token:            "  robbie-token.def\t",
+			ExpectedClientID: "robbie-token",
+		},
+		"should ignore whitespace around the dot": {
+			Token:            " robbie-token . def ",
+			ExpectedClientID: "robbie-token",
+		},
+		"should return error on a client_id field that is blank after trimming": {
+			Token:       "   . def",
+			ExpectedErr: ErrInvalidBearerToken,
+		},
+		"should return error on a fully blank token": {
+			Token:       " \t ",
+			ExpectedErr: ErrInvalidBearerToken,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			clientID, err := GetClientIDFromBearerToken(tc.Token)
+			if !errors.Is(err, tc.ExpectedErr) {
+				t.Errorf("GetClientIDFromBearerToken() error = %v, want %v", err, tc.ExpectedErr)
+			}
+			if clientID != tc.ExpectedClientID {
+				t.Errorf("GetClientIDFromBearerToken() got = %q, want %q", clientID, tc.ExpectedClientID)
+			}
+		})
+	}
+}
+
+func TestExtractorClientIDFromValues(t *testing.T) {
+	e := &Extractor{FormKeys: []string{"clientId", "app_id"}}
+	clientID, err := e.ClientIDFromValues(url.Values{"client_id": {"robbie-ignored"}, "app_id": {"robbie-app-id"}})
+	if err != nil {
+		t.Errorf("No error expected but got: %q", err)
+	}
+	if clientID != "robbie-app-id" {
+		t.Errorf("ClientIDFromValues() got = %q, want %q", clientID, "robbie-app-id")
+	}
+}
+
 func setupGetClientID(args argsGetClientID, baseURL string) (*http.Request, string, error) {
 	var (
 		form         url.Values
@@ -0,0 +1,33 @@
+// Package restplayecho adapts restplay client_id extraction to the Echo web framework.
+package restplayecho
+
+import (
+	"restplay"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ClientID extracts the client_id from the request behind c using the default restplay extraction rules.
+// The inspected request is written back with c.SetRequest, so later Echo binding can still read the body.
+func ClientID(c echo.Context) (string, error) {
+	return ClientIDWith(nil, c)
+}
+
+// ClientIDWith behaves like ClientID, but extracts with e. A nil e uses the default restplay extraction rules.
+func ClientIDWith(e *restplay.Extractor, c echo.Context) (string, error) {
+	var (
+		clientID string
+		req      = c.Request()
+		err      error
+	)
+	if e == nil {
+		clientID, req, err = restplay.GetClientIDContext(req.Context(), req)
+	} else {
+		clientID, req, err = e.ExtractContext(req.Context(), req)
+	}
+	if req != nil {
+		// the body may have been swapped for a re-readable copy, even when extraction failed
+		c.SetRequest(req)
+	}
+	return clientID, err
+}
@@ -0,0 +1,84 @@
+// Package restplayfasthttp adapts restplay client_id extraction to valyala/fasthttp.
+package restplayfasthttp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"restplay"
+
+	"github.com/valyala/fasthttp"
+)
+
+// ClientID extracts the client_id from the fasthttp request using the default restplay extraction rules.
+// fasthttp already holds the whole body in memory, so the post args are handed over pre-parsed and the
+// request body is never buffered or reset.
+func ClientID(ctx *fasthttp.RequestCtx) (string, error) {
+	return ClientIDWith(nil, ctx)
+}
+
+// ClientIDWith behaves like ClientID, but extracts with e. A nil e uses the default restplay extraction rules.
+func ClientIDWith(e *restplay.Extractor, ctx *fasthttp.RequestCtx) (string, error) {
+	req, err := toRequest(ctx)
+	if err != nil {
+		return "", err
+	}
+	var clientID string
+	if e == nil {
+		clientID, _, err = restplay.GetClientIDContext(ctx, req)
+	} else {
+		clientID, _, err = e.ExtractContext(ctx, req)
+	}
+	return clientID, err
+}
+
+// toRequest builds an *http.Request mirroring the headers and arguments of the fasthttp request.
+// Its form is populated up front and its body is empty, so restplay never has to read it.
+func toRequest(ctx *fasthttp.RequestCtx) (*http.Request, error) {
+	header := make(http.Header)
+	ctx.Request.Header.VisitAll(func(key, value []byte) {
+		header.Add(string(key), string(value))
+	})
+
+	query := make(url.Values)
+	ctx.QueryArgs().VisitAll(func(key, value []byte) {
+		query.Add(string(key), string(value))
+	})
+	postForm := make(url.Values)
+	ctx.PostArgs().VisitAll(func(key, value []byte) {
+		postForm.Add(string(key), string(value))
+	})
+
+	req := &http.Request{
+		Method: string(ctx.Method()),
+		URL:    &url.URL{Path: string(ctx.Path()), RawQuery: query.Encode()},
+		Header: header,
+		Body:   http.NoBody,
+		Host:   string(ctx.Host()),
+	}
+	if ctx.Request.IsBodyStream() {
+		// a streamed body has not been read into memory, so leave it alone
+		req.Body = nil
+	}
+	if form, err := ctx.MultipartForm(); err == nil {
+		req.MultipartForm = form
+		for key, values := range form.Value {
+			postForm[key] = append(postForm[key], values...)
+		}
+	} else if !errors.Is(err, fasthttp.ErrNoMultipartForm) {
+		return nil, fmt.Errorf("restplayfasthttp: failed to parse multipart form: %w", err)
+	}
+
+	// as with net/http, body values are listed ahead of the URL values
+	form := make(url.Values, len(postForm)+len(query))
+	for key, values := range postForm {
+		form[key] = append(form[key], values...)
+	}
+	for key, values := range query {
+		form[key] = append(form[key], values...)
+	}
+	req.PostForm, req.Form = postForm, form
+	return req, nil
+}
@@ -0,0 +1,63 @@
+// Package restplaygin adapts restplay client_id extraction to the Gin web framework.
+package restplaygin
+
+import (
+	"net/http"
+
+	"restplay"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContextKey is the Gin context key under which Middleware stores the client_id
+const ContextKey = "client_id"
+
+// Middleware extracts the client_id from each request using the default restplay extraction rules and stores it
+// in the Gin context for ClientID. The request is replaced with the inspected one, so c.Request.Body is still
+// readable downstream. Requests without a client_id are aborted with 401 Unauthorized.
+func Middleware() gin.HandlerFunc {
+	return MiddlewareWith(nil, nil)
+}
+
+// MiddlewareWith behaves like Middleware, but extracts with e and calls onFailure when extraction fails.
+// A nil e uses the default restplay extraction rules, and a nil onFailure aborts with 401 Unauthorized.
+// onFailure is responsible for aborting the chain if the request should not proceed.
+func MiddlewareWith(e *restplay.Extractor, onFailure func(c *gin.Context, err error)) gin.HandlerFunc {
+	if onFailure == nil {
+		onFailure = func(c *gin.Context, _ error) {
+			c.AbortWithStatus(http.StatusUnauthorized)
+		}
+	}
+	return func(c *gin.Context) {
+		var (
+			clientID string
+			req      = c.Request
+			err      error
+		)
+		if e == nil {
+			clientID, req, err = restplay.GetClientIDContext(req.Context(), req)
+		} else {
+			clientID, req, err = e.ExtractContext(req.Context(), req)
+		}
+		if req != nil {
+			// the body may have been swapped for a re-readable copy, even when extraction failed
+			c.Request = req
+		}
+		if err != nil {
+			onFailure(c, err)
+			return
+		}
+		c.Set(ContextKey, clientID)
+		c.Next()
+	}
+}
+
+// ClientID returns the client_id stored by Middleware, and whether one was found
+func ClientID(c *gin.Context) (string, bool) {
+	clientID, ok := c.Get(ContextKey)
+	if !ok {
+		return "", false
+	}
+	s, ok := clientID.(string)
+	return s, ok
+}
@@ -0,0 +1,12 @@
+module restplay/restplaygrpc
+
+go 1.22
+
+require (
+	google.golang.org/grpc v1.64.0
+	restplay v0.0.0
+)
+
+require golang.org/x/sys v0.21.0 // indirect
+
+replace restplay => ..
@@ -0,0 +1,47 @@
+// Package restplaygrpc adapts restplay client_id extraction to gRPC request metadata.
+package restplaygrpc
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"restplay"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// ClientIDMetadataKey is the metadata key consulted after the authorization entry
+const ClientIDMetadataKey = "client-id"
+
+// defaultExtractor checks the authorization entry the same way the HTTP extractor checks the Authorization
+// header, then falls back to the client-id entry. gRPC requests carry no form, so form sources are left out.
+var defaultExtractor = &restplay.Extractor{
+	Sources:    []restplay.ClientIDSource{restplay.SourceBasicAuth, restplay.SourceBearerToken, restplay.SourceHeader},
+	HeaderKeys: []string{ClientIDMetadataKey},
+}
+
+// ClientIDFromIncomingContext returns the client_id from the incoming gRPC metadata in ctx. Basic and bearer
+// credentials in the "authorization" entry are checked first, then the "client-id" entry.
+func ClientIDFromIncomingContext(ctx context.Context) (string, error) {
+	return ClientIDWith(ctx, nil)
+}
+
+// ClientIDWith behaves like ClientIDFromIncomingContext, but extracts with e.
+// Every metadata entry is presented to e as a request header, so e.HeaderKeys name the metadata keys consulted.
+// A nil e uses the package defaults.
+func ClientIDWith(ctx context.Context, e *restplay.Extractor) (string, error) {
+	if e == nil {
+		e = defaultExtractor
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	header := make(http.Header, len(md))
+	for key, values := range md {
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+	req := &http.Request{Method: http.MethodGet, URL: &url.URL{}, Header: header}
+	clientID, _, err := e.ExtractContext(ctx, req)
+	return clientID, err
+}
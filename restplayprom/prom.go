@@ -0,0 +1,101 @@
+// Package restplayprom exports the outcomes of restplay client_id extractions as Prometheus metrics.
+package restplayprom
+
+import (
+	"errors"
+	"time"
+
+	"restplay"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultBuckets are the latency buckets, in seconds, of the extraction duration histogram. They span the
+// microseconds a header lookup takes to the seconds a remote token verifier may need.
+var DefaultBuckets = []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+
+// Collector is both a restplay.MetricsHook and a prometheus.Collector: set it as the MetricsHook of an Extractor
+// and register it with a prometheus.Registerer to export
+//   - restplay_extractions_total{source,result}, counting extractions by the source that yielded the client_id
+//     ("none" on failure) and their result, "success" or the kind of failure, e.g. "missing" or "invalid_token"
+//   - restplay_extraction_duration_seconds{result}, a histogram of how long extractions took
+type Collector struct {
+	extractions *prometheus.CounterVec
+	duration    *prometheus.HistogramVec
+}
+
+// NewCollector returns a Collector whose duration histogram has the DefaultBuckets
+func NewCollector() *Collector {
+	return NewCollectorWithBuckets(DefaultBuckets)
+}
+
+// NewCollectorWithBuckets returns a Collector whose duration histogram has the given buckets, in seconds
+func NewCollectorWithBuckets(buckets []float64) *Collector {
+	return &Collector{
+		extractions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "restplay",
+			Name:      "extractions_total",
+			Help:      "Number of client_id extractions by the source that yielded the client_id and their result.",
+		}, []string{"source", "result"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "restplay",
+			Name:      "extraction_duration_seconds",
+			Help:      "Duration of client_id extractions by their result.",
+			Buckets:   buckets,
+		}, []string{"result"}),
+	}
+}
+
+// ObserveExtraction counts the extraction and records its duration
+func (c *Collector) ObserveExtraction(source restplay.ClientIDSource, err error, duration time.Duration) {
+	result := Result(err)
+	c.extractions.WithLabelValues(source.String(), result).Inc()
+	c.duration.WithLabelValues(result).Observe(duration.Seconds())
+}
+
+// Describe sends the descriptors of the exported metrics to ch
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.extractions.Describe(ch)
+	c.duration.Describe(ch)
+}
+
+// Collect sends the current values of the exported metrics to ch
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.extractions.Collect(ch)
+	c.duration.Collect(ch)
+}
+
+// Result returns the value of the result label for an extraction that failed with err, or "success" if err is
+// nil. Errors are grouped by the restplay sentinel they match, so the label keeps a small set of values.
+func Result(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, restplay.ErrNoCredentials):
+		// checked before ErrMissingClientID, which an error without credentials matches as well
+		return "no_credentials"
+	case errors.Is(err, restplay.ErrMissingClientID):
+		return "missing"
+	case errors.Is(err, restplay.ErrTokenExpired), errors.Is(err, restplay.ErrTokenNotYetValid),
+		errors.Is(err, restplay.ErrInvalidBearerToken), errors.Is(err, restplay.ErrDPoPBindingMismatch):
+		return "invalid_token"
+	case errors.Is(err, restplay.ErrVerifierUnavailable):
+		return "verifier_unavailable"
+	case errors.Is(err, restplay.ErrInvalidClientID):
+		return "invalid_client_id"
+	case errors.Is(err, restplay.ErrClientNotAllowed):
+		return "client_not_allowed"
+	case errors.Is(err, restplay.ErrInsufficientTrust):
+		return "insufficient_trust"
+	case errors.Is(err, restplay.ErrBodyTooLarge):
+		return "body_too_large"
+	case errors.Is(err, restplay.ErrInsecureTransport):
+		return "insecure_transport"
+	case errors.Is(err, restplay.ErrMalformedQuery):
+		return "malformed_query"
+	case errors.Is(err, restplay.ErrEmptyBasicAuthPassword):
+		return "empty_basic_auth_password"
+	default:
+		return "error"
+	}
+}
@@ -0,0 +1,123 @@
+// Package restplaytest builds requests carrying a client_id in each of the styles restplay understands,
+// for use in tests of code that extracts client_ids.
+package restplaytest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+)
+
+// Target is the URL of requests built by NewRequest
+const Target = "https://example.com/"
+
+// Option configures a request built by NewRequest
+type Option func(b *builder)
+
+// builder accumulates the parts of a request until NewRequest assembles them
+type builder struct {
+	method string
+	query  url.Values
+	form   url.Values
+	header http.Header
+}
+
+// NewRequest returns a server-side GET request to Target configured by opts.
+// Form options turn it into a POST with a form-encoded body, unless WithMethod says otherwise.
+func NewRequest(opts ...Option) *http.Request {
+	b := &builder{query: make(url.Values), header: make(http.Header)}
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	target := Target
+	if len(b.query) > 0 {
+		target += "?" + b.query.Encode()
+	}
+	method := b.method
+	var req *http.Request
+	if b.form != nil {
+		if method == "" {
+			method = http.MethodPost
+		}
+		req = httptest.NewRequest(method, target, strings.NewReader(b.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		if method == "" {
+			method = http.MethodGet
+		}
+		req = httptest.NewRequest(method, target, nil)
+	}
+	for key, values := range b.header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	return req
+}
+
+// WithBearerToken returns a request carrying id in a legacy "<client_id>.<anything>" bearer token
+func WithBearerToken(id string) *http.Request {
+	return NewRequest(BearerToken(id + ".restplaytest"))
+}
+
+// WithBasicAuth returns a request carrying id as the basic-auth username
+func WithBasicAuth(id string) *http.Request {
+	return NewRequest(BasicAuth(id, "restplaytest"))
+}
+
+// WithFormClientID returns a POST request carrying id as the client_id of its form-encoded body
+func WithFormClientID(id string) *http.Request {
+	return NewRequest(FormValue("client_id", id))
+}
+
+// WithQueryClientID returns a GET request carrying id as the client_id of its URL query
+func WithQueryClientID(id string) *http.Request {
+	return NewRequest(QueryValue("client_id", id))
+}
+
+// Method sets the request method
+func Method(method string) Option {
+	return func(b *builder) {
+		b.method = method
+	}
+}
+
+// BearerToken sets an Authorization header carrying token with the Bearer scheme
+func BearerToken(token string) Option {
+	return Header("Authorization", "Bearer "+token)
+}
+
+// BasicAuth sets an Authorization header carrying username and password with the Basic scheme
+func BasicAuth(username, password string) Option {
+	return func(b *builder) {
+		req := http.Request{Header: make(http.Header)}
+		req.SetBasicAuth(username, password)
+		b.header.Set("Authorization", req.Header.Get("Authorization"))
+	}
+}
+
+// Header adds a request header
+func Header(key, value string) Option {
+	return func(b *builder) {
+		b.header.Add(key, value)
+	}
+}
+
+// FormValue adds a value to the form-encoded request body
+func FormValue(key, value string) Option {
+	return func(b *builder) {
+		if b.form == nil {
+			b.form = make(url.Values)
+		}
+		b.form.Add(key, value)
+	}
+}
+
+// QueryValue adds a value to the URL query
+func QueryValue(key, value string) Option {
+	return func(b *builder) {
+		b.query.Add(key, value)
+	}
+}
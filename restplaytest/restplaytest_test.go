@@ -0,0 +1,72 @@
+package restplaytest
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"restplay"
+)
+
+func TestBuilders(t *testing.T) {
+	tests := map[string]struct {
+		Request          *http.Request
+		ExpectedClientID string
+		ExpectedSource   restplay.ClientIDSource
+		ExpectedBody     string
+	}{
+		"should build a request with a bearer token": {
+			Request:          WithBearerToken("robbie-bearer"),
+			ExpectedClientID: "robbie-bearer",
+			ExpectedSource:   restplay.SourceBearerToken,
+		},
+		"should build a request with basic auth": {
+			Request:          WithBasicAuth("robbie-basic"),
+			ExpectedClientID: "robbie-basic",
+			ExpectedSource:   restplay.SourceBasicAuth,
+		},
+		"should build a request with a form client_id": {
+			Request:          WithFormClientID("robbie-form"),
+			ExpectedClientID: "robbie-form",
+			ExpectedSource:   restplay.SourceRequestBody,
+			ExpectedBody:     "client_id=robbie-form",
+		},
+		"should build a request with a query client_id": {
+			Request:          WithQueryClientID("robbie-query"),
+			ExpectedClientID: "robbie-query",
+			ExpectedSource:   restplay.SourceURLQuery,
+		},
+		"should combine options": {
+			Request: NewRequest(
+				Method(http.MethodPut),
+				QueryValue("client_id", "robbie-query"),
+				FormValue("client_id", "robbie-form"),
+				FormValue("other", "stuff"),
+			),
+			ExpectedClientID: "robbie-form",
+			ExpectedSource:   restplay.SourceRequestBody,
+			ExpectedBody:     "client_id=robbie-form&other=stuff",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			res, err := restplay.GetClientIDResult(tc.Request)
+			if err != nil {
+				t.Fatalf("No error expected but got: %q", err)
+			}
+			if res.ClientID != tc.ExpectedClientID {
+				t.Errorf("GetClientIDResult() ClientID = %q, want %q", res.ClientID, tc.ExpectedClientID)
+			}
+			if res.Source != tc.ExpectedSource {
+				t.Errorf("GetClientIDResult() Source = %s, want %s", res.Source, tc.ExpectedSource)
+			}
+			body, err := io.ReadAll(res.Request.Body)
+			if err != nil {
+				t.Fatalf("Unable to read request body after GetClientIDResult(): %s", err)
+			}
+			if string(body) != tc.ExpectedBody {
+				t.Errorf("Request body = %q, want %q", body, tc.ExpectedBody)
+			}
+		})
+	}
+}
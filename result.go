@@ -0,0 +1,86 @@
+package restplay
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// ClientIDSource identifies where in a request a client_id was found
+type ClientIDSource int
+
+const (
+	// SourceNone means no client_id was found
+	SourceNone ClientIDSource = iota
+	// SourceBasicAuth means the client_id was the basic-auth username, or password if so configured
+	SourceBasicAuth
+	// SourceBearerToken means the client_id was parsed from a Bearer token
+	SourceBearerToken
+	// SourceURLQuery means the client_id was found in the URL query
+	SourceURLQuery
+	// SourceRequestBody means the client_id was found in the request body
+	SourceRequestBody
+	// SourceHeader means the client_id was found in one of the configured headers
+	SourceHeader
+	// SourceCookie means the client_id was found in one of the configured cookies
+	SourceCookie
+	// SourceClientCert means the client_id was derived from a verified mutual-TLS client certificate
+	SourceClientCert
+	// SourceDigestAuth means the client_id was the username of an HTTP Digest Authorization header
+	SourceDigestAuth
+	// SourcePath means the client_id was a wildcard segment of the URL path
+	SourcePath
+	// SourceSPIFFE means the client_id was derived from the SPIFFE ID of a verified X.509 SVID client certificate
+	SourceSPIFFE
+	// SourceDPoP means the client_id was parsed from a DPoP-bound access token the Verifier accepted and whose proof
+	// of possession checked out
+	SourceDPoP
+	// SourceXFCC means the client_id was derived from a client certificate forwarded by a trusted proxy in the
+	// X-Forwarded-Client-Cert header
+	SourceXFCC
+)
+
+// sourceNames holds the human-readable name of each ClientIDSource
+var sourceNames = map[ClientIDSource]string{
+	SourceNone:        "none",
+	SourceBasicAuth:   "basic_auth",
+	SourceBearerToken: "bearer_token",
+	SourceURLQuery:    "url_query",
+	SourceRequestBody: "request_body",
+	SourceHeader:      "header",
+	SourceCookie:      "cookie",
+	SourceClientCert:  "client_cert",
+	SourceDigestAuth:  "digest_auth",
+	SourcePath:        "path",
+	SourceSPIFFE:      "spiffe",
+	SourceDPoP:        "dpop",
+	SourceXFCC:        "xfcc",
+}
+
+// String returns the name of the source, suitable for logs and audit records
+func (s ClientIDSource) String() string {
+	if name, ok := sourceNames[s]; ok {
+		return name
+	}
+	return "ClientIDSource(" + strconv.Itoa(int(s)) + ")"
+}
+
+// Result is the outcome of a client_id extraction
+type Result struct {
+	// ClientID is the extracted client_id
+	ClientID string
+	// Source is where the client_id was found
+	Source ClientIDSource
+	// MatchedKey is the configured form key, JSON body path, trailer key, header key, or cookie name that held the
+	// client_id.
+	// It is empty for the other sources.
+	MatchedKey string
+	// Request is the inspected request, which carries a re-readable body if the body had to be read
+	Request *http.Request
+	// Err is the error extraction failed with, if any. It is the same error returned alongside the Result.
+	Err error
+}
+
+// GetClientIDResult behaves like GetClientID, but also reports where the client_id was found
+func GetClientIDResult(req *http.Request) (Result, error) {
+	return defaultExtractor.ExtractResult(req)
+}
@@ -0,0 +1,199 @@
+package restplay
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGetClientIDResult(t *testing.T) {
+	const baseURL = "https://example.com"
+
+	tests := map[string]struct {
+		Args           argsGetClientID
+		ExpectedSource ClientIDSource
+	}{
+		"should report the request body for form POSTed requests": {
+			Args: argsGetClientID{
+				Method:      http.MethodPost,
+				ContentType: formContentType,
+				ClientID:    "robbie-client-id",
+			},
+			ExpectedSource: SourceRequestBody,
+		},
+		"should report the URL query for non-body requests": {
+			Args:           argsGetClientID{ClientID: "robbie-other-client-id"},
+			ExpectedSource: SourceURLQuery,
+		},
+		"should report basic auth for BasicAuth requests": {
+			Args:           argsGetClientID{ClientID: "robbie-BasicAuth-client-id", UseBasicAuth: true},
+			ExpectedSource: SourceBasicAuth,
+		},
+		"should report the bearer token for Bearer token requests": {
+			Args:           argsGetClientID{ClientID: "robbie-BearerToken-GET-client-id", UseBearerToken: true},
+			ExpectedSource: SourceBearerToken,
+		},
+		"should report the bearer token for Bearer token PUT requests": {
+			Args: argsGetClientID{
+				Method:         http.MethodPut,
+				ClientID:       "robbie-BearerToken-PUT-client-id",
+				UseBearerToken: true,
+			},
+			ExpectedSource: SourceBearerToken,
+		},
+		"should report no source for GET without any client_id provided": {
+			Args:           argsGetClientID{ExpectedErrorSub: "failed to find client_id"},
+			ExpectedSource: SourceNone,
+		},
+		"should report no source for Bearer token requests without any client_id provided": {
+			Args:           argsGetClientID{UseBearerToken: true, ExpectedErrorSub: "invalid token"},
+			ExpectedSource: SourceNone,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, _, err := setupGetClientID(tc.Args, baseURL)
+			if err != nil {
+				t.Fatalf("failed to create request for test: %s", err)
+			}
+
+			res, err := GetClientIDResult(req)
+			if (err != nil) != (tc.Args.ExpectedErrorSub != "") {
+				t.Errorf("GetClientIDResult() unexpected error state: %v", err)
+			}
+			if res.ClientID != tc.Args.ClientID {
+				t.Errorf("GetClientIDResult() ClientID = %q, want %q", res.ClientID, tc.Args.ClientID)
+			}
+			if res.Source != tc.ExpectedSource {
+				t.Errorf("GetClientIDResult() Source = %s, want %s", res.Source, tc.ExpectedSource)
+			}
+			if res.Request != req {
+				t.Errorf("GetClientIDResult() Request = %p, want %p", res.Request, req)
+			}
+		})
+	}
+}
+
+func TestResultMatchedKey(t *testing.T) {
+	tests := map[string]struct {
+		Extractor          Extractor
+		Method             string
+		URL                string
+		ContentType        string
+		Body               string
+		Setup              func(req *http.Request)
+		ExpectedSource     ClientIDSource
+		ExpectedMatchedKey string
+	}{
+		"should report the second of several form keys in the URL query": {
+			Extractor:          Extractor{FormKeys: []string{"client_id", "app_id", "sdk_id"}},
+			Method:             http.MethodGet,
+			URL:                "https://example.com?app_id=robbie-query",
+			ExpectedSource:     SourceURLQuery,
+			ExpectedMatchedKey: "app_id",
+		},
+		"should report the second of several form keys in a form body": {
+			Extractor:          Extractor{FormKeys: []string{"client_id", "app_id", "sdk_id"}},
+			Method:             http.MethodPost,
+			URL:                "https://example.com",
+			ContentType:        formContentType,
+			Body:               "sdk_id=robbie-third&app_id=robbie-form",
+			ExpectedSource:     SourceRequestBody,
+			ExpectedMatchedKey: "app_id",
+		},
+		"should report the second of several form keys in a JSON body": {
+			Extractor:          Extractor{FormKeys: []string{"client_id", "app_id"}},
+			Method:             http.MethodPost,
+			URL:                "https://example.com",
+			ContentType:        jsonContentType,
+			Body:               `{"app_id":"robbie-json"}`,
+			ExpectedSource:     SourceRequestBody,
+			ExpectedMatchedKey: "app_id",
+		},
+		"should report the JSON body path that matched": {
+			Extractor:          Extractor{JSONBodyPaths: []string{"variables.client_id"}},
+			Method:             http.MethodPost,
+			URL:                "https://example.com",
+			ContentType:        jsonContentType,
+			Body:               `{"variables":{"client_id":"robbie-graphql"}}`,
+			ExpectedSource:     SourceRequestBody,
+			ExpectedMatchedKey: "variables.client_id",
+		},
+		"should report the second of several header keys": {
+			Extractor: Extractor{HeaderKeys: []string{"X-Client-ID", "X-App-ID"}},
+			Method:    http.MethodGet,
+			URL:       "https://example.com",
+			Setup: func(req *http.Request) {
+				req.Header.Set("X-App-ID", "robbie-header")
+			},
+			ExpectedSource:     SourceHeader,
+			ExpectedMatchedKey: "X-App-ID",
+		},
+		"should report the second of several cookie names": {
+			Extractor: Extractor{CookieNames: []string{"client_id", "app_id"}},
+			Method:    http.MethodGet,
+			URL:       "https://example.com",
+			Setup: func(req *http.Request) {
+				req.AddCookie(&http.Cookie{Name: "app_id", Value: "robbie-cookie"})
+			},
+			ExpectedSource:     SourceCookie,
+			ExpectedMatchedKey: "app_id",
+		},
+		"should leave the matched key empty for auth sources": {
+			Method: http.MethodGet,
+			URL:    "https://example.com?client_id=robbie-query",
+			Setup: func(req *http.Request) {
+				req.SetBasicAuth("robbie-basic", "secret")
+			},
+			ExpectedSource: SourceBasicAuth,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.Method, tc.URL, strings.NewReader(tc.Body))
+			if err != nil {
+				t.Fatalf("failed to create request for test: %s", err)
+			}
+			if tc.ContentType != "" {
+				req.Header.Set(contentTypeHeaderKey, tc.ContentType)
+			}
+			if tc.Setup != nil {
+				tc.Setup(req)
+			}
+
+			res, err := tc.Extractor.ExtractResult(req)
+			if err != nil {
+				t.Fatalf("ExtractResult() unexpected error: %v", err)
+			}
+			if res.Source != tc.ExpectedSource {
+				t.Errorf("ExtractResult() Source = %s, want %s", res.Source, tc.ExpectedSource)
+			}
+			if res.MatchedKey != tc.ExpectedMatchedKey {
+				t.Errorf("ExtractResult() MatchedKey = %q, want %q", res.MatchedKey, tc.ExpectedMatchedKey)
+			}
+		})
+	}
+}
+
+func TestClientIDSourceString(t *testing.T) {
+	tests := map[ClientIDSource]string{
+		SourceNone:          "none",
+		SourceBasicAuth:     "basic_auth",
+		SourceBearerToken:   "bearer_token",
+		SourceURLQuery:      "url_query",
+		SourceRequestBody:   "request_body",
+		SourceHeader:        "header",
+		SourceCookie:        "cookie",
+		SourceClientCert:    "client_cert",
+		SourceDigestAuth:    "digest_auth",
+		SourcePath:          "path",
+		SourceSPIFFE:        "spiffe",
+		SourceDPoP:          "dpop",
+		ClientIDSource(999): "ClientIDSource(999)",
+	}
+	for source, expected := range tests {
+		if actual := source.String(); actual != expected {
+			t.Errorf("ClientIDSource(%d).String() = %q, want %q", int(source), actual, expected)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package restplay
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// RoundTripper returns an http.RoundTripper that refuses to send requests without a client_id, as found by
+// the default extraction rules, and otherwise sends them with next. If next is nil, http.DefaultTransport is used.
+func RoundTripper(next http.RoundTripper) http.RoundTripper {
+	return defaultExtractor.RoundTripper(next)
+}
+
+// RoundTripper behaves like the package-level RoundTripper, but extracts with e. A refused request fails with
+// the extraction error before it reaches next, and the source that satisfied each sent request is logged to
+// the Logger at debug level. With RequireTLS, only requests to https URLs are sent.
+//
+// The outgoing request itself is never modified. Its body is only consulted if it can be had again through
+// GetBody, as it can for requests built by http.NewRequest from an in-memory body.
+func (e *Extractor) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		// extraction may parse the form and swap the body, so it works on a copy
+		clone := req.Clone(req.Context())
+		clone.Body = http.NoBody
+		if req.GetBody != nil && req.Body != nil && req.Body != http.NoBody {
+			body, err := req.GetBody()
+			if err != nil {
+				req.Body.Close()
+				return nil, fmt.Errorf("restplay: failed to get outgoing request body: %w", err)
+			}
+			clone.Body = body
+		}
+
+		res, err := e.observedExtractResult(req.Context(), clone, extractMode{outgoing: true})
+		if clone.Body != nil {
+			clone.Body.Close()
+		}
+		if err != nil {
+			// a RoundTripper must close the request body, even on errors
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, fmt.Errorf("restplay: refusing to send request without client_id: %w", err)
+		}
+		if e.Logger != nil {
+			e.Logger.LogAttrs(req.Context(), slog.LevelDebug, "restplay: outgoing request carries client_id",
+				slog.String("source", res.Source.String()))
+		}
+		return next.RoundTrip(req)
+	})
+}
+
+// roundTripperFunc adapts a function to an http.RoundTripper
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req)
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,48 @@
+package restplay
+
+import (
+	"crypto/x509"
+	"net/http"
+	"net/url"
+)
+
+// spiffeScheme is the URI scheme of SPIFFE IDs
+const spiffeScheme = "spiffe"
+
+// fromSPIFFE maps the SPIFFE ID of a verified X.509 SVID to the client_id, or returns the reason there is none.
+// As with SourceClientCert, certificates that were presented but not verified by the server are never trusted.
+func (e *Extractor) fromSPIFFE(req *http.Request) (string, string) {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.PeerCertificates) == 0 {
+		return "", "no verified client certificate"
+	}
+	id, reason := spiffeID(req.TLS.PeerCertificates[0])
+	if id == nil {
+		return "", reason
+	}
+	if e.SPIFFEClientID == nil {
+		return id.String(), ""
+	}
+	if clientID := e.SPIFFEClientID(id); clientID != "" {
+		return clientID, ""
+	}
+	return "", "SPIFFE ID mapped to empty client_id"
+}
+
+// spiffeID returns the SPIFFE ID URI SAN of cert, or the reason there is none. An X.509 SVID carries exactly one
+// SPIFFE ID, so a certificate with several is not treated as an SVID at all.
+func spiffeID(cert *x509.Certificate) (*url.URL, string) {
+	var id *url.URL
+	for _, uri := range cert.URIs {
+		if uri.Scheme != spiffeScheme || uri.Host == "" {
+			continue
+		}
+		if id != nil {
+			return nil, "multiple SPIFFE IDs in client certificate"
+		}
+		id = uri
+	}
+	if id == nil {
+		return nil, "no SPIFFE ID in client certificate"
+	}
+	return id, ""
+}
@@ -0,0 +1,103 @@
+package restplay
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestExtractorSPIFFE(t *testing.T) {
+	mustParse := func(rawURL string) *url.URL {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			t.Fatalf("failed to parse URL for test: %s", err)
+		}
+		return u
+	}
+	verified := func(uris ...string) *tls.ConnectionState {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: "robbie-cn"}}
+		for _, uri := range uris {
+			cert.URIs = append(cert.URIs, mustParse(uri))
+		}
+		return &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert},
+			VerifiedChains:   [][]*x509.Certificate{{cert}},
+		}
+	}
+
+	tests := map[string]struct {
+		Mapper           func(id *url.URL) string
+		TLS              *tls.ConnectionState
+		ExpectedClientID string
+		ExpectedReason   string
+	}{
+		"should use the full SPIFFE ID by default": {
+			TLS:              verified("spiffe://example.org/ns/prod/sa/robbie-workload"),
+			ExpectedClientID: "spiffe://example.org/ns/prod/sa/robbie-workload",
+		},
+		"should map the SPIFFE ID with the configured function": {
+			Mapper: func(id *url.URL) string {
+				return id.Path[strings.LastIndex(id.Path, "/")+1:]
+			},
+			TLS:              verified("spiffe://example.org/ns/prod/sa/robbie-workload"),
+			ExpectedClientID: "robbie-workload",
+		},
+		"should find the SPIFFE ID among other URI SANs": {
+			TLS:              verified("urn:example:client:robbie-ignored", "spiffe://example.org/robbie-workload"),
+			ExpectedClientID: "spiffe://example.org/robbie-workload",
+		},
+		"should skip a certificate without a SPIFFE ID": {
+			TLS:            verified("urn:example:client:robbie-ignored"),
+			ExpectedReason: "no SPIFFE ID in client certificate",
+		},
+		"should skip a certificate with several SPIFFE IDs": {
+			TLS:            verified("spiffe://example.org/a", "spiffe://example.org/b"),
+			ExpectedReason: "multiple SPIFFE IDs in client certificate",
+		},
+		"should skip a SPIFFE ID mapped to nothing": {
+			Mapper:         func(*url.URL) string { return "" },
+			TLS:            verified("spiffe://example.org/robbie-workload"),
+			ExpectedReason: "SPIFFE ID mapped to empty client_id",
+		},
+		"should skip plaintext requests": {
+			ExpectedReason: "no verified client certificate",
+		},
+		"should skip certificates that were not verified": {
+			TLS: &tls.ConnectionState{
+				PeerCertificates: verified("spiffe://example.org/robbie-workload").PeerCertificates,
+			},
+			ExpectedReason: "no verified client certificate",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "https://example.com", nil)
+			if err != nil {
+				t.Fatalf("failed to create request for test: %s", err)
+			}
+			req.TLS = tc.TLS
+
+			e := &Extractor{Sources: []ClientIDSource{SourceSPIFFE}, SPIFFEClientID: tc.Mapper}
+			res, err := e.ExtractResult(req)
+			if tc.ExpectedReason != "" {
+				var missing *MissingClientIDError
+				if !errors.As(err, &missing) || !hasAttempt(missing, SourceSPIFFE, tc.ExpectedReason) {
+					t.Errorf("Expected a MissingClientIDError with reason %q but got: %v", tc.ExpectedReason, err)
+				}
+			} else if err != nil {
+				t.Errorf("No error expected but got: %q", err)
+			}
+			if res.ClientID != tc.ExpectedClientID {
+				t.Errorf("ExtractResult() ClientID = %q, want %q", res.ClientID, tc.ExpectedClientID)
+			}
+			if tc.ExpectedClientID != "" && res.Source != SourceSPIFFE {
+				t.Errorf("ExtractResult() Source = %s, want %s", res.Source, SourceSPIFFE)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package restplay
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// StripCredentials returns a copy of req without the credentials the package-level functions read the
+// client_id from, as a gateway may want before forwarding the request upstream
+func StripCredentials(req *http.Request) *http.Request {
+	return defaultExtractor.StripCredentials(req)
+}
+
+// StripCredentials returns a copy of req without the Authorization header, also the Proxy-Authorization header
+// if IncludeProxyAuthorization is set, and with the form keys, NestedFormKeys, TokenQueryKeys, and
+// access_token parameter deleted from the URL query and from form-encoded bodies. All other headers and fields
+// are kept. Form bodies are rebuilt without the deleted fields, while req.Body is left yielding the original
+// bytes. A form body that is compressed, larger than MaxBodyBytes, or fails to be read or parsed is left as it
+// is, as are multipart and JSON bodies, which the copy shares with req just like http.Request.Clone does.
+func (e *Extractor) StripCredentials(req *http.Request) *http.Request {
+	if req == nil {
+		return nil
+	}
+	stripped := req.Clone(req.Context())
+	stripped.Header.Del("Authorization")
+	if e.IncludeProxyAuthorization {
+		stripped.Header.Del("Proxy-Authorization")
+	}
+
+	keys := slices.Concat(e.valuesKeys(), e.tokenQueryKeys())
+	if query := stripped.URL.Query(); e.deleteFormKeys(query, keys) {
+		stripped.URL.RawQuery = query.Encode()
+	}
+	// the copy of an already parsed form must not hand the fields back either
+	e.deleteFormKeys(stripped.Form, keys)
+	e.deleteFormKeys(stripped.PostForm, keys)
+
+	mimetype, _, _ := mime.ParseMediaType(req.Header.Get(contentTypeHeaderKey))
+	if encoding, _ := contentEncoding(req); mimetype != formContentType || encoding != "" {
+		return stripped
+	}
+	bodyBytes, _, err := bufferBody(req.Context(), req, e.MaxBodyBytes)
+	// the copy shares the body of req, which bufferBody has just replaced
+	stripped.Body = req.Body
+	if err != nil || (e.MaxBodyBytes > 0 && int64(len(bodyBytes)) > e.MaxBodyBytes) || bodyBytes == nil {
+		return stripped
+	}
+	values, err := url.ParseQuery(string(bodyBytes))
+	if err != nil || !e.deleteFormKeys(values, keys) {
+		stripped.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+		return stripped
+	}
+
+	body := values.Encode()
+	stripped.Body = io.NopCloser(strings.NewReader(body))
+	stripped.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(body)), nil
+	}
+	stripped.ContentLength = int64(len(body))
+	stripped.TransferEncoding = nil
+	return stripped
+}
+
+// deleteFormKeys deletes each of keys from values, along with the keys matching it case-insensitively if
+// CaseInsensitiveFormKeys is set, and reports whether anything was deleted
+func (e *Extractor) deleteFormKeys(values url.Values, keys []string) bool {
+	var deleted bool
+	for _, key := range keys {
+		for _, k := range e.matchingFormKeys(values, key) {
+			if _, ok := values[k]; ok {
+				delete(values, k)
+				deleted = true
+			}
+		}
+	}
+	return deleted
+}
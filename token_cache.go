@@ -0,0 +1,133 @@
+package restplay
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// DefaultTokenCacheTTL is how long an Extractor caches the client_id of a verified token that does not say when
+// it expires, so that a token revoked since is not honored forever
+const DefaultTokenCacheTTL = 5 * time.Minute
+
+// TokenCache remembers the client_id resolved from a bearer token, so that a configured Verifier is not
+// invoked again for the same token. Implementations must be safe for concurrent use.
+type TokenCache interface {
+	// Get returns the client_id cached for token, and whether there was an unexpired entry
+	Get(token string) (clientID string, ok bool)
+	// Set caches the client_id resolved from token. A positive ttl is how long the token remains valid, or how
+	// long to trust one that did not say; zero means no limit was given.
+	Set(token, clientID string, ttl time.Duration)
+	// Close flushes the cache and releases its resources, e.g. on shutdown. The cache must not be used afterwards.
+	Close() error
+}
+
+// Close releases the resources of the TokenCache, if any, and is meant to be called on shutdown once the
+// Extractor is no longer in use
+func (e *Extractor) Close() error {
+	if e.TokenCache == nil {
+		return nil
+	}
+	return e.TokenCache.Close()
+}
+
+// LRUTokenCache is an in-memory TokenCache holding a bounded number of entries, evicting the least recently
+// used entry once full
+type LRUTokenCache struct {
+	size int
+	ttl  time.Duration
+	// now returns the current time, and is replaced in tests
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+	closed  bool
+}
+
+// lruEntry is the value of each element in LRUTokenCache.order
+type lruEntry struct {
+	token    string
+	clientID string
+	expires  time.Time
+}
+
+// NewLRUTokenCache returns a cache holding at most size entries. Each entry is kept for at most ttl, or until
+// its token expires if that is sooner; a ttl of zero keeps entries until their token expires or they are evicted.
+func NewLRUTokenCache(size int, ttl time.Duration) *LRUTokenCache {
+	return &LRUTokenCache{
+		size:    max(size, 1),
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Get returns the client_id cached for token, and whether there was an unexpired entry
+func (c *LRUTokenCache) Get(token string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[token]
+	if !ok {
+		return "", false
+	}
+	entry := elem.Value.(*lruEntry)
+	if !entry.expires.IsZero() && !c.now().Before(entry.expires) {
+		c.remove(elem)
+		return "", false
+	}
+	c.order.MoveToFront(elem)
+	return entry.clientID, true
+}
+
+// Set caches the client_id resolved from token for the shorter of ttl and the cache's own TTL
+func (c *LRUTokenCache) Set(token, clientID string, ttl time.Duration) {
+	if ttl <= 0 || (c.ttl > 0 && c.ttl < ttl) {
+		ttl = c.ttl
+	}
+	var expires time.Time
+	if ttl > 0 {
+		expires = c.now().Add(ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		// requests still in flight during shutdown must not fill the cache up again
+		return
+	}
+	if elem, ok := c.entries[token]; ok {
+		entry := elem.Value.(*lruEntry)
+		entry.clientID, entry.expires = clientID, expires
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[token] = c.order.PushFront(&lruEntry{token: token, clientID: clientID, expires: expires})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// Len returns the number of cached entries, including expired ones not yet evicted
+func (c *LRUTokenCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Close drops every entry. A closed cache stays empty, as further entries are not kept.
+func (c *LRUTokenCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	clear(c.entries)
+	c.order.Init()
+	return nil
+}
+
+// remove drops elem from the cache; c.mu must be held
+func (c *LRUTokenCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*lruEntry).token)
+}
@@ -0,0 +1,223 @@
+package restplay
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// countingVerifier returns fixed claims and counts how often it was invoked
+type countingVerifier struct {
+	claims map[string]any
+	calls  int
+}
+
+func (v *countingVerifier) Verify(string) (map[string]any, error) {
+	v.calls++
+	if v.claims == nil {
+		return nil, ErrInvalidBearerToken
+	}
+	return v.claims, nil
+}
+
+func TestExtractorTokenCache(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	clock := func() time.Time { return now }
+
+	tests := map[string]struct {
+		Claims           map[string]any
+		Advance          time.Duration
+		ExpectedClientID string
+		ExpectedCalls    int
+		ExpectedErr      error
+	}{
+		"should not call the verifier again for the same token": {
+			Claims:           map[string]any{"client_id": "robbie-cached"},
+			ExpectedClientID: "robbie-cached",
+			ExpectedCalls:    1,
+		},
+		"should verify again once the token's exp has passed": {
+			Claims:        map[string]any{"client_id": "robbie-cached", "exp": float64(now.Add(time.Minute).Unix())},
+			Advance:       2 * time.Minute,
+			ExpectedErr:   ErrTokenExpired,
+			ExpectedCalls: 2,
+		},
+		"should verify again once the cache's TTL has passed": {
+			Claims:           map[string]any{"client_id": "robbie-cached"},
+			Advance:          2 * time.Hour,
+			ExpectedClientID: "robbie-cached",
+			ExpectedCalls:    2,
+		},
+		"should not cache rejected tokens": {
+			ExpectedErr:   ErrInvalidBearerToken,
+			ExpectedCalls: 2,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			now = time.Unix(1_700_000_000, 0)
+			verifier := &countingVerifier{claims: tc.Claims}
+			cache := NewLRUTokenCache(10, time.Hour)
+			cache.now = clock
+			e := &Extractor{Verifier: verifier, TokenCache: cache, Now: clock}
+
+			var (
+				clientID string
+				err      error
+			)
+			for i := 0; i < 2; i++ {
+				if i == 1 {
+					now = now.Add(tc.Advance)
+				}
+				clientID, err = e.ClientIDFromBearerToken("opaque-token")
+			}
+			if !errors.Is(err, tc.ExpectedErr) {
+				t.Errorf("ClientIDFromBearerToken() error = %v, want %v", err, tc.ExpectedErr)
+			}
+			if clientID != tc.ExpectedClientID {
+				t.Errorf("ClientIDFromBearerToken() got = %q, want %q", clientID, tc.ExpectedClientID)
+			}
+			if verifier.calls != tc.ExpectedCalls {
+				t.Errorf("Verify() called %d times, want %d", verifier.calls, tc.ExpectedCalls)
+			}
+		})
+	}
+}
+
+// ttlRecordingCache is a TokenCache that records the ttl of every Set and never finds an entry
+type ttlRecordingCache struct {
+	ttls []time.Duration
+}
+
+func (c *ttlRecordingCache) Get(string) (string, bool) { return "", false }
+
+func (c *ttlRecordingCache) Set(_, _ string, ttl time.Duration) { c.ttls = append(c.ttls, ttl) }
+
+func (c *ttlRecordingCache) Close() error { return nil }
+
+func TestExtractorTokenCacheTTL(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+
+	tests := map[string]struct {
+		Claims       map[string]any
+		Leeway       time.Duration
+		ExpectedTTLs []time.Duration
+	}{
+		"should cache a token until its exp as of its validation": {
+			Claims:       map[string]any{"client_id": "robbie-cached", "exp": float64(start.Add(time.Second).Unix())},
+			ExpectedTTLs: []time.Duration{time.Second},
+		},
+		"should add the leeway to the exp": {
+			Claims:       map[string]any{"client_id": "robbie-cached", "exp": float64(start.Unix())},
+			Leeway:       time.Second,
+			ExpectedTTLs: []time.Duration{time.Second},
+		},
+		"should cache a token without exp for the DefaultTokenCacheTTL": {
+			Claims:       map[string]any{"client_id": "robbie-cached"},
+			ExpectedTTLs: []time.Duration{DefaultTokenCacheTTL},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// every reading of the clock advances it past the token's exp
+			now := start
+			clock := func() time.Time {
+				defer func() { now = now.Add(time.Second) }()
+				return now
+			}
+			cache := &ttlRecordingCache{}
+			e := &Extractor{Verifier: &countingVerifier{claims: tc.Claims}, TokenCache: cache, Now: clock, Leeway: tc.Leeway}
+			if _, err := e.ClientIDFromBearerToken("opaque-token"); err != nil {
+				t.Fatalf("No error expected but got: %q", err)
+			}
+			if !slices.Equal(cache.ttls, tc.ExpectedTTLs) {
+				t.Errorf("Set() ttls = %v, want %v", cache.ttls, tc.ExpectedTTLs)
+			}
+		})
+	}
+}
+
+func TestLRUTokenCacheEviction(t *testing.T) {
+	cache := NewLRUTokenCache(2, 0)
+	cache.Set("token-a", "robbie-a", 0)
+	cache.Set("token-b", "robbie-b", 0)
+	// touching token-a leaves token-b as the least recently used
+	if _, ok := cache.Get("token-a"); !ok {
+		t.Fatalf("Get(%q) missed", "token-a")
+	}
+	cache.Set("token-c", "robbie-c", 0)
+
+	if _, ok := cache.Get("token-b"); ok {
+		t.Errorf("Get(%q) hit after it should have been evicted", "token-b")
+	}
+	for token, expected := range map[string]string{"token-a": "robbie-a", "token-c": "robbie-c"} {
+		if clientID, ok := cache.Get(token); !ok || clientID != expected {
+			t.Errorf("Get(%q) = %q, %t, want %q, true", token, clientID, ok, expected)
+		}
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", cache.Len())
+	}
+}
+
+// closeRecordingCache is a TokenCache that records whether it was closed
+type closeRecordingCache struct {
+	LRUTokenCache
+	closed bool
+	err    error
+}
+
+func (c *closeRecordingCache) Close() error {
+	c.closed = true
+	return c.err
+}
+
+func TestExtractorClose(t *testing.T) {
+	closeErr := errors.New("robbie-flush-failed")
+	tests := map[string]struct {
+		Cache       *closeRecordingCache
+		ExpectedErr error
+	}{
+		"should close nothing without a token cache": {},
+		"should close the token cache": {
+			Cache: &closeRecordingCache{},
+		},
+		"should return the error of closing the token cache": {
+			Cache:       &closeRecordingCache{err: closeErr},
+			ExpectedErr: closeErr,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			e := &Extractor{}
+			if tc.Cache != nil {
+				e.TokenCache = tc.Cache
+			}
+			if err := e.Close(); !errors.Is(err, tc.ExpectedErr) {
+				t.Errorf("Close() error = %v, want %v", err, tc.ExpectedErr)
+			}
+			if tc.Cache != nil && !tc.Cache.closed {
+				t.Error("Close() did not close the token cache")
+			}
+		})
+	}
+}
+
+func TestLRUTokenCacheClose(t *testing.T) {
+	cache := NewLRUTokenCache(10, time.Minute)
+	cache.Set("robbie-token", "robbie-cached", 0)
+	if err := cache.Close(); err != nil {
+		t.Fatalf("No error expected but got: %q", err)
+	}
+	if n := cache.Len(); n != 0 {
+		t.Errorf("Len() = %d after Close(), want 0", n)
+	}
+	if _, ok := cache.Get("robbie-token"); ok {
+		t.Error("Get() found an entry after Close()")
+	}
+	cache.Set("robbie-late-token", "robbie-late", 0)
+	if _, ok := cache.Get("robbie-late-token"); ok {
+		t.Error("Get() found an entry set after Close()")
+	}
+}
@@ -0,0 +1,106 @@
+package restplay
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// TraceOutcome is what came of consulting a source during a traced extraction
+type TraceOutcome int
+
+const (
+	// OutcomeSkipped means the source was never consulted because an earlier source decided the extraction
+	OutcomeSkipped TraceOutcome = iota
+	// OutcomeFound means the source yielded the client_id
+	OutcomeFound
+	// OutcomeEmpty means the source was consulted but held no client_id
+	OutcomeEmpty
+	// OutcomeErrored means the source failed extraction, e.g. with an invalid bearer token or a rejected client_id
+	OutcomeErrored
+)
+
+// outcomeNames holds the human-readable name of each TraceOutcome
+var outcomeNames = map[TraceOutcome]string{
+	OutcomeSkipped: "skipped",
+	OutcomeFound:   "found",
+	OutcomeEmpty:   "empty",
+	OutcomeErrored: "errored",
+}
+
+// String returns the name of the outcome
+func (o TraceOutcome) String() string {
+	if name, ok := outcomeNames[o]; ok {
+		return name
+	}
+	return "TraceOutcome(" + strconv.Itoa(int(o)) + ")"
+}
+
+// TraceEntry records what came of consulting one source
+type TraceEntry struct {
+	// Source is the source that was consulted
+	Source ClientIDSource
+	// Outcome is what came of consulting it
+	Outcome TraceOutcome
+	// Reason describes why an empty source held no client_id
+	Reason string
+	// Err is the error an errored source failed with
+	Err error
+}
+
+// ExtractionTrace is the full decision trace of an extraction
+type ExtractionTrace struct {
+	// Entries holds one entry per configured source, in the order the sources are configured
+	Entries []TraceEntry
+	// ClientID is the extracted client_id, if any
+	ClientID string
+	// Source is where the client_id was found, or SourceNone
+	Source ClientIDSource
+}
+
+// Trace extracts the client_id like GetClientID, but reports what came of every source along the way.
+// It is heavier than GetClientID and meant for debugging endpoints, not the hot path.
+func Trace(req *http.Request) (ExtractionTrace, error) {
+	return defaultExtractor.Trace(req)
+}
+
+// Trace behaves like the package-level Trace, but extracts with e. Traced extractions are not observed by
+// the MetricsHook.
+func (e *Extractor) Trace(req *http.Request) (ExtractionTrace, error) {
+	return e.TraceContext(context.Background(), req)
+}
+
+// TraceContext behaves like Trace, but bounds any read of the request body by ctx.
+func (e *Extractor) TraceContext(ctx context.Context, req *http.Request) (ExtractionTrace, error) {
+	trace := &ExtractionTrace{}
+	res, err := e.extractResult(ctx, req, trace, extractMode{})
+	trace.ClientID, trace.Source = res.ClientID, res.Source
+	if req != nil {
+		trace.order(e.sources())
+	}
+	return *trace, err
+}
+
+// record notes the outcome of a source, unless t is nil as it is for untraced extractions
+func (t *ExtractionTrace) record(source ClientIDSource, outcome TraceOutcome, reason string, err error) {
+	if t == nil {
+		return
+	}
+	t.Entries = append(t.Entries, TraceEntry{Source: source, Outcome: outcome, Reason: reason, Err: err})
+}
+
+// order puts the recorded entries in the order of sources and fills in the sources that were skipped.
+// The form sources are consulted together, so their entries may have been recorded out of order.
+func (t *ExtractionTrace) order(sources []ClientIDSource) {
+	entries := make([]TraceEntry, 0, len(sources))
+	for _, source := range sources {
+		i := slices.IndexFunc(t.Entries, func(entry TraceEntry) bool { return entry.Source == source })
+		if i < 0 {
+			entries = append(entries, TraceEntry{Source: source, Outcome: OutcomeSkipped})
+			continue
+		}
+		entries = append(entries, t.Entries[i])
+	}
+	t.Entries = entries
+}
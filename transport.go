@@ -0,0 +1,35 @@
+package restplay
+
+import (
+	"net/http"
+	"strings"
+)
+
+// checkTransport returns ErrInsecureTransport if RequireTLS is set and req did not arrive over TLS or, if it is
+// outgoing, is not about to be sent over HTTPS
+func (e *Extractor) checkTransport(req *http.Request, outgoing bool) error {
+	if !e.RequireTLS {
+		return nil
+	}
+	if outgoing {
+		if strings.EqualFold(req.URL.Scheme, "https") {
+			return nil
+		}
+		return ErrInsecureTransport
+	}
+	if req.TLS != nil {
+		return nil
+	}
+	if e.TrustForwardedProto && forwardedHTTPS(req) {
+		return nil
+	}
+	return ErrInsecureTransport
+}
+
+// forwardedHTTPS reports whether the X-Forwarded-Proto header of req says the client used HTTPS
+func forwardedHTTPS(req *http.Request) bool {
+	// proxies append to the header, so only the right-most value was set by the proxy nearest this server, and
+	// any value before it may have come from the client
+	protos := headerTokens(req.Header, "X-Forwarded-Proto")
+	return len(protos) > 0 && strings.EqualFold(protos[len(protos)-1], "https")
+}
@@ -0,0 +1,84 @@
+package restplay
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// TrustLevel ranks how strongly the source of a client_id authenticates it, for Extractor.MinTrust
+type TrustLevel int
+
+const (
+	// TrustNone is the zero TrustLevel, which as a MinTrust accepts a client_id from any source
+	TrustNone TrustLevel = iota
+	// TrustForm is the level of a client_id found in the URL query, URL path, or request body, which anyone can set
+	TrustForm
+	// TrustHeader is the level of a client_id found in one of the configured HeaderKeys
+	TrustHeader
+	// TrustCookie is the level of a client_id found in one of the configured CookieNames
+	TrustCookie
+	// TrustUnverifiedBearer is the level of a client_id parsed from a bearer token without a Verifier
+	TrustUnverifiedBearer
+	// TrustBasicAuth is the level of a client_id sent with basic or digest auth credentials
+	TrustBasicAuth
+	// TrustVerifiedBearer is the level of a client_id parsed from a bearer or DPoP-bound token the Verifier accepted
+	TrustVerifiedBearer
+	// TrustCert is the level of a client_id derived from a verified client certificate, including one forwarded
+	// in a trusted X-Forwarded-Client-Cert header
+	TrustCert
+)
+
+// trustLevelNames holds the human-readable name of each TrustLevel
+var trustLevelNames = map[TrustLevel]string{
+	TrustNone:             "none",
+	TrustForm:             "form",
+	TrustHeader:           "header",
+	TrustCookie:           "cookie",
+	TrustUnverifiedBearer: "unverified_bearer",
+	TrustBasicAuth:        "basic_auth",
+	TrustVerifiedBearer:   "verified_bearer",
+	TrustCert:             "cert",
+}
+
+// String returns the name of the trust level, suitable for logs
+func (l TrustLevel) String() string {
+	if name, ok := trustLevelNames[l]; ok {
+		return name
+	}
+	return "TrustLevel(" + strconv.Itoa(int(l)) + ")"
+}
+
+// SourceTrust returns the TrustLevel of a client_id found in source by e. Bearer tokens only rank as verified if
+// e has a Verifier to verify them with.
+func (e *Extractor) SourceTrust(source ClientIDSource) TrustLevel {
+	switch source {
+	case SourceURLQuery, SourceRequestBody, SourcePath:
+		return TrustForm
+	case SourceHeader:
+		return TrustHeader
+	case SourceCookie:
+		return TrustCookie
+	case SourceDPoP:
+		// DPoP-bound tokens are only ever accepted once the Verifier verified them
+		return TrustVerifiedBearer
+	case SourceBearerToken:
+		if e.Verifier != nil {
+			return TrustVerifiedBearer
+		}
+		return TrustUnverifiedBearer
+	case SourceBasicAuth, SourceDigestAuth:
+		return TrustBasicAuth
+	case SourceClientCert, SourceSPIFFE, SourceXFCC:
+		return TrustCert
+	default:
+		return TrustNone
+	}
+}
+
+// checkTrust rejects a client_id found in a source that ranks below the configured MinTrust
+func (e *Extractor) checkTrust(source ClientIDSource) error {
+	if trust := e.SourceTrust(source); trust < e.MinTrust {
+		return fmt.Errorf("%w: client_id from %s is trusted as %s, below %s", ErrInsufficientTrust, source, trust, e.MinTrust)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package restplay
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExtractorMinTrust(t *testing.T) {
+	const bearer = "Bearer robbie-bearer.othertokenstuffhere"
+
+	tests := map[string]struct {
+		Extractor        Extractor
+		URL              string
+		Authorization    string
+		ExpectedClientID string
+		ExpectedErr      error
+		ExpectedErrorSub string
+	}{
+		"should accept a verified bearer token under a high threshold": {
+			Extractor: Extractor{
+				MinTrust: TrustVerifiedBearer,
+				Verifier: &countingVerifier{claims: map[string]any{"client_id": "robbie-verified"}},
+			},
+			URL:              "https://example.com?client_id=robbie-query",
+			Authorization:    bearer,
+			ExpectedClientID: "robbie-verified",
+		},
+		"should reject a query-string client_id under a high threshold": {
+			Extractor: Extractor{
+				MinTrust: TrustVerifiedBearer,
+				Verifier: &countingVerifier{claims: map[string]any{"client_id": "robbie-verified"}},
+			},
+			URL:              "https://example.com?client_id=robbie-query",
+			ExpectedErr:      ErrInsufficientTrust,
+			ExpectedErrorSub: "client_id from url_query is trusted as form, below verified_bearer",
+		},
+		"should reject an unverified bearer token under a verified threshold": {
+			Extractor:        Extractor{MinTrust: TrustVerifiedBearer},
+			URL:              "https://example.com",
+			Authorization:    bearer,
+			ExpectedErr:      ErrInsufficientTrust,
+			ExpectedErrorSub: "client_id from bearer_token is trusted as unverified_bearer, below verified_bearer",
+		},
+		"should accept an unverified bearer token under a lower threshold": {
+			Extractor:        Extractor{MinTrust: TrustUnverifiedBearer},
+			URL:              "https://example.com",
+			Authorization:    bearer,
+			ExpectedClientID: "robbie-bearer",
+		},
+		"should accept a query-string client_id without a threshold": {
+			URL:              "https://example.com?client_id=robbie-query",
+			ExpectedClientID: "robbie-query",
+		},
+		"should look past weaker sources that are not listed": {
+			Extractor: Extractor{
+				MinTrust: TrustUnverifiedBearer,
+				Sources:  []ClientIDSource{SourceBearerToken},
+			},
+			URL:              "https://example.com?client_id=robbie-query",
+			Authorization:    bearer,
+			ExpectedClientID: "robbie-bearer",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tc.URL, nil)
+			if err != nil {
+				t.Fatalf("failed to create request for test: %s", err)
+			}
+			if tc.Authorization != "" {
+				req.Header.Set("Authorization", tc.Authorization)
+			}
+
+			clientID, _, err := tc.Extractor.Extract(req)
+			if !errors.Is(err, tc.ExpectedErr) {
+				t.Errorf("Extract() error = %v, want %v", err, tc.ExpectedErr)
+			}
+			if tc.ExpectedErrorSub != "" && (err == nil || !strings.Contains(err.Error(), tc.ExpectedErrorSub)) {
+				t.Errorf("Expected error containing %q but got: %v", tc.ExpectedErrorSub, err)
+			}
+			if clientID != tc.ExpectedClientID {
+				t.Errorf("Extract() got = %q, want %q", clientID, tc.ExpectedClientID)
+			}
+		})
+	}
+}
+
+func TestExtractorSourceTrust(t *testing.T) {
+	sources := []ClientIDSource{
+		SourceURLQuery, SourceHeader, SourceCookie, SourceBearerToken, SourceBasicAuth, SourceClientCert,
+	}
+	verified := &Extractor{Verifier: &countingVerifier{}}
+	for i := 1; i < len(sources); i++ {
+		lower, higher := (&Extractor{}).SourceTrust(sources[i-1]), (&Extractor{}).SourceTrust(sources[i])
+		if lower >= higher {
+			t.Errorf("SourceTrust(%s) = %s, want below SourceTrust(%s) = %s", sources[i-1], lower, sources[i], higher)
+		}
+	}
+	if unverified, got := (&Extractor{}).SourceTrust(SourceBasicAuth), verified.SourceTrust(SourceBearerToken); got <= unverified {
+		t.Errorf("SourceTrust(%s) with a Verifier = %s, want above %s", SourceBearerToken, got, unverified)
+	}
+	if got := verified.SourceTrust(SourceDPoP); got != TrustVerifiedBearer {
+		t.Errorf("SourceTrust(%s) with a Verifier = %s, want %s", SourceDPoP, got, TrustVerifiedBearer)
+	}
+}
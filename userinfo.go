@@ -0,0 +1,91 @@
+package restplay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// DefaultUserInfoCacheTTL is how long the TokenCache keeps a client_id resolved by a UserInfoVerifier that
+// configures no CacheTTL
+const DefaultUserInfoCacheTTL = 5 * time.Minute
+
+// UserInfoVerifier resolves opaque bearer tokens by presenting them to an OIDC userinfo endpoint, which only
+// answers for valid tokens. Its calls are bounded by the Extractor's VerifierTimeout, and the Extractor's
+// TokenCache spares repeated calls for the same token for up to CacheTTL.
+type UserInfoVerifier struct {
+	// URL is the userinfo endpoint of the provider, i.e. the userinfo_endpoint of its discovery document
+	URL string
+	// Field, e.g. "azp" or "https://example.com/claims.client_id", names the member of the userinfo document
+	// holding the client_id, which is then returned as the "client_id" claim so the default ClaimKeys find it.
+	// If empty, the document is returned as is, and the Extractor's ClaimKeys choose the member, "client_id"
+	// then "sub" by default.
+	Field string
+	// Client sends the userinfo requests, and its Timeout bounds them. If nil, http.DefaultClient is used.
+	Client *http.Client
+	// CacheTTL is how long the Extractor's TokenCache keeps a client_id resolved from a userinfo document without
+	// an "exp" member, which userinfo documents usually lack. If zero, DefaultUserInfoCacheTTL is used, so that
+	// a revoked token is not honored forever by a cache without a TTL of its own.
+	CacheTTL time.Duration
+}
+
+// cacheTTL returns how long the TokenCache keeps a client_id resolved from a document without an "exp" member
+func (v *UserInfoVerifier) cacheTTL() time.Duration {
+	if v.CacheTTL <= 0 {
+		return DefaultUserInfoCacheTTL
+	}
+	return v.CacheTTL
+}
+
+// Verify asks the userinfo endpoint about the token and returns the members of its response.
+// Tokens the endpoint refuses fail with ErrInvalidBearerToken; a failure to reach the endpoint or to understand
+// its response is returned as is, since it says nothing about the token.
+func (v *UserInfoVerifier) Verify(token string) (map[string]any, error) {
+	return v.VerifyContext(context.Background(), token)
+}
+
+// VerifyContext behaves like Verify, but gives up on the userinfo request once ctx is done
+func (v *UserInfoVerifier) VerifyContext(ctx context.Context, token string) (map[string]any, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("restplay: failed to create userinfo request: %w", err)
+	}
+	req.Header.Set("Authorization", bearerScheme+" "+token)
+	req.Header.Set("Accept", jsonContentType)
+
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("restplay: userinfo request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		// RFC 6750 has the endpoint refuse invalid, expired, and insufficiently scoped tokens alike
+		return nil, fmt.Errorf("%w: userinfo endpoint responded %s", ErrInvalidBearerToken, resp.Status)
+	default:
+		return nil, fmt.Errorf("restplay: userinfo endpoint responded %s", resp.Status)
+	}
+
+	var claims map[string]any
+	dec := json.NewDecoder(io.LimitReader(resp.Body, DefaultMaxBodyBytes))
+	dec.UseNumber()
+	if err = dec.Decode(&claims); err != nil {
+		return nil, fmt.Errorf("restplay: failed to decode userinfo response: %w", err)
+	}
+	if v.Field != "" {
+		clientID, _ := claimAtPath(claims, v.Field).(string)
+		if clientID == "" {
+			return nil, fmt.Errorf("%w: userinfo has no %q member", ErrInvalidBearerToken, v.Field)
+		}
+		claims[clientIDKey] = clientID
+	}
+	return claims, nil
+}
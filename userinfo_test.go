@@ -0,0 +1,222 @@
+package restplay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUserInfoVerifier(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		switch r.Header.Get("Authorization") {
+		case "Bearer valid-token":
+			w.Header().Set(contentTypeHeaderKey, jsonContentType)
+			fmt.Fprint(w, `{"sub":"robbie-subject","azp":"robbie-azp","https://example.com/claims":{"client_id":"robbie-nested"}}`)
+		case "Bearer client-token":
+			w.Header().Set(contentTypeHeaderKey, jsonContentType)
+			fmt.Fprint(w, `{"sub":"robbie-subject","client_id":"robbie-userinfo"}`)
+		case "Bearer garbled-token":
+			w.Header().Set(contentTypeHeaderKey, jsonContentType)
+			fmt.Fprint(w, `{"sub":`)
+		case "Bearer broken-token":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	tests := map[string]struct {
+		Verifier         *UserInfoVerifier
+		ClaimKeys        []string
+		Token            string
+		ExpectedClientID string
+		ExpectedErrs     []error
+		ExpectedErrorSub string
+	}{
+		"should read client_id from the userinfo": {
+			Verifier:         &UserInfoVerifier{URL: server.URL},
+			Token:            "client-token",
+			ExpectedClientID: "robbie-userinfo",
+		},
+		"should fall back to sub without client_id": {
+			Verifier:         &UserInfoVerifier{URL: server.URL},
+			Token:            "valid-token",
+			ExpectedClientID: "robbie-subject",
+		},
+		"should read the configured field": {
+			Verifier:         &UserInfoVerifier{URL: server.URL, Field: "azp"},
+			Token:            "valid-token",
+			ExpectedClientID: "robbie-azp",
+		},
+		"should read a nested configured field": {
+			Verifier:         &UserInfoVerifier{URL: server.URL, Field: "https://example.com/claims.client_id"},
+			Token:            "valid-token",
+			ExpectedClientID: "robbie-nested",
+		},
+		"should leave the choice to the ClaimKeys without a field": {
+			Verifier:         &UserInfoVerifier{URL: server.URL},
+			ClaimKeys:        []string{"azp"},
+			Token:            "valid-token",
+			ExpectedClientID: "robbie-azp",
+		},
+		"should reject a userinfo without the configured field": {
+			Verifier:     &UserInfoVerifier{URL: server.URL, Field: "azp"},
+			Token:        "client-token",
+			ExpectedErrs: []error{ErrInvalidBearerToken},
+		},
+		"should reject a token the endpoint refuses": {
+			Verifier:     &UserInfoVerifier{URL: server.URL},
+			Token:        "revoked-token",
+			ExpectedErrs: []error{ErrInvalidBearerToken},
+		},
+		"should report the verifier unavailable when the endpoint fails": {
+			Verifier:         &UserInfoVerifier{URL: server.URL},
+			Token:            "broken-token",
+			ExpectedErrs:     []error{ErrVerifierUnavailable},
+			ExpectedErrorSub: "responded 502 Bad Gateway",
+		},
+		"should return error for a malformed response": {
+			Verifier:         &UserInfoVerifier{URL: server.URL},
+			Token:            "garbled-token",
+			ExpectedErrs:     []error{ErrVerifierUnavailable},
+			ExpectedErrorSub: "failed to decode userinfo response",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			e := &Extractor{Verifier: tc.Verifier, ClaimKeys: tc.ClaimKeys}
+			clientID, err := e.ClientIDFromBearerToken(tc.Token)
+			for _, expected := range tc.ExpectedErrs {
+				if !errors.Is(err, expected) {
+					t.Errorf("ClientIDFromBearerToken() error = %v, want %v", err, expected)
+				}
+			}
+			if tc.ExpectedErrorSub != "" && (err == nil || !strings.Contains(err.Error(), tc.ExpectedErrorSub)) {
+				t.Errorf("Expected an error that contained: %q but got: %v", tc.ExpectedErrorSub, err)
+			}
+			if len(tc.ExpectedErrs) == 0 && tc.ExpectedErrorSub == "" && err != nil {
+				t.Errorf("No error expected but got: %q", err)
+			}
+			if clientID != tc.ExpectedClientID {
+				t.Errorf("ClientIDFromBearerToken() got = %q, want %q", clientID, tc.ExpectedClientID)
+			}
+		})
+	}
+}
+
+func TestUserInfoVerifierTokenCacheAndTimeout(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Header.Get("Authorization") == "Bearer slow-token" {
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+		}
+		w.Header().Set(contentTypeHeaderKey, jsonContentType)
+		fmt.Fprint(w, `{"sub":"robbie-cached"}`)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	e := &Extractor{
+		Verifier:        &UserInfoVerifier{URL: server.URL},
+		TokenCache:      NewLRUTokenCache(10, time.Minute),
+		VerifierTimeout: 20 * time.Millisecond,
+	}
+	for range 3 {
+		clientID, err := e.ClientIDFromBearerToken("cached-token")
+		if err != nil {
+			t.Fatalf("No error expected but got: %q", err)
+		}
+		if clientID != "robbie-cached" {
+			t.Errorf("ClientIDFromBearerToken() got = %q, want %q", clientID, "robbie-cached")
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("userinfo endpoint called %d times, want 1", n)
+	}
+
+	_, err := e.ClientIDFromBearerToken("slow-token")
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, ErrVerifierUnavailable) {
+		t.Errorf("ClientIDFromBearerToken() error = %v, want %v and %v", err, context.DeadlineExceeded, ErrVerifierUnavailable)
+	}
+}
+
+func TestUserInfoVerifierCacheTTL(t *testing.T) {
+	tests := map[string]struct {
+		CacheTTL      time.Duration
+		Document      string
+		Advance       time.Duration
+		ExpectedCalls int32
+	}{
+		"should keep a document without exp for the CacheTTL": {
+			CacheTTL:      time.Minute,
+			Document:      `{"sub":"robbie-cached"}`,
+			Advance:       59 * time.Second,
+			ExpectedCalls: 1,
+		},
+		"should expire a document without exp after the CacheTTL": {
+			CacheTTL:      time.Minute,
+			Document:      `{"sub":"robbie-cached"}`,
+			Advance:       time.Minute,
+			ExpectedCalls: 2,
+		},
+		"should expire a document without exp after the DefaultUserInfoCacheTTL": {
+			Document:      `{"sub":"robbie-cached"}`,
+			Advance:       DefaultUserInfoCacheTTL,
+			ExpectedCalls: 2,
+		},
+		"should keep a document with exp until it expires rather than for the CacheTTL": {
+			CacheTTL:      time.Minute,
+			Document:      fmt.Sprintf(`{"sub":"robbie-cached","exp":%d}`, time.Unix(1700000000, 0).Add(2*time.Minute).Unix()),
+			Advance:       90 * time.Second,
+			ExpectedCalls: 1,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.Header().Set(contentTypeHeaderKey, jsonContentType)
+				fmt.Fprint(w, tc.Document)
+			}))
+			defer server.Close()
+
+			now := time.Unix(1700000000, 0)
+			clock := func() time.Time { return now }
+			// the cache itself keeps entries until their token expires
+			cache := NewLRUTokenCache(10, 0)
+			cache.now = clock
+			e := &Extractor{
+				Verifier:   &UserInfoVerifier{URL: server.URL, CacheTTL: tc.CacheTTL},
+				TokenCache: cache,
+				Now:        clock,
+			}
+			for _, advance := range []time.Duration{0, tc.Advance} {
+				now = now.Add(advance)
+				if _, err := e.ClientIDFromBearerToken("cached-token"); err != nil {
+					t.Fatalf("No error expected but got: %q", err)
+				}
+			}
+			if n := calls.Load(); n != tc.ExpectedCalls {
+				t.Errorf("userinfo endpoint called %d times, want %d", n, tc.ExpectedCalls)
+			}
+		})
+	}
+}
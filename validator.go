@@ -0,0 +1,94 @@
+package restplay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// uuidPattern matches the canonical 8-4-4-4-12 hexadecimal form of a UUID
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ValidateUUID accepts client_ids in the canonical textual form of a UUID. The error leaves out the rejected
+// client_id, which InvalidClientIDError holds instead.
+func ValidateUUID(clientID string) error {
+	if !uuidPattern.MatchString(clientID) {
+		return errors.New("not a UUID")
+	}
+	return nil
+}
+
+// ValidateRegexp returns a validator accepting client_ids that match re. Anchor the pattern to match whole values.
+// As with ValidateUUID, the error leaves out the rejected client_id.
+func ValidateRegexp(re *regexp.Regexp) func(clientID string) error {
+	return func(clientID string) error {
+		if !re.MatchString(clientID) {
+			return fmt.Errorf("does not match %s", re)
+		}
+		return nil
+	}
+}
+
+// acceptClientID runs a client_id found in source past MinTrust, the ClientIDValidator, TrimPrefixes and
+// LowercaseClientID, then the AllowList, returning it as extraction hands it out. A client_id that was nothing but
+// a prefix comes back empty without an error, so the source counts as empty. Every entry point goes through here.
+func (e *Extractor) acceptClientID(ctx context.Context, source ClientIDSource, clientID string) (string, error) {
+	err := e.checkTrust(source)
+	if err == nil {
+		err = e.validateClientID(source, clientID)
+	}
+	if err == nil {
+		if clientID = e.normalizeClientID(clientID); clientID == "" {
+			return "", nil
+		}
+		err = e.checkAllowList(source, clientID)
+	}
+	if err != nil {
+		if e.Logger != nil {
+			e.Logger.LogAttrs(ctx, slog.LevelDebug, "restplay: client_id rejected",
+				slog.String("source", source.String()), slog.String("error", loggedError(err)))
+		}
+		return "", err
+	}
+	return clientID, nil
+}
+
+// validateClientID runs the configured ClientIDValidator over a client_id found in source
+func (e *Extractor) validateClientID(source ClientIDSource, clientID string) error {
+	if e.ClientIDValidator == nil {
+		return nil
+	}
+	if err := e.ClientIDValidator(clientID); err != nil {
+		return &InvalidClientIDError{Source: source, ClientID: clientID, Err: err}
+	}
+	return nil
+}
+
+// checkAllowList rejects a normalized client_id found in source that is not in the configured AllowList
+func (e *Extractor) checkAllowList(source ClientIDSource, clientID string) error {
+	if e.AllowList == nil {
+		return nil
+	}
+	if _, ok := e.AllowList[clientID]; !ok {
+		return &ClientNotAllowedError{Source: source, ClientID: clientID}
+	}
+	return nil
+}
+
+// normalizeClientID trims the first of the configured TrimPrefixes that clientID starts with, then lowercases
+// what is left if LowercaseClientID is set
+func (e *Extractor) normalizeClientID(clientID string) string {
+	for _, prefix := range e.TrimPrefixes {
+		if trimmed, ok := strings.CutPrefix(clientID, prefix); ok {
+			clientID = trimmed
+			break
+		}
+	}
+	if e.LowercaseClientID {
+		return strings.ToLower(clientID)
+	}
+	return clientID
+}
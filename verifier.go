@@ -0,0 +1,213 @@
+package restplay
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	// register the hash implementations used by the supported algorithms
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// TokenVerifier cryptographically validates a bearer token and returns its claims.
+// Implementations should return an error wrapping ErrInvalidBearerToken for tokens that fail validation,
+// and must be safe for concurrent use. Any other error means the verifier could not tell, see VerifierErrorPolicy.
+type TokenVerifier interface {
+	Verify(token string) (claims map[string]any, err error)
+}
+
+// ContextTokenVerifier is a TokenVerifier whose calls can be bounded by a context, as remote verifiers should be
+// so that a slow auth server cannot hold up extraction, see VerifierTimeout
+type ContextTokenVerifier interface {
+	TokenVerifier
+	VerifyContext(ctx context.Context, token string) (claims map[string]any, err error)
+}
+
+// cacheTTLVerifier is a TokenVerifier that bounds how long the TokenCache keeps the client_id of a token whose
+// claims do not say when it expires, instead of DefaultTokenCacheTTL
+type cacheTTLVerifier interface {
+	cacheTTL() time.Duration
+}
+
+// VerifierErrorPolicy decides what happens when a TokenVerifier fails without rejecting the token
+type VerifierErrorPolicy int
+
+const (
+	// FailClosed fails extraction with an error matching ErrVerifierUnavailable, so that an unavailable
+	// verifier never lets a weaker source decide the client_id
+	FailClosed VerifierErrorPolicy = iota
+	// FallThrough treats the bearer token as absent and consults the next source
+	FallThrough
+)
+
+// isTokenRejection reports whether err says that a token is invalid, as opposed to the verifier having failed
+func isTokenRejection(err error) bool {
+	return errors.Is(err, ErrInvalidBearerToken) || errors.Is(err, ErrTokenExpired) || errors.Is(err, ErrTokenNotYetValid)
+}
+
+// verifyToken has the Verifier validate token, within ctx and VerifierTimeout if it is a ContextTokenVerifier.
+// An error that does not reject the token is wrapped with ErrVerifierUnavailable.
+func (e *Extractor) verifyToken(ctx context.Context, token string) (map[string]any, error) {
+	var (
+		claims map[string]any
+		err    error
+	)
+	if v, ok := e.Verifier.(ContextTokenVerifier); ok {
+		if e.VerifierTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, e.VerifierTimeout)
+			defer cancel()
+		}
+		claims, err = v.VerifyContext(ctx, token)
+	} else {
+		claims, err = e.Verifier.Verify(token)
+	}
+	if err != nil && !isTokenRejection(err) {
+		// the verifier could not tell either way, e.g. because the introspection endpoint is down
+		return nil, fmt.Errorf("%w: %w", ErrVerifierUnavailable, err)
+	}
+	return claims, err
+}
+
+// HMACVerifier verifies JWTs signed with HS256, HS384, or HS512 using a shared secret
+type HMACVerifier struct {
+	// Key is the shared secret
+	Key []byte
+}
+
+// Verify checks the token's HMAC signature and returns its claims
+func (v *HMACVerifier) Verify(token string) (map[string]any, error) {
+	return verifyJWT(token, func(alg string, signingInput string, signature []byte) error {
+		if !strings.HasPrefix(alg, "HS") {
+			return unsupportedAlgorithm(alg)
+		}
+		hash, err := hashForAlgorithm(alg)
+		if err != nil {
+			return err
+		}
+		mac := hmac.New(hash.New, v.Key)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errSignatureMismatch
+		}
+		return nil
+	})
+}
+
+// PublicKeyVerifier verifies JWTs signed with an asymmetric key. The algorithm family must match the key:
+// RS*/PS* need an *rsa.PublicKey, ES* need an *ecdsa.PublicKey, and EdDSA needs an ed25519.PublicKey.
+type PublicKeyVerifier struct {
+	// Key is the public half of the signing key
+	Key crypto.PublicKey
+}
+
+// Verify checks the token's signature against the public key and returns its claims
+func (v *PublicKeyVerifier) Verify(token string) (map[string]any, error) {
+	return verifyJWT(token, func(alg string, signingInput string, signature []byte) error {
+		return verifySignature(v.Key, alg, signingInput, signature)
+	})
+}
+
+// errSignatureMismatch is returned when a token's signature does not match its content
+var errSignatureMismatch = fmt.Errorf("%w: signature mismatch", ErrInvalidBearerToken)
+
+// verifyJWT parses the token and hands its algorithm, signing input, and signature to verify
+func verifyJWT(token string, verify func(alg string, signingInput string, signature []byte) error) (map[string]any, error) {
+	parsed, err := parseJWT(token)
+	if err != nil {
+		return nil, err
+	}
+	alg, _ := parsed.header["alg"].(string)
+	if err = verify(alg, parsed.signingInput, parsed.signature); err != nil {
+		return nil, err
+	}
+	return parsed.claims, nil
+}
+
+// verifySignature checks an asymmetric signature over signingInput
+func verifySignature(key crypto.PublicKey, alg string, signingInput string, signature []byte) error {
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") && !strings.HasPrefix(alg, "PS") {
+			return unsupportedAlgorithm(alg)
+		}
+		hash, err := hashForAlgorithm(alg)
+		if err != nil {
+			return err
+		}
+		digest := hashOf(hash, signingInput)
+		if strings.HasPrefix(alg, "PS") {
+			err = rsa.VerifyPSS(pub, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		} else {
+			err = rsa.VerifyPKCS1v15(pub, hash, digest, signature)
+		}
+		if err != nil {
+			return errSignatureMismatch
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") {
+			return unsupportedAlgorithm(alg)
+		}
+		hash, err := hashForAlgorithm(alg)
+		if err != nil {
+			return err
+		}
+		// JWS encodes ECDSA signatures as the fixed-size concatenation of r and s
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errSignatureMismatch
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, hashOf(hash, signingInput), r, s) {
+			return errSignatureMismatch
+		}
+		return nil
+	case ed25519.PublicKey:
+		if alg != "EdDSA" {
+			return unsupportedAlgorithm(alg)
+		}
+		if !ed25519.Verify(pub, []byte(signingInput), signature) {
+			return errSignatureMismatch
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unsupported public key type %T", ErrInvalidBearerToken, key)
+	}
+}
+
+// hashForAlgorithm maps the digest size suffix of a JWS algorithm (e.g. the 256 of HS256) to its hash
+func hashForAlgorithm(alg string) (crypto.Hash, error) {
+	switch {
+	case strings.HasSuffix(alg, "256"):
+		return crypto.SHA256, nil
+	case strings.HasSuffix(alg, "384"):
+		return crypto.SHA384, nil
+	case strings.HasSuffix(alg, "512"):
+		return crypto.SHA512, nil
+	default:
+		return 0, unsupportedAlgorithm(alg)
+	}
+}
+
+// hashOf returns the digest of s
+func hashOf(hash crypto.Hash, s string) []byte {
+	h := hash.New()
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+// unsupportedAlgorithm is returned for algorithms a verifier does not accept
+func unsupportedAlgorithm(alg string) error {
+	return fmt.Errorf("%w: unsupported signing algorithm %q", ErrInvalidBearerToken, alg)
+}
@@ -0,0 +1,297 @@
+package restplay
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// signJWT builds a compact JWT with the given claims signed by key using alg
+func signJWT(t *testing.T, alg string, key any, claims map[string]any) string {
+	t.Helper()
+	return signJWTWithHeader(t, map[string]any{"alg": alg, "typ": "JWT"}, key, claims)
+}
+
+// signJWTWithHeader signs claims under the given header, whose "alg" member chooses the algorithm
+func signJWTWithHeader(t *testing.T, headerMembers map[string]any, key any, claims map[string]any) string {
+	t.Helper()
+	alg, _ := headerMembers["alg"].(string)
+	header, err := json.Marshal(headerMembers)
+	if err != nil {
+		t.Fatalf("failed to marshal JWT header for test: %s", err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("failed to marshal JWT claims for test: %s", err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		hash, _ := hashForAlgorithm(alg)
+		mac := hmac.New(hash.New, k)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		hash, _ := hashForAlgorithm(alg)
+		if strings.HasPrefix(alg, "PS") {
+			opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+			signature, err = rsa.SignPSS(rand.Reader, k, hash, hashOf(hash, signingInput), opts)
+		} else {
+			signature, err = rsa.SignPKCS1v15(rand.Reader, k, hash, hashOf(hash, signingInput))
+		}
+	case *ecdsa.PrivateKey:
+		hash, _ := hashForAlgorithm(alg)
+		r, s, signErr := ecdsa.Sign(rand.Reader, k, hashOf(hash, signingInput))
+		size := (k.Curve.Params().BitSize + 7) / 8
+		signature = make([]byte, 2*size)
+		r.FillBytes(signature[:size])
+		s.FillBytes(signature[size:])
+		err = signErr
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(k, []byte(signingInput))
+	default:
+		t.Fatalf("unsupported key type for test: %T", key)
+	}
+	if err != nil {
+		t.Fatalf("failed to sign JWT for test: %s", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// tamperJWT swaps the payload of a signed token while keeping its original signature
+func tamperJWT(t *testing.T, token string, claims map[string]any) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("failed to marshal JWT claims for test: %s", err)
+	}
+	fields := strings.Split(token, ".")
+	fields[1] = base64.RawURLEncoding.EncodeToString(payload)
+	return strings.Join(fields, ".")
+}
+
+func TestTokenVerifiers(t *testing.T) {
+	hmacKey := []byte("robbie-shared-secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key for test: %s", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ECDSA key for test: %s", err)
+	}
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate Ed25519 key for test: %s", err)
+	}
+	claims := map[string]any{"client_id": "robbie-verified-client-id"}
+	forged := map[string]any{"client_id": "robbie-forged-client-id"}
+
+	tests := map[string]struct {
+		Verifier         TokenVerifier
+		Token            string
+		ExpectedClientID string
+		ExpectedErrorSub string
+	}{
+		"should accept a valid HS256 signature": {
+			Verifier:         &HMACVerifier{Key: hmacKey},
+			Token:            signJWT(t, "HS256", hmacKey, claims),
+			ExpectedClientID: "robbie-verified-client-id",
+		},
+		"should accept a valid HS512 signature": {
+			Verifier:         &HMACVerifier{Key: hmacKey},
+			Token:            signJWT(t, "HS512", hmacKey, claims),
+			ExpectedClientID: "robbie-verified-client-id",
+		},
+		"should reject a tampered HS256 payload": {
+			Verifier:         &HMACVerifier{Key: hmacKey},
+			Token:            tamperJWT(t, signJWT(t, "HS256", hmacKey, claims), forged),
+			ExpectedErrorSub: "signature mismatch",
+		},
+		"should reject an HMAC signature made with another key": {
+			Verifier:         &HMACVerifier{Key: hmacKey},
+			Token:            signJWT(t, "HS256", []byte("not-the-secret"), claims),
+			ExpectedErrorSub: "signature mismatch",
+		},
+		"should accept a valid RS256 signature": {
+			Verifier:         &PublicKeyVerifier{Key: &rsaKey.PublicKey},
+			Token:            signJWT(t, "RS256", rsaKey, claims),
+			ExpectedClientID: "robbie-verified-client-id",
+		},
+		"should accept a valid PS384 signature": {
+			Verifier:         &PublicKeyVerifier{Key: &rsaKey.PublicKey},
+			Token:            signJWT(t, "PS384", rsaKey, claims),
+			ExpectedClientID: "robbie-verified-client-id",
+		},
+		"should reject a tampered RS256 payload": {
+			Verifier:         &PublicKeyVerifier{Key: &rsaKey.PublicKey},
+			Token:            tamperJWT(t, signJWT(t, "RS256", rsaKey, claims), forged),
+			ExpectedErrorSub: "signature mismatch",
+		},
+		"should accept a valid ES256 signature": {
+			Verifier:         &PublicKeyVerifier{Key: &ecKey.PublicKey},
+			Token:            signJWT(t, "ES256", ecKey, claims),
+			ExpectedClientID: "robbie-verified-client-id",
+		},
+		"should reject a tampered ES256 payload": {
+			Verifier:         &PublicKeyVerifier{Key: &ecKey.PublicKey},
+			Token:            tamperJWT(t, signJWT(t, "ES256", ecKey, claims), forged),
+			ExpectedErrorSub: "signature mismatch",
+		},
+		"should accept a valid EdDSA signature": {
+			Verifier:         &PublicKeyVerifier{Key: edPub},
+			Token:            signJWT(t, "EdDSA", edKey, claims),
+			ExpectedClientID: "robbie-verified-client-id",
+		},
+		"should reject the none algorithm": {
+			Verifier:         &HMACVerifier{Key: hmacKey},
+			Token:            makeUnsignedJWT(t, claims),
+			ExpectedErrorSub: "unsupported signing algorithm",
+		},
+		"should reject an HMAC token presented to a public key verifier": {
+			Verifier:         &PublicKeyVerifier{Key: &rsaKey.PublicKey},
+			Token:            signJWT(t, "HS256", hmacKey, claims),
+			ExpectedErrorSub: "unsupported signing algorithm",
+		},
+		"should reject an unsupported public key type": {
+			Verifier:         &PublicKeyVerifier{Key: "not a key"},
+			Token:            signJWT(t, "RS256", rsaKey, claims),
+			ExpectedErrorSub: "unsupported public key type",
+		},
+		"should reject legacy two-field tokens": {
+			Verifier:         &HMACVerifier{Key: hmacKey},
+			Token:            "robbie-legacy.othertokenstuffhere",
+			ExpectedErrorSub: "invalid token",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			e := &Extractor{Verifier: tc.Verifier}
+			req, err := http.NewRequest(http.MethodGet, "https://example.com", nil)
+			if err != nil {
+				t.Fatalf("failed to create request for test: %s", err)
+			}
+			req.Header.Set("Authorization", "Bearer "+tc.Token)
+
+			clientID, _, err := e.Extract(req)
+			if tc.ExpectedErrorSub != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.ExpectedErrorSub) {
+					t.Errorf("Expected an error that contained: %q but got: %v", tc.ExpectedErrorSub, err)
+				}
+				if !errors.Is(err, ErrInvalidBearerToken) {
+					t.Errorf("Expected error to match ErrInvalidBearerToken but got: %v", err)
+				}
+			} else if err != nil {
+				t.Errorf("No error expected but got: %q", err)
+			}
+			if clientID != tc.ExpectedClientID {
+				t.Errorf("Extract() got = %q, want %q", clientID, tc.ExpectedClientID)
+			}
+		})
+	}
+}
+
+func TestHashForAlgorithm(t *testing.T) {
+	tests := map[string]crypto.Hash{"HS256": crypto.SHA256, "RS384": crypto.SHA384, "ES512": crypto.SHA512}
+	for alg, expected := range tests {
+		if actual, err := hashForAlgorithm(alg); err != nil || actual != expected {
+			t.Errorf("hashForAlgorithm(%q) = %v, %v, want %v", alg, actual, err, expected)
+		}
+	}
+	if _, err := hashForAlgorithm("HS1"); err == nil {
+		t.Error("hashForAlgorithm(\"HS1\") expected an error")
+	}
+}
+
+// stubVerifier fails every token with err
+type stubVerifier struct {
+	err error
+}
+
+func (v stubVerifier) Verify(string) (map[string]any, error) {
+	return nil, v.err
+}
+
+func TestExtractorVerifierErrorPolicy(t *testing.T) {
+	// a server that is gone by the time the verifier calls it, like an unreachable auth server
+	gone := httptest.NewServer(http.NotFoundHandler())
+	gone.Close()
+	netErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	tests := map[string]struct {
+		Policy           VerifierErrorPolicy
+		Verifier         TokenVerifier
+		ExpectedClientID string
+		ExpectedErrs     []error
+	}{
+		"should fail closed on a network error by default": {
+			Verifier:     stubVerifier{err: netErr},
+			ExpectedErrs: []error{ErrVerifierUnavailable, netErr},
+		},
+		"should fall through on a network error when configured": {
+			Policy:           FallThrough,
+			Verifier:         stubVerifier{err: netErr},
+			ExpectedClientID: "robbie-query",
+		},
+		"should fail closed when the introspection endpoint is unreachable": {
+			Verifier:     &IntrospectionVerifier{URL: gone.URL},
+			ExpectedErrs: []error{ErrVerifierUnavailable},
+		},
+		"should fall through when the introspection endpoint is unreachable and configured": {
+			Policy:           FallThrough,
+			Verifier:         &IntrospectionVerifier{URL: gone.URL},
+			ExpectedClientID: "robbie-query",
+		},
+		"should never fall through an invalid token": {
+			Policy:       FallThrough,
+			Verifier:     stubVerifier{err: fmt.Errorf("%w: bad signature", ErrInvalidBearerToken)},
+			ExpectedErrs: []error{ErrInvalidBearerToken},
+		},
+		"should never fall through an expired token": {
+			Policy:       FallThrough,
+			Verifier:     stubVerifier{err: fmt.Errorf("%w: expired", ErrTokenExpired)},
+			ExpectedErrs: []error{ErrTokenExpired},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "https://example.com?client_id=robbie-query", nil)
+			if err != nil {
+				t.Fatalf("failed to create request for test: %s", err)
+			}
+			req.Header.Set("Authorization", "Bearer some.opaque.token")
+
+			e := &Extractor{Verifier: tc.Verifier, VerifierErrorPolicy: tc.Policy}
+			clientID, _, err := e.Extract(req)
+			if len(tc.ExpectedErrs) == 0 && err != nil {
+				t.Errorf("No error expected but got: %q", err)
+			}
+			for _, expected := range tc.ExpectedErrs {
+				if !errors.Is(err, expected) {
+					t.Errorf("Expected errors.Is(err, %v) but got: %v", expected, err)
+				}
+			}
+			if len(tc.ExpectedErrs) > 0 && tc.ExpectedErrs[0] != ErrVerifierUnavailable && errors.Is(err, ErrVerifierUnavailable) {
+				t.Errorf("Expected a rejected token not to match ErrVerifierUnavailable but got: %v", err)
+			}
+			if clientID != tc.ExpectedClientID {
+				t.Errorf("Extract() got = %q, want %q", clientID, tc.ExpectedClientID)
+			}
+		})
+	}
+}
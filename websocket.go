@@ -0,0 +1,76 @@
+package restplay
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// defaultSubprotocolPrefixes are the Sec-WebSocket-Protocol token prefixes recognized when an Extractor configures none
+var defaultSubprotocolPrefixes = []string{clientIDKey + "."}
+
+// subprotocolHeaderKey is the header in which a WebSocket client offers its subprotocols
+const subprotocolHeaderKey = "Sec-WebSocket-Protocol"
+
+// GetClientIDFromUpgrade returns the client_id of a request like GetClientID, except that, since browsers cannot
+// set other headers on a WebSocket, SourceHeader also consults the "client_id.<value>" Sec-WebSocket-Protocol
+// tokens of a WebSocket upgrade request.
+func GetClientIDFromUpgrade(req *http.Request) (string, error) {
+	return defaultExtractor.ClientIDFromUpgrade(req)
+}
+
+// ClientIDFromUpgrade behaves like GetClientIDFromUpgrade, but extracts with e. Its Sources are consulted in
+// order, and the subprotocol tokens, matched with SubprotocolPrefixes, after the HeaderKeys at the position of
+// SourceHeader, which a client_id taken from them is reported as. The extraction is observed by the MetricsHook
+// and logged to the Logger like any other.
+func (e *Extractor) ClientIDFromUpgrade(req *http.Request) (string, error) {
+	ctx := context.Background()
+	if req != nil {
+		ctx = req.Context()
+	}
+	res, err := e.observedExtractResult(ctx, req, extractMode{upgrade: req != nil && isWebSocketUpgrade(req)})
+	return res.ClientID, err
+}
+
+// fromSubprotocols returns the client_id of the first Sec-WebSocket-Protocol token with one of the
+// SubprotocolPrefixes, or the reason there is none, joined to headersReason, the reason fromHeaders gave
+func (e *Extractor) fromSubprotocols(req *http.Request, headersReason string) (string, string, string) {
+	prefixes := e.SubprotocolPrefixes
+	if len(prefixes) == 0 {
+		prefixes = defaultSubprotocolPrefixes
+	}
+	for _, prefix := range prefixes {
+		for _, protocol := range headerTokens(req.Header, subprotocolHeaderKey) {
+			if clientID, ok := strings.CutPrefix(protocol, prefix); ok && clientID != "" {
+				return clientID, subprotocolHeaderKey, ""
+			}
+		}
+	}
+	return "", "", headersReason + ", and no subprotocol holds a client_id"
+}
+
+// isWebSocketUpgrade reports whether req asks to be upgraded to a WebSocket
+func isWebSocketUpgrade(req *http.Request) bool {
+	if !strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+		return false
+	}
+	for _, token := range headerTokens(req.Header, "Connection") {
+		if strings.EqualFold(token, "upgrade") {
+			return true
+		}
+	}
+	return false
+}
+
+// headerTokens splits every value of the comma-separated header key into its trimmed, non-empty tokens
+func headerTokens(header http.Header, key string) []string {
+	var tokens []string
+	for _, value := range header.Values(key) {
+		for _, token := range strings.Split(value, ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,163 @@
+package restplay
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGetClientIDFromUpgrade(t *testing.T) {
+	upgrade := map[string]string{"Connection": "keep-alive, Upgrade", "Upgrade": "websocket"}
+
+	tests := map[string]struct {
+		Prefixes         []string
+		Sources          []ClientIDSource
+		Method           string
+		URL              string
+		Body             string
+		Header           map[string]string
+		ExpectedClientID string
+		ExpectedErr      error
+	}{
+		"should find client_id in the subprotocol header": {
+			Header: map[string]string{
+				"Connection":             "Upgrade",
+				"Upgrade":                "websocket",
+				"Sec-WebSocket-Protocol": "chat.v2, client_id.robbie-subprotocol",
+			},
+			ExpectedClientID: "robbie-subprotocol",
+		},
+		"should find client_id in the query of an upgrade request": {
+			URL:              "https://example.com/ws?client_id=robbie-query",
+			Header:           upgrade,
+			ExpectedClientID: "robbie-query",
+		},
+		"should use the configured subprotocol prefixes": {
+			Prefixes: []string{"cid-"},
+			Header: map[string]string{
+				"Connection":             "upgrade",
+				"Upgrade":                "WebSocket",
+				"Sec-WebSocket-Protocol": "client_id.robbie-ignored, cid-robbie-custom",
+			},
+			ExpectedClientID: "robbie-custom",
+		},
+		"should consult the Authorization header before the subprotocol header": {
+			Header: map[string]string{
+				"Authorization":          "Basic cm9iYmllLWJhc2ljOnNlY3JldA==",
+				"Connection":             "Upgrade",
+				"Upgrade":                "websocket",
+				"Sec-WebSocket-Protocol": "client_id.robbie-subprotocol",
+			},
+			ExpectedClientID: "robbie-basic",
+		},
+		"should follow the order of Sources": {
+			Sources: []ClientIDSource{SourceHeader, SourceBasicAuth},
+			Header: map[string]string{
+				"Authorization":          "Basic cm9iYmllLWJhc2ljOnNlY3JldA==",
+				"Connection":             "Upgrade",
+				"Upgrade":                "websocket",
+				"Sec-WebSocket-Protocol": "client_id.robbie-subprotocol",
+			},
+			ExpectedClientID: "robbie-subprotocol",
+		},
+		"should not consult the subprotocol header without SourceHeader": {
+			Sources: []ClientIDSource{SourceBasicAuth, SourceURLQuery},
+			Header: map[string]string{
+				"Connection":             "Upgrade",
+				"Upgrade":                "websocket",
+				"Sec-WebSocket-Protocol": "client_id.robbie-subprotocol",
+			},
+			ExpectedErr: ErrMissingClientID,
+		},
+		"should return error for an upgrade request without a client_id": {
+			Header: map[string]string{
+				"Connection":             "Upgrade",
+				"Upgrade":                "websocket",
+				"Sec-WebSocket-Protocol": "chat.v2, client_id.",
+			},
+			ExpectedErr: ErrMissingClientID,
+		},
+		"should ignore the subprotocol header of a regular request": {
+			Header:      map[string]string{"Sec-WebSocket-Protocol": "client_id.robbie-subprotocol"},
+			ExpectedErr: ErrMissingClientID,
+		},
+		"should extract from a regular request as usual": {
+			Method:           http.MethodPost,
+			Body:             "client_id=robbie-form",
+			Header:           map[string]string{contentTypeHeaderKey: formContentType},
+			ExpectedClientID: "robbie-form",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			method, url := tc.Method, tc.URL
+			if method == "" {
+				method = http.MethodGet
+			}
+			if url == "" {
+				url = "https://example.com/ws"
+			}
+			req, err := http.NewRequest(method, url, strings.NewReader(tc.Body))
+			if err != nil {
+				t.Fatalf("failed to create request for test: %s", err)
+			}
+			for k, v := range tc.Header {
+				req.Header.Set(k, v)
+			}
+
+			var clientID string
+			if tc.Prefixes == nil && tc.Sources == nil {
+				clientID, err = GetClientIDFromUpgrade(req)
+			} else {
+				clientID, err = (&Extractor{SubprotocolPrefixes: tc.Prefixes, Sources: tc.Sources}).ClientIDFromUpgrade(req)
+			}
+			if !errors.Is(err, tc.ExpectedErr) {
+				t.Errorf("GetClientIDFromUpgrade() error = %v, want %v", err, tc.ExpectedErr)
+			}
+			if clientID != tc.ExpectedClientID {
+				t.Errorf("GetClientIDFromUpgrade() got = %q, want %q", clientID, tc.ExpectedClientID)
+			}
+		})
+	}
+}
+
+func TestExtractorClientIDFromUpgradeObserved(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://example.com/ws", nil)
+	if err != nil {
+		t.Fatalf("failed to create request for test: %s", err)
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Protocol", "client_id.robbie-subprotocol")
+
+	var (
+		buf  bytes.Buffer
+		hook recordingHook
+	)
+	e := &Extractor{
+		Sources:     []ClientIDSource{SourceHeader},
+		MetricsHook: &hook,
+		Logger: slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+			Level: slog.LevelDebug,
+			ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+				// drop the timestamp so records compare exactly
+				if a.Key == slog.TimeKey {
+					return slog.Attr{}
+				}
+				return a
+			},
+		})),
+	}
+	if clientID, err := e.ClientIDFromUpgrade(req); err != nil || clientID != "robbie-subprotocol" {
+		t.Fatalf("ClientIDFromUpgrade() got = %q, %v, want %q", clientID, err, "robbie-subprotocol")
+	}
+	if len(hook.observations) != 1 || hook.observations[0].source != SourceHeader || hook.observations[0].err != nil {
+		t.Errorf("ObserveExtraction() calls = %+v, want one successful observation of %s", hook.observations, SourceHeader)
+	}
+	if want := `level=DEBUG msg="restplay: client_id found" source=header`; strings.TrimSpace(buf.String()) != want {
+		t.Errorf("Logged records:\n  %s\nwant:\n  %s", strings.TrimSpace(buf.String()), want)
+	}
+}
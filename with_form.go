@@ -0,0 +1,41 @@
+package restplay
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"slices"
+)
+
+// GetClientIDWithForm behaves like GetClientID, but also returns the parsed form so handlers needing other
+// fields don't parse it again. The form holds the body fields of form-encoded and multipart bodies followed
+// by the URL query; JSON bodies contribute nothing to it.
+func GetClientIDWithForm(req *http.Request) (string, url.Values, *http.Request, error) {
+	return defaultExtractor.ExtractWithForm(req)
+}
+
+// ExtractWithForm behaves like Extract, but also returns the parsed form. The form is parsed even when the
+// client_id came from another source, unless Sources rules out reading the body, in which case only the URL
+// query is returned.
+func (e *Extractor) ExtractWithForm(req *http.Request) (string, url.Values, *http.Request, error) {
+	return e.ExtractWithFormContext(context.Background(), req)
+}
+
+// ExtractWithFormContext behaves like ExtractWithForm, but bounds any read of the request body by ctx.
+func (e *Extractor) ExtractWithFormContext(ctx context.Context, req *http.Request) (string, url.Values, *http.Request, error) {
+	res, err := e.ExtractResultContext(ctx, req)
+	if err != nil {
+		return "", nil, res.Request, err
+	}
+	if e.isBodyMethod(req.Method) && !slices.Contains(e.sources(), SourceRequestBody) {
+		// the body must not be touched, so only the URL itself can be returned
+		return res.ClientID, req.URL.Query(), req, nil
+	}
+	if req.Form == nil {
+		// the client_id came from a source consulted before the form
+		if _, _, _, _, err = e.parseRequestForm(ctx, req); err != nil {
+			return "", nil, req, err
+		}
+	}
+	return res.ClientID, req.Form, req, nil
+}
@@ -0,0 +1,157 @@
+package restplay
+
+import (
+	"net/http"
+	"strings"
+)
+
+// xfccHeaderKey is the header in which proxies like Envoy forward the client certificate of a TLS connection they
+// terminated
+const xfccHeaderKey = "X-Forwarded-Client-Cert"
+
+// XFCCElement holds the fields of one element of an X-Forwarded-Client-Cert header, each describing the client
+// certificate of one proxy hop. Fields the proxy did not forward are empty.
+type XFCCElement struct {
+	// By is the URI SAN of the proxy's own certificate
+	By string
+	// Hash is the hex-encoded SHA-256 digest of the client certificate
+	Hash string
+	// Subject is the subject of the client certificate, e.g. "CN=robbie,OU=eng,O=example"
+	Subject string
+	// URI is the URI SAN of the client certificate, e.g. "spiffe://example.org/workload"
+	URI string
+	// DNS are the DNS SANs of the client certificate
+	DNS []string
+}
+
+// XFCCURI returns the URI SAN of the forwarded client certificate
+func XFCCURI(element XFCCElement) string {
+	return element.URI
+}
+
+// XFCCSubjectCommonName returns the Common Name of the forwarded client certificate's subject
+func XFCCSubjectCommonName(element XFCCElement) string {
+	for _, rdn := range splitUnescaped(element.Subject, ',') {
+		if key, value, ok := strings.Cut(strings.TrimSpace(rdn), "="); ok && strings.EqualFold(key, "CN") {
+			return unescapeDN(value)
+		}
+	}
+	return ""
+}
+
+// fromXFCC maps the last element of the X-Forwarded-Client-Cert header, which describes the client of the proxy
+// nearest to this server, to the client_id, or returns the reason there is none. Since any client can send the
+// header, it is only consulted if TrustXFCC is set.
+func (e *Extractor) fromXFCC(req *http.Request) (string, string) {
+	values := req.Header.Values(xfccHeaderKey)
+	if len(values) == 0 {
+		return "", "XFCC header absent"
+	}
+	if !e.TrustXFCC {
+		return "", "XFCC header not trusted"
+	}
+	elements := parseXFCC(strings.Join(values, ","))
+	if len(elements) == 0 {
+		return "", "XFCC header empty"
+	}
+	element := elements[len(elements)-1]
+	if e.XFCCClientID != nil {
+		if clientID := e.XFCCClientID(element); clientID != "" {
+			return clientID, ""
+		}
+		return "", "XFCC element mapped to empty client_id"
+	}
+	if element.URI != "" {
+		return element.URI, ""
+	}
+	if clientID := XFCCSubjectCommonName(element); clientID != "" {
+		return clientID, ""
+	}
+	return "", "XFCC element has neither URI nor subject Common Name"
+}
+
+// parseXFCC parses an X-Forwarded-Client-Cert header value into its comma-separated elements of semicolon-separated
+// key=value pairs. Values may be double-quoted, with backslash escapes, to hold commas and semicolons. Keys are
+// matched case-insensitively, and unknown keys, like Cert and Chain, are ignored.
+func parseXFCC(header string) []XFCCElement {
+	var elements []XFCCElement
+	for _, part := range splitUnescaped(header, ',') {
+		var (
+			element XFCCElement
+			found   bool
+		)
+		for _, pair := range splitUnescaped(part, ';') {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok {
+				continue
+			}
+			value = unquoteXFCC(value)
+			switch strings.ToLower(key) {
+			case "by":
+				element.By = value
+			case "hash":
+				element.Hash = value
+			case "subject":
+				element.Subject = value
+			case "uri":
+				element.URI = value
+			case "dns":
+				element.DNS = append(element.DNS, value)
+			default:
+				continue
+			}
+			found = true
+		}
+		if found {
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
+
+// splitUnescaped splits s at each sep that is neither inside double quotes nor escaped with a backslash
+func splitUnescaped(s string, sep byte) []string {
+	var (
+		parts    []string
+		start    int
+		inQuotes bool
+	)
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			inQuotes = !inQuotes
+		case sep:
+			if !inQuotes {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unquoteXFCC removes the double quotes around value and the backslashes escaping double quotes within. Other
+// escapes, like those of commas in a subject, are left for the value's own format.
+func unquoteXFCC(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+	return strings.ReplaceAll(value[1:len(value)-1], `\"`, `"`)
+}
+
+// unescapeDN removes the backslashes escaping characters in an attribute value of a distinguished name
+func unescapeDN(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	var sb strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+		}
+		sb.WriteByte(value[i])
+	}
+	return sb.String()
+}
@@ -0,0 +1,171 @@
+package restplay
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// envoyXFCC is an X-Forwarded-Client-Cert header as Envoy sets it, quoting the subject for its commas
+const envoyXFCC = `By=spiffe://example.org/ns/edge/sa/proxy;` +
+	`Hash=468ed33be74eee6556d90c0149c1309e9ba61d6425303443c0748a02dd8de688;` +
+	`Subject="CN=robbie-cn,OU=eng,O=Example\, Inc.";URI=spiffe://example.org/ns/prod/sa/robbie-workload;` +
+	`DNS=robbie.example.org;DNS=robbie.example.com`
+
+func TestExtractorXFCC(t *testing.T) {
+	tests := map[string]struct {
+		Trust            bool
+		Mapper           func(element XFCCElement) string
+		Header           []string
+		ExpectedClientID string
+		ExpectedReason   string
+	}{
+		"should use the URI SAN by default": {
+			Trust:            true,
+			Header:           []string{envoyXFCC},
+			ExpectedClientID: "spiffe://example.org/ns/prod/sa/robbie-workload",
+		},
+		"should fall back to the subject Common Name without a URI SAN": {
+			Trust:            true,
+			Header:           []string{`Hash=abc;Subject="CN=robbie-cn,OU=eng"`},
+			ExpectedClientID: "robbie-cn",
+		},
+		"should map the element with XFCCClientID": {
+			Trust:            true,
+			Mapper:           XFCCSubjectCommonName,
+			Header:           []string{envoyXFCC},
+			ExpectedClientID: "robbie-cn",
+		},
+		"should use the last element, describing the client of the nearest proxy": {
+			Trust:            true,
+			Header:           []string{`URI=spiffe://example.org/robbie-first,URI=spiffe://example.org/robbie-last`},
+			ExpectedClientID: "spiffe://example.org/robbie-last",
+		},
+		"should join repeated headers into one list of elements": {
+			Trust:            true,
+			Header:           []string{`URI=spiffe://example.org/robbie-first`, envoyXFCC},
+			ExpectedClientID: "spiffe://example.org/ns/prod/sa/robbie-workload",
+		},
+		"should not trust the header without TrustXFCC": {
+			Header:         []string{envoyXFCC},
+			ExpectedReason: "XFCC header not trusted",
+		},
+		"should report an absent header": {
+			Trust:          true,
+			ExpectedReason: "XFCC header absent",
+		},
+		"should report an element without URI or Common Name": {
+			Trust:          true,
+			Header:         []string{`Hash=abc;DNS=robbie.example.org`},
+			ExpectedReason: "XFCC element has neither URI nor subject Common Name",
+		},
+		"should report an element mapped to an empty client_id": {
+			Trust:          true,
+			Mapper:         func(XFCCElement) string { return "" },
+			Header:         []string{envoyXFCC},
+			ExpectedReason: "XFCC element mapped to empty client_id",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "https://example.com", nil)
+			if err != nil {
+				t.Fatalf("failed to create request for test: %s", err)
+			}
+			for _, value := range tc.Header {
+				req.Header.Add("X-Forwarded-Client-Cert", value)
+			}
+
+			e := &Extractor{Sources: []ClientIDSource{SourceXFCC}, TrustXFCC: tc.Trust, XFCCClientID: tc.Mapper}
+			res, err := e.ExtractResult(req)
+			if tc.ExpectedReason != "" {
+				var missing *MissingClientIDError
+				if !errors.As(err, &missing) || !hasAttempt(missing, SourceXFCC, tc.ExpectedReason) {
+					t.Errorf("Expected a MissingClientIDError with reason %q but got: %v", tc.ExpectedReason, err)
+				}
+			} else if err != nil {
+				t.Errorf("No error expected but got: %q", err)
+			}
+			if res.ClientID != tc.ExpectedClientID {
+				t.Errorf("ExtractResult() ClientID = %q, want %q", res.ClientID, tc.ExpectedClientID)
+			}
+			if tc.ExpectedClientID != "" && res.Source != SourceXFCC {
+				t.Errorf("ExtractResult() Source = %s, want %s", res.Source, SourceXFCC)
+			}
+		})
+	}
+}
+
+func TestParseXFCC(t *testing.T) {
+	tests := map[string]struct {
+		Header   string
+		Expected []XFCCElement
+	}{
+		"should parse a representative Envoy header": {
+			Header: envoyXFCC,
+			Expected: []XFCCElement{{
+				By:      "spiffe://example.org/ns/edge/sa/proxy",
+				Hash:    "468ed33be74eee6556d90c0149c1309e9ba61d6425303443c0748a02dd8de688",
+				Subject: `CN=robbie-cn,OU=eng,O=Example\, Inc.`,
+				URI:     "spiffe://example.org/ns/prod/sa/robbie-workload",
+				DNS:     []string{"robbie.example.org", "robbie.example.com"},
+			}},
+		},
+		"should split elements at commas outside quotes": {
+			Header: `Subject="CN=robbie-a,O=a";URI=spiffe://a, uri=spiffe://b`,
+			Expected: []XFCCElement{
+				{Subject: "CN=robbie-a,O=a", URI: "spiffe://a"},
+				{URI: "spiffe://b"},
+			},
+		},
+		"should unescape quotes inside quoted values": {
+			Header:   `Subject="CN=robbie \"quoted\""`,
+			Expected: []XFCCElement{{Subject: `CN=robbie "quoted"`}},
+		},
+		"should ignore Cert, Chain, and malformed pairs": {
+			Header:   `Cert="-----BEGIN%20CERTIFICATE-----";Chain="x";garbage;URI=spiffe://a`,
+			Expected: []XFCCElement{{URI: "spiffe://a"}},
+		},
+		"should return nothing for an empty header": {
+			Header: "",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := parseXFCC(tc.Header); !reflect.DeepEqual(got, tc.Expected) {
+				t.Errorf("parseXFCC() got = %#v, want %#v", got, tc.Expected)
+			}
+		})
+	}
+}
+
+func TestXFCCSubjectCommonName(t *testing.T) {
+	tests := map[string]struct {
+		Subject  string
+		Expected string
+	}{
+		"should find the CN among other attributes": {
+			Subject:  "OU=eng,CN=robbie-cn,O=example",
+			Expected: "robbie-cn",
+		},
+		"should unescape commas in the CN": {
+			Subject:  `CN=robbie\, the client,O=example`,
+			Expected: "robbie, the client",
+		},
+		"should match the attribute type case-insensitively": {
+			Subject:  "cn=robbie-cn",
+			Expected: "robbie-cn",
+		},
+		"should return nothing without a CN": {
+			Subject: "OU=eng,O=example",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := XFCCSubjectCommonName(XFCCElement{Subject: tc.Subject}); got != tc.Expected {
+				t.Errorf("XFCCSubjectCommonName() got = %q, want %q", got, tc.Expected)
+			}
+		})
+	}
+}